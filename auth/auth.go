@@ -2,9 +2,15 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"rfid-backend/config"
+	"rfid-backend/models"
+	"strconv"
+	"strings"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
@@ -13,17 +19,31 @@ import (
 	"golang.org/x/oauth2"
 )
 
+const (
+	// CSRFHeader is the header browser clients echo the session's CSRF token in.
+	CSRFHeader = "X-CSRF-Token"
+
+	// userContextKey holds the identity of the admin or member making the
+	// current request; adminContextKey whether they are an admin.
+	userContextKey  = "auth_user"
+	adminContextKey = "auth_admin"
+
+	contactMeURL = "https://api.wildapricot.org/v2.2/accounts/%d/contacts/me"
+)
+
 var (
 	// OAuthConf should be initialized in your main package and passed to auth package.
 	OAuthConf *oauth2.Config
 	Logger    *logrus.Logger
 	store     sessions.Store
+	cfg       *config.Config
 )
 
-func Initialize(oauthConfig *oauth2.Config, cfg *config.Config, logger *logrus.Logger) {
+func Initialize(oauthConfig *oauth2.Config, c *config.Config, logger *logrus.Logger) {
 	Logger = logger
 	Logger.Info("Initializing authentication module")
 
+	cfg = c
 	OAuthConf = oauthConfig
 	OAuthConf.ClientSecret = cfg.SSOClientSecret
 	store = cookie.NewStore([]byte(cfg.CookieStoreSecret))
@@ -33,7 +53,7 @@ func Initialize(oauthConfig *oauth2.Config, cfg *config.Config, logger *logrus.L
 
 func StartOAuthFlow(c *gin.Context) {
 	Logger.Info("Starting OAuth flow")
-	state := generateStateOauthToken()
+	state := generateRandomToken()
 	Logger.Infof("Generated OAuth state: %s", state)
 
 	session := sessions.Default(c)
@@ -72,39 +92,67 @@ func OAuthCallback(c *gin.Context) {
 		return
 	}
 
-	Logger.Infof("Token exchange successful: %v", token)
-	handleUserSession(c, token)
+	Logger.Info("Token exchange successful")
+	if err := handleUserSession(c, token); err != nil {
+		Logger.WithError(err).Error("Failed to establish user session")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
 	c.Redirect(http.StatusFound, "/web-ui/home")
 }
 
-func handleUserSession(c *gin.Context, token *oauth2.Token) {
+func handleUserSession(c *gin.Context, token *oauth2.Token) error {
 	Logger.Info("Handling user session")
 
-	userID := "extracted-user-id" // Replace with actual user ID extraction logic
+	contact, err := fetchCurrentContact(c, token)
+	if err != nil {
+		return err
+	}
+
+	userID := strconv.Itoa(contact.Id)
 	session := sessions.Default(c)
 	session.Set("user_id", userID)
+	session.Set("user_name", contact.DisplayName)
+	session.Set("is_admin", contact.IsAccountAdministrator)
+	session.Set("csrf_token", generateRandomToken())
 	session.Set("authenticated", true)
-	err := session.Save()
+	if err := session.Save(); err != nil {
+		return err
+	}
+
+	Logger.Infof("User session saved for user ID: %s (admin: %t)", userID, contact.IsAccountAdministrator)
+	return nil
+}
+
+// fetchCurrentContact looks up the Wild Apricot contact that signed in via SSO.
+func fetchCurrentContact(c *gin.Context, token *oauth2.Token) (*models.Contact, error) {
+	client := OAuthConf.Client(c, token)
+	resp, err := client.Get(fmt.Sprintf(contactMeURL, cfg.WildApricotAccountId))
 	if err != nil {
-		Logger.WithError(err).Error("Failed to save session")
-		c.AbortWithStatus(http.StatusInternalServerError)
-		return
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	Logger.Infof("User session saved for user ID: %s", userID)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d fetching current contact", resp.StatusCode)
+	}
+
+	var contact models.Contact
+	if err := json.NewDecoder(resp.Body).Decode(&contact); err != nil {
+		return nil, err
+	}
+	return &contact, nil
 }
 
-// generateStateOauthToken generates a random state token for OAuth2 flow.
-func generateStateOauthToken() string {
+// generateRandomToken generates a random token for OAuth2 state and CSRF checks.
+func generateRandomToken() string {
 	b := make([]byte, 16)
 	_, err := rand.Read(b)
 	if err != nil {
-		Logger.Errorf("Error generating state token: %v", err)
+		Logger.Errorf("Error generating random token: %v", err)
 		return ""
 	}
-	token := base64.URLEncoding.EncodeToString(b)
-	Logger.Infof("Generated state token: %s", token)
-	return token
+	return base64.URLEncoding.EncodeToString(b)
 }
 
 func RequireAuth(c *gin.Context) {
@@ -121,3 +169,115 @@ func RequireAuth(c *gin.Context) {
 		c.Next()
 	}
 }
+
+// RequireAdminPage guards web UI pages only admins may see. Run it after
+// RequireAuth.
+func RequireAdminPage(c *gin.Context) {
+	session := sessions.Default(c)
+	if isAdmin, _ := session.Get("is_admin").(bool); !isAdmin {
+		Logger.Warnf("Rejected admin page request from non-admin user %v", session.Get("user_id"))
+		c.String(http.StatusForbidden, "Admin access required")
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// RequireAdmin guards the admin API. Callers either present the configured
+// API key as a bearer token, or carry a Wild Apricot admin session; session
+// requests that change state must also echo the session's CSRF token.
+func RequireAdmin(c *gin.Context) {
+	requireAPIUser(c, true)
+}
+
+// RequireMember guards the member API, e.g. machine reservations. It is
+// RequireAdmin without the admin check; the API key counts as an admin.
+func RequireMember(c *gin.Context) {
+	requireAPIUser(c, false)
+}
+
+func requireAPIUser(c *gin.Context, adminOnly bool) {
+	if token, ok := bearerToken(c); ok {
+		if cfg.AdminAPIKey == "" || subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminAPIKey)) != 1 {
+			Logger.Warnf("Rejected API request from %s with invalid API key", c.ClientIP())
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			return
+		}
+		c.Set(userContextKey, "api-key")
+		c.Set(adminContextKey, true)
+		c.Next()
+		return
+	}
+
+	session := sessions.Default(c)
+	userID, ok := session.Get("user_id").(string)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	isAdmin, _ := session.Get("is_admin").(bool)
+	if adminOnly && !isAdmin {
+		Logger.Warnf("Rejected admin API request from non-admin user %s", userID)
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		return
+	}
+
+	if !isSafeMethod(c.Request.Method) {
+		expected, _ := session.Get("csrf_token").(string)
+		provided := c.GetHeader(CSRFHeader)
+		if expected == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(expected)) != 1 {
+			Logger.Warnf("Rejected API request from user %s with invalid CSRF token", userID)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Invalid CSRF token"})
+			return
+		}
+	}
+
+	c.Set(userContextKey, userID)
+	c.Set(adminContextKey, isAdmin)
+	c.Next()
+}
+
+// CSRFToken returns the CSRF token for the current session so pages can
+// embed it for their API calls.
+func CSRFToken(c *gin.Context) string {
+	session := sessions.Default(c)
+	token, _ := session.Get("csrf_token").(string)
+	return token
+}
+
+// CurrentUser returns who is making an API request, as set by RequireAdmin
+// or RequireMember: a contact id, or "api-key".
+func CurrentUser(c *gin.Context) string {
+	return c.GetString(userContextKey)
+}
+
+// IsAdmin reports whether the API request comes from an admin.
+func IsAdmin(c *gin.Context) bool {
+	return c.GetBool(adminContextKey)
+}
+
+// SessionUser returns the contact id of the signed-in web UI user and
+// whether they are an admin. Run it after RequireAuth.
+func SessionUser(c *gin.Context) (string, bool) {
+	session := sessions.Default(c)
+	userID, _ := session.Get("user_id").(string)
+	isAdmin, _ := session.Get("is_admin").(bool)
+	return userID, isAdmin
+}
+
+func bearerToken(c *gin.Context) (string, bool) {
+	header := c.GetHeader("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(header, "Bearer ")), true
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
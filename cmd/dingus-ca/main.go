@@ -0,0 +1,138 @@
+/*
+dingus-ca manages the local certificate authority for DINGUS's mutual TLS
+device listener.
+
+Usage:
+
+	dingus-ca init                          create the CA and an empty CRL
+	dingus-ca issue -mac AA:BB:CC:DD:EE:FF  issue a device certificate and key
+	dingus-ca revoke -cert device.pem       revoke a device certificate
+	dingus-ca revoke -serial 1f2e...        revoke by hex serial number
+	dingus-ca crl                           re-sign the CRL before it expires
+	dingus-ca list                          list revoked serial numbers
+
+Paths default to the values in sample-config.yaml; override them with
+-ca-cert, -ca-key and -crl to match config.yaml.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"rfid-backend/pki"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	command := os.Args[1]
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	caCert := flags.String("ca-cert", "ca/ca.pem", "CA certificate file")
+	caKey := flags.String("ca-key", "ca/ca-key.pem", "CA private key file")
+	crlFile := flags.String("crl", "ca/crl.pem", "certificate revocation list file")
+	mac := flags.String("mac", "", "device MAC address (issue)")
+	outDir := flags.String("out", ".", "directory to write the device certificate and key to (issue)")
+	days := flags.Int("days", 825, "certificate validity in days (init, issue)")
+	certFile := flags.String("cert", "", "device certificate to revoke (revoke)")
+	serial := flags.String("serial", "", "hex serial number to revoke (revoke)")
+	flags.Parse(os.Args[2:])
+
+	validity := time.Duration(*days) * 24 * time.Hour
+
+	switch command {
+	case "init":
+		if err := os.MkdirAll(filepath.Dir(*caKey), 0700); err != nil {
+			log.Fatalf("Failed to create CA directory: %v", err)
+		}
+		ca, err := pki.InitCA(*caCert, *caKey, "DINGUS Device CA", 10*365*24*time.Hour)
+		if err != nil {
+			log.Fatalf("Failed to create CA: %v", err)
+		}
+		if err := ca.RefreshCRL(*crlFile); err != nil {
+			log.Fatalf("Failed to write CRL: %v", err)
+		}
+		fmt.Printf("Created CA %s and CRL %s\n", *caCert, *crlFile)
+
+	case "issue":
+		if *mac == "" {
+			log.Fatal("-mac is required")
+		}
+		ca := loadCA(*caCert, *caKey)
+		certPEM, keyPEM, sn, err := ca.IssueDeviceCert(*mac, validity)
+		if err != nil {
+			log.Fatalf("Failed to issue certificate: %v", err)
+		}
+		base := filepath.Join(*outDir, strings.ReplaceAll(*mac, ":", ""))
+		if err := os.WriteFile(base+".pem", certPEM, 0644); err != nil {
+			log.Fatalf("Failed to write certificate: %v", err)
+		}
+		if err := os.WriteFile(base+"-key.pem", keyPEM, 0600); err != nil {
+			log.Fatalf("Failed to write key: %v", err)
+		}
+		fmt.Printf("Issued certificate %s for %s: %s.pem, %s-key.pem\n", sn.Text(16), *mac, base, base)
+
+	case "revoke":
+		ca := loadCA(*caCert, *caKey)
+		sn := new(big.Int)
+		switch {
+		case *certFile != "":
+			cert, err := pki.LoadCertificate(*certFile)
+			if err != nil {
+				log.Fatalf("Failed to read certificate: %v", err)
+			}
+			sn = cert.SerialNumber
+		case *serial != "":
+			if _, ok := sn.SetString(*serial, 16); !ok {
+				log.Fatalf("Invalid serial number %q", *serial)
+			}
+		default:
+			log.Fatal("-cert or -serial is required")
+		}
+		if err := ca.Revoke(*crlFile, sn); err != nil {
+			log.Fatalf("Failed to revoke certificate: %v", err)
+		}
+		fmt.Printf("Revoked certificate %s\n", sn.Text(16))
+
+	case "crl":
+		ca := loadCA(*caCert, *caKey)
+		if err := ca.RefreshCRL(*crlFile); err != nil {
+			log.Fatalf("Failed to re-sign CRL: %v", err)
+		}
+		fmt.Printf("Re-signed %s\n", *crlFile)
+
+	case "list":
+		ca := loadCA(*caCert, *caKey)
+		serials, err := ca.RevokedSerials(*crlFile)
+		if err != nil {
+			log.Fatalf("Failed to read CRL: %v", err)
+		}
+		for _, sn := range serials {
+			fmt.Println(sn.Text(16))
+		}
+
+	default:
+		usage()
+	}
+}
+
+func loadCA(certFile, keyFile string) *pki.CA {
+	ca, err := pki.LoadCA(certFile, keyFile)
+	if err != nil {
+		log.Fatalf("Failed to load CA: %v", err)
+	}
+	return ca
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: dingus-ca <init|issue|revoke|crl|list> [flags]")
+	os.Exit(2)
+}
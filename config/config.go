@@ -5,7 +5,9 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
+	"rfid-backend/tagformat"
 	"rfid-backend/utils"
 
 	"github.com/sirupsen/logrus"
@@ -18,25 +20,48 @@ var (
 )
 
 type Config struct {
-	CertFile                string `mapstructure:"cert_file" json:"cert_file"`
-	DatabasePath            string `mapstructure:"database_path" json:"database_path"`
-	KeyFile                 string `mapstructure:"key_file" json:"key_file"`
-	TagIdFieldName          string `mapstructure:"tag_id_field_name" json:"tag_id_field_name"`
-	TrainingFieldName       string `mapstructure:"training_field_name" json:"training_field_name"`
-	WildApricotAccountId    int    `mapstructure:"wild_apricot_account_id" json:"wild_apricot_account_id"`
-	ContactFilterQuery      string `mapstructure:"contact_filter_query" json:"contact_filter_query"`
-	SSOClientID             string `mapstructure:"sso_client_id" json:"sso_client_id"`
-	SSOClientSecret         string `mapstructure:"sso_client_secret" json:"sso_client_secret"`
-	SSORedirectURI          string `mapstructure:"sso_redirect_uri" json:"sso_redirect_uri"`
-	CookieStoreSecret       string `mapstructure:"cookie_store_secret" json:"cookie_store_secret"`
+	CertFile                string        `mapstructure:"cert_file" json:"cert_file"`
+	DatabasePath            string        `mapstructure:"database_path" json:"database_path"`
+	KeyFile                 string        `mapstructure:"key_file" json:"key_file"`
+	TagIdFieldName          string        `mapstructure:"tag_id_field_name" json:"tag_id_field_name"`
+	TrainingFieldName       string        `mapstructure:"training_field_name" json:"training_field_name"`
+	WildApricotAccountId    int           `mapstructure:"wild_apricot_account_id" json:"wild_apricot_account_id"`
+	ContactFilterQuery      string        `mapstructure:"contact_filter_query" json:"contact_filter_query"`
+	SSOClientID             string        `mapstructure:"sso_client_id" json:"sso_client_id"`
+	SSOClientSecret         string        `mapstructure:"sso_client_secret" json:"sso_client_secret"`
+	SSORedirectURI          string        `mapstructure:"sso_redirect_uri" json:"sso_redirect_uri"`
+	CookieStoreSecret       string        `mapstructure:"cookie_store_secret" json:"cookie_store_secret"`
+	MTLSListenAddr          string        `mapstructure:"mtls_listen_addr" json:"mtls_listen_addr"`
+	MTLSCACertFile          string        `mapstructure:"mtls_ca_cert_file" json:"mtls_ca_cert_file"`
+	MTLSCRLFile             string        `mapstructure:"mtls_crl_file" json:"mtls_crl_file"`
+	MTLSRequired            bool          `mapstructure:"mtls_required" json:"mtls_required"`
+	DeviceOfflineAfter      time.Duration `mapstructure:"device_offline_after" json:"device_offline_after"`
+	AlertWebhookURL         string        `mapstructure:"alert_webhook_url" json:"alert_webhook_url"`
+	CacheSigningKeyFile     string        `mapstructure:"cache_signing_key_file" json:"cache_signing_key_file"`
+	CacheSnapshotValidity   time.Duration `mapstructure:"cache_snapshot_validity" json:"cache_snapshot_validity"`
+	Timezone                string        `mapstructure:"timezone" json:"timezone"`
+	OccupancyExpiry         time.Duration `mapstructure:"occupancy_expiry" json:"occupancy_expiry"`
+	KeyholderTraining       string        `mapstructure:"keyholder_training" json:"keyholder_training"`
+	AntiPassback            string        `mapstructure:"anti_passback" json:"anti_passback"`
+	TagSharingWindow        time.Duration `mapstructure:"tag_sharing_window" json:"tag_sharing_window"`
+	TagSharingAction        string        `mapstructure:"tag_sharing_action" json:"tag_sharing_action"`
+	TagFormats              []string      `mapstructure:"tag_formats" json:"tag_formats"`
+	EventUnlockDoors        []string      `mapstructure:"event_unlock_doors" json:"event_unlock_doors"`
+	EventUnlockLead         time.Duration `mapstructure:"event_unlock_lead" json:"event_unlock_lead"`
+	ReservationMaxLength    time.Duration `mapstructure:"reservation_max_length" json:"reservation_max_length"`
+	ReservationMaxBooked    time.Duration `mapstructure:"reservation_max_booked" json:"reservation_max_booked"`
+	ReservationHorizon      time.Duration `mapstructure:"reservation_horizon" json:"reservation_horizon"`
+	TrainingReminderLead    time.Duration `mapstructure:"training_reminder_lead" json:"training_reminder_lead"`
 	WildApricotApiKey       string
 	WildApricotWebhookToken string
+	AdminAPIKey             string
 	log                     *logrus.Logger
 }
 
 func init() {
-	// Initialize the config singleton instance.
-	config = utils.NewSingleton(loadConfig())
+	// Initialize the config singleton instance. The config itself is loaded
+	// lazily on the first call to LoadConfig.
+	config = utils.NewSingleton(nil)
 }
 
 // LoadConfig returns the configuration instance.
@@ -74,6 +99,91 @@ func loadConfig() interface{} {
 		log.Fatalf("Key file not found: %s", cfg.KeyFile)
 	}
 
+	// The mutual TLS device listener is optional
+	if cfg.MTLSListenAddr != "" {
+		cfg.MTLSCACertFile = filepath.Join(projectRoot, cfg.MTLSCACertFile)
+		if _, err := os.Stat(cfg.MTLSCACertFile); os.IsNotExist(err) {
+			log.Fatalf("mTLS CA certificate file not found: %s", cfg.MTLSCACertFile)
+		}
+
+		cfg.MTLSCRLFile = filepath.Join(projectRoot, cfg.MTLSCRLFile)
+		if _, err := os.Stat(cfg.MTLSCRLFile); os.IsNotExist(err) {
+			log.Fatalf("mTLS CRL file not found: %s", cfg.MTLSCRLFile)
+		}
+	} else if cfg.MTLSRequired {
+		log.Fatalf("mtls_required is set but mtls_listen_addr is empty")
+	}
+
+	if cfg.DeviceOfflineAfter <= 0 {
+		cfg.DeviceOfflineAfter = 5 * time.Minute
+	}
+
+	// The cache signing key is generated on first start if missing
+	if cfg.CacheSigningKeyFile == "" {
+		cfg.CacheSigningKeyFile = "cache-signing-key.pem"
+	}
+	cfg.CacheSigningKeyFile = filepath.Join(projectRoot, cfg.CacheSigningKeyFile)
+
+	if cfg.CacheSnapshotValidity <= 0 {
+		cfg.CacheSnapshotValidity = 72 * time.Hour
+	}
+
+	// Schedules without their own timezone are evaluated in this one
+	if cfg.Timezone == "" {
+		cfg.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(cfg.Timezone); err != nil {
+		log.Fatalf("Unknown timezone %s: %s", cfg.Timezone, err)
+	}
+
+	// Members who leave without swiping out stop counting after this long
+	if cfg.OccupancyExpiry <= 0 {
+		cfg.OccupancyExpiry = 12 * time.Hour
+	}
+
+	// Members holding this training count as keyholders for two-person rules
+	if cfg.KeyholderTraining == "" {
+		cfg.KeyholderTraining = "Keyholder"
+	}
+
+	// Suspicious swipes are flagged to admins, denied, or ignored
+	if cfg.AntiPassback == "" {
+		cfg.AntiPassback = "off"
+	}
+	if cfg.TagSharingAction == "" {
+		cfg.TagSharingAction = "flag"
+	}
+	for _, action := range []string{cfg.AntiPassback, cfg.TagSharingAction} {
+		if action != "off" && action != "flag" && action != "deny" {
+			log.Fatalf("Anomaly action must be off, flag or deny, got %s", action)
+		}
+	}
+	if cfg.TagSharingWindow <= 0 {
+		cfg.TagSharingWindow = 30 * time.Second
+	}
+	// Public Wild Apricot events unlock these doors, starting a little early
+	if cfg.EventUnlockLead < 0 {
+		log.Fatalf("event_unlock_lead must not be negative, got %s", cfg.EventUnlockLead)
+	}
+	// Members share reservable machines within these booking limits
+	if cfg.ReservationMaxLength <= 0 {
+		cfg.ReservationMaxLength = 4 * time.Hour
+	}
+	if cfg.ReservationMaxBooked <= 0 {
+		cfg.ReservationMaxBooked = 8 * time.Hour
+	}
+	if cfg.ReservationHorizon <= 0 {
+		cfg.ReservationHorizon = 14 * 24 * time.Hour
+	}
+	// Admins are reminded this long before a member's training lapses
+	if cfg.TrainingReminderLead <= 0 {
+		cfg.TrainingReminderLead = 30 * 24 * time.Hour
+	}
+	// Tags may be written in any of these notations; all formats if unset
+	if _, err := tagformat.NewParser(cfg.TagFormats); err != nil {
+		log.Fatalf("Invalid tag_formats: %v", err)
+	}
+
 	// Load environment variables
 	cfg.WildApricotApiKey = os.Getenv("WILD_APRICOT_API_KEY")
 	if cfg.WildApricotApiKey == "" {
@@ -105,6 +215,9 @@ func loadConfig() interface{} {
 		log.Fatalf("COOKIE_STORE_SECRET not set in environment variables")
 	}
 
+	// Optional: enables bearer token access to the admin API for scripts
+	cfg.AdminAPIKey = os.Getenv("ADMIN_API_KEY")
+
 	return &cfg
 }
 
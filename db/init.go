@@ -17,6 +17,10 @@ func InitDB(dataSourceName string) (*sql.DB, error) {
 		return nil, err
 	}
 
+	if err := migrate(db); err != nil {
+		return nil, err
+	}
+
 	schemaFile, err := fs.ReadFile(schemaFS, "schema/tagsdb.sql")
 	if err != nil {
 		return nil, err
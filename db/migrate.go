@@ -0,0 +1,286 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// upgrades bring databases created by an older tagsdb.sql up to the current
+// schema. They run before the schema file on every start, so each step must
+// be idempotent and skip tables the schema file has yet to create.
+var upgrades = []func(tx *sql.Tx) error{
+	addDeviceCredentialColumns,
+	clearPendingSecrets,
+	addDeviceApprovalColumns,
+	rekeyDevicesOnMAC,
+	addDeviceHealthColumns,
+	addDeviceTrainingMode,
+	addDeviceRecordColumns,
+	addDeviceMaintenanceColumns,
+	addDoorDirection,
+	addTwoPersonRule,
+	addReservable,
+	addTrainingExpiryColumns,
+	addRegisteredFrom,
+	addMemberAdminFlag,
+}
+
+func migrate(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, upgrade := range upgrades {
+		if err := upgrade(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func addDeviceCredentialColumns(tx *sql.Tx) error {
+	if _, err := addColumnIfMissing(tx, "devices", "secret_hash", "TEXT"); err != nil {
+		return err
+	}
+	_, err := addColumnIfMissing(tx, "devices", "enrollment_hash", "TEXT")
+	return err
+}
+
+// clearPendingSecrets wipes the plaintext credentials earlier versions held
+// until a device collected them. Those devices go back to having no
+// credential, so an admin issues them an enrollment code.
+func clearPendingSecrets(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "devices", "pending_secret")
+	if err != nil || !exists {
+		return err
+	}
+	_, err = tx.Exec("UPDATE devices SET secret_hash = NULL, pending_secret = NULL WHERE pending_secret IS NOT NULL")
+	return err
+}
+
+func addDeviceApprovalColumns(tx *sql.Tx) error {
+	added, err := addColumnIfMissing(tx, "devices", "status", "TEXT NOT NULL DEFAULT 'pending'")
+	if err != nil {
+		return err
+	}
+	// Devices that were already issued a credential were approved by an admin
+	if added {
+		if _, err := tx.Exec("UPDATE devices SET status = 'approved' WHERE secret_hash IS NOT NULL"); err != nil {
+			return err
+		}
+	}
+
+	if _, err := addColumnIfMissing(tx, "devices", "name", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	_, err = addColumnIfMissing(tx, "devices", "location", "TEXT NOT NULL DEFAULT ''")
+	return err
+}
+
+// rekeyDevicesOnMAC rebuilds devices with the MAC address as its key. The
+// original table made ip_address UNIQUE, which SQLite cannot drop in place.
+func rekeyDevicesOnMAC(tx *sql.Tx) error {
+	exists, err := tableExists(tx, "devices")
+	if err != nil || !exists {
+		return err
+	}
+
+	rekeyed, err := columnExists(tx, "devices", "first_seen")
+	if err != nil || rekeyed {
+		return err
+	}
+
+	statements := []string{
+		`CREATE TABLE devices_rekeyed (
+			mac_address TEXT PRIMARY KEY,
+			ip_address TEXT NOT NULL,
+			requires_training INTEGER NOT NULL,
+			secret_hash TEXT,
+			enrollment_hash TEXT,
+			status TEXT NOT NULL DEFAULT 'pending',
+			name TEXT NOT NULL DEFAULT '',
+			location TEXT NOT NULL DEFAULT '',
+			first_seen DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_seen DATETIME
+		)`,
+		`INSERT INTO devices_rekeyed (mac_address, ip_address, requires_training, secret_hash,
+			enrollment_hash, status, name, location)
+		SELECT mac_address, ip_address, requires_training, secret_hash,
+			enrollment_hash, status, name, location
+		FROM devices`,
+		`DROP TABLE devices`,
+		`ALTER TABLE devices_rekeyed RENAME TO devices`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addDeviceHealthColumns(tx *sql.Tx) error {
+	columns := [][2]string{
+		{"firmware_version", "TEXT NOT NULL DEFAULT ''"},
+		{"uptime_seconds", "INTEGER NOT NULL DEFAULT 0"},
+		{"cache_version", "TEXT NOT NULL DEFAULT ''"},
+		{"stats", "TEXT NOT NULL DEFAULT '{}'"},
+		{"last_heartbeat", "DATETIME"},
+		{"online", "INTEGER NOT NULL DEFAULT 0"},
+	}
+	for _, column := range columns {
+		if _, err := addColumnIfMissing(tx, "devices", column[0], column[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addDeviceTrainingMode(tx *sql.Tx) error {
+	_, err := addColumnIfMissing(tx, "devices", "training_mode", "TEXT NOT NULL DEFAULT 'all'")
+	return err
+}
+
+func addDeviceRecordColumns(tx *sql.Tx) error {
+	added, err := addColumnIfMissing(tx, "devices", "device_type", "TEXT NOT NULL DEFAULT 'machine'")
+	if err != nil {
+		return err
+	}
+	// Doors used to be marked by linking them to the "Door" label the old
+	// device page added; real trainings merely containing "door" stay
+	if added {
+		if _, err := tx.Exec(`UPDATE devices SET device_type = 'door' WHERE mac_address IN (
+			SELECT mac_address FROM devices_trainings_link WHERE label = 'Door')`); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM devices_trainings_link WHERE label = 'Door'"); err != nil {
+			return err
+		}
+	}
+
+	if _, err := addColumnIfMissing(tx, "devices", "notes", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	_, err = addColumnIfMissing(tx, "devices", "enabled", "INTEGER NOT NULL DEFAULT 1")
+	return err
+}
+
+func addDeviceMaintenanceColumns(tx *sql.Tx) error {
+	if _, err := addColumnIfMissing(tx, "devices", "in_maintenance", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	_, err := addColumnIfMissing(tx, "devices", "maintenance_reason", "TEXT NOT NULL DEFAULT ''")
+	return err
+}
+
+func addDoorDirection(tx *sql.Tx) error {
+	_, err := addColumnIfMissing(tx, "devices", "door_direction", "TEXT NOT NULL DEFAULT 'entry'")
+	return err
+}
+
+func addTwoPersonRule(tx *sql.Tx) error {
+	columns := [][3]string{
+		{"devices", "two_person_rule", "TEXT NOT NULL DEFAULT ''"},
+		{"devices", "partner_window_seconds", "INTEGER NOT NULL DEFAULT 60"},
+		{"access_log", "partner_tag_id", "INTEGER"},
+		{"access_log", "partner_contact_id", "INTEGER"},
+	}
+	for _, column := range columns {
+		if _, err := addColumnIfMissing(tx, column[0], column[1], column[2]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addReservable(tx *sql.Tx) error {
+	_, err := addColumnIfMissing(tx, "devices", "reservable", "INTEGER NOT NULL DEFAULT 0")
+	return err
+}
+
+// addTrainingExpiryColumns dates member trainings. Trainings held before
+// the upgrade count as granted at it, so none lapse straight away.
+func addTrainingExpiryColumns(tx *sql.Tx) error {
+	if _, err := addColumnIfMissing(tx, "trainings", "validity_days", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	// SQLite cannot add a column defaulting to the current time
+	added, err := addColumnIfMissing(tx, "members_trainings_link", "granted_at", "DATETIME")
+	if err != nil {
+		return err
+	}
+	if added {
+		if _, err := tx.Exec("UPDATE members_trainings_link SET granted_at = ?", time.Now().UTC()); err != nil {
+			return err
+		}
+	}
+	if _, err := addColumnIfMissing(tx, "members_trainings_link", "expired", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	_, err = addColumnIfMissing(tx, "members_trainings_link", "reminded_at", "DATETIME")
+	return err
+}
+
+func addRegisteredFrom(tx *sql.Tx) error {
+	_, err := addColumnIfMissing(tx, "devices", "registered_from", "TEXT NOT NULL DEFAULT ''")
+	return err
+}
+
+// addMemberAdminFlag marks no one an admin until the next Wild Apricot sync
+// fills the flag in.
+func addMemberAdminFlag(tx *sql.Tx) error {
+	_, err := addColumnIfMissing(tx, "members", "is_admin", "INTEGER NOT NULL DEFAULT 0")
+	return err
+}
+
+func tableExists(tx *sql.Tx, table string) (bool, error) {
+	var exists bool
+	err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?)", table).Scan(&exists)
+	return exists, err
+}
+
+func columnExists(tx *sql.Tx, table, column string) (bool, error) {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name, kind string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &kind, &notNull, &defaultVal, &primaryKey); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// addColumnIfMissing reports whether it added the column, so callers can
+// backfill values for existing rows.
+func addColumnIfMissing(tx *sql.Tx, table, column, definition string) (bool, error) {
+	exists, err := tableExists(tx, table)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	hasColumn, err := columnExists(tx, table, column)
+	if err != nil || hasColumn {
+		return false, err
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err == nil, err
+}
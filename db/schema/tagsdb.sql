@@ -1,30 +1,276 @@
 CREATE TABLE IF NOT EXISTS members (
     contact_id INTEGER PRIMARY KEY,
     tag_id INTEGER NOT NULL,
-    membership_level INTEGER NOT NULL
+    membership_level INTEGER NOT NULL,
+    is_admin INTEGER NOT NULL DEFAULT 0  -- Wild Apricot account administrator; only they pass a lockdown
 );
 
 CREATE INDEX IF NOT EXISTS idx_members_tag_id ON members(tag_id);
 
+-- Wild Apricot membership levels seen during sync, named for the schedule API
+CREATE TABLE IF NOT EXISTS membership_levels (
+    id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL DEFAULT ''
+);
+
+-- Weekly access windows. A schedule is closed outside its windows and on
+-- its holidays. An empty timezone means the server's configured zone.
+CREATE TABLE IF NOT EXISTS schedules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    timezone TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS schedule_windows (
+    schedule_id INTEGER NOT NULL,
+    weekday INTEGER NOT NULL,    -- 0 is Sunday
+    start_time TEXT NOT NULL,    -- "HH:MM"
+    end_time TEXT NOT NULL,      -- "HH:MM", exclusive; may be "24:00"
+    FOREIGN KEY (schedule_id) REFERENCES schedules(id)
+);
+
+CREATE TABLE IF NOT EXISTS schedule_holidays (
+    schedule_id INTEGER NOT NULL,
+    date TEXT NOT NULL,          -- "YYYY-MM-DD"
+    name TEXT NOT NULL DEFAULT '',
+    FOREIGN KEY (schedule_id) REFERENCES schedules(id),
+    UNIQUE (schedule_id, date)
+);
+
+-- target is a membership level id, member contact id or device MAC address
+-- depending on target_type. A member's own schedule replaces their level's.
+CREATE TABLE IF NOT EXISTS schedule_assignments (
+    target_type TEXT NOT NULL,   -- level, member or device
+    target TEXT NOT NULL,
+    schedule_id INTEGER NOT NULL,
+    FOREIGN KEY (schedule_id) REFERENCES schedules(id),
+    PRIMARY KEY (target_type, target)
+);
+
 
 CREATE TABLE IF NOT EXISTS devices (
-    ip_address TEXT NOT NULL UNIQUE,
-    mac_address TEXT NOT NULL UNIQUE,
-    requires_training INTEGER NOT NULL
+    mac_address TEXT PRIMARY KEY,
+    ip_address TEXT NOT NULL,    -- last address the device was seen at; may briefly collide after DHCP changes
+    requires_training INTEGER NOT NULL,
+    secret_hash TEXT,       -- SHA-256 of the credential readers present as their Basic auth password
+    enrollment_hash TEXT,   -- SHA-256 of the one-time code an approved device presents to collect its credential
+    status TEXT NOT NULL DEFAULT 'pending', -- pending, approved, rejected or decommissioned
+    name TEXT NOT NULL DEFAULT '',
+    location TEXT NOT NULL DEFAULT '',
+    device_type TEXT NOT NULL DEFAULT 'machine', -- door, machine or kiosk
+    notes TEXT NOT NULL DEFAULT '',
+    enabled INTEGER NOT NULL DEFAULT 1,          -- disabled devices deny every tag
+    in_maintenance INTEGER NOT NULL DEFAULT 0,   -- temporarily locked out; denies every tag
+    maintenance_reason TEXT NOT NULL DEFAULT '',
+    training_mode TEXT NOT NULL DEFAULT 'all',  -- 'all' or 'any' of the linked trainings
+    door_direction TEXT NOT NULL DEFAULT 'entry', -- doors: 'entry', or 'exit' for readers people swipe out at
+    two_person_rule TEXT NOT NULL DEFAULT '',     -- machines: '', 'partner' or 'keyholder'
+    partner_window_seconds INTEGER NOT NULL DEFAULT 60, -- how long a first swipe waits for a partner
+    reservable INTEGER NOT NULL DEFAULT 0,        -- machines: booked through reservations, granting only the holder of an open one
+    first_seen DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen DATETIME,
+    firmware_version TEXT NOT NULL DEFAULT '',  -- reported by the last heartbeat
+    uptime_seconds INTEGER NOT NULL DEFAULT 0,
+    cache_version TEXT NOT NULL DEFAULT '',
+    stats TEXT NOT NULL DEFAULT '{}',           -- reader-defined JSON counters
+    last_heartbeat DATETIME,
+    online INTEGER NOT NULL DEFAULT 0,          -- maintained by the device monitor
+    registered_from TEXT NOT NULL DEFAULT ''    -- address of the last unauthenticated registration; never moves ip_address
+);
+
+CREATE INDEX IF NOT EXISTS idx_devices_ip_address ON devices(ip_address);
+
+-- Local exceptions to Wild Apricot data. They live outside the members
+-- table so full syncs never touch them. Exactly one of tag_id and
+-- contact_id is set.
+CREATE TABLE IF NOT EXISTS access_overrides (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    effect TEXT NOT NULL,                 -- allow or deny
+    tag_id INTEGER,
+    contact_id INTEGER,
+    mac_address TEXT NOT NULL DEFAULT '', -- device scope; empty for every device
+    expires_at DATETIME,                  -- NULL if the override does not expire
+    expired INTEGER NOT NULL DEFAULT 0,   -- set once readers were told it lapsed
+    reason TEXT NOT NULL DEFAULT '',
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Time-limited door access for non-members. Like overrides these live
+-- outside the members table so syncs never touch them.
+CREATE TABLE IF NOT EXISTS guest_passes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    tag_id INTEGER NOT NULL,
+    sponsor_contact_id INTEGER NOT NULL,  -- member vouching for the guest
+    starts_at DATETIME NOT NULL,
+    ends_at DATETIME NOT NULL,
+    revoked INTEGER NOT NULL DEFAULT 0,
+    active INTEGER NOT NULL DEFAULT 0,    -- whether readers were last told it is valid
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_guest_passes_tag_id ON guest_passes(tag_id);
+
+-- Doors a guest pass opens; none means every door
+CREATE TABLE IF NOT EXISTS guest_pass_doors (
+    guest_pass_id INTEGER NOT NULL,
+    mac_address TEXT NOT NULL,
+    FOREIGN KEY (guest_pass_id) REFERENCES guest_passes(id),
+    PRIMARY KEY (guest_pass_id, mac_address)
+);
+
+-- Machine runs reported by machine controllers. ended_at is NULL while the
+-- machine is running.
+CREATE TABLE IF NOT EXISTS machine_sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    mac_address TEXT NOT NULL,
+    tag_id INTEGER NOT NULL,
+    contact_id INTEGER,                   -- member holding the tag at the start, if any
+    started_at DATETIME NOT NULL,
+    ended_at DATETIME,
+    duration_seconds INTEGER NOT NULL DEFAULT 0,
+    FOREIGN KEY (mac_address) REFERENCES devices(mac_address)
+);
+
+CREATE INDEX IF NOT EXISTS idx_machine_sessions_started_at ON machine_sessions(started_at);
+CREATE INDEX IF NOT EXISTS idx_machine_sessions_mac_address ON machine_sessions(mac_address, ended_at);
+
+-- Every tag checked through /api/authenticate
+CREATE TABLE IF NOT EXISTS access_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    mac_address TEXT NOT NULL,
+    tag_id INTEGER NOT NULL,
+    contact_id INTEGER,                   -- member holding the tag at the time, if any
+    granted INTEGER NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    partner_tag_id INTEGER,               -- second person under a two-person rule
+    partner_contact_id INTEGER,
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_access_log_created_at ON access_log(created_at);
+
+-- Suspicious swipes found by anti-passback and tag sharing checks
+CREATE TABLE IF NOT EXISTS access_anomalies (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind TEXT NOT NULL,                   -- passback or shared_tag
+    tag_id INTEGER NOT NULL,
+    contact_id INTEGER,
+    mac_address TEXT NOT NULL,
+    detail TEXT NOT NULL DEFAULT '',
+    denied INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL
+);
+
+-- One-off windows holding doors unlocked, e.g. for an open house. Windows
+-- synced from Wild Apricot events carry the event id.
+CREATE TABLE IF NOT EXISTS unlock_windows (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    starts_at DATETIME NOT NULL,
+    ends_at DATETIME NOT NULL,
+    event_id INTEGER UNIQUE,
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS unlock_window_doors (
+    window_id INTEGER NOT NULL,
+    mac_address TEXT NOT NULL,
+    FOREIGN KEY (window_id) REFERENCES unlock_windows(id),
+    PRIMARY KEY (window_id, mac_address)
+);
+
+-- Bookings of reservable machines. Cancelled ones are kept for the record;
+-- one cancelled after it started is ended early instead.
+CREATE TABLE IF NOT EXISTS reservations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    mac_address TEXT NOT NULL,
+    contact_id INTEGER NOT NULL,
+    starts_at DATETIME NOT NULL,
+    ends_at DATETIME NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    cancelled INTEGER NOT NULL DEFAULT 0,
+    cancelled_by TEXT NOT NULL DEFAULT '',
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE INDEX IF NOT EXISTS idx_reservations_mac ON reservations(mac_address, starts_at);
+
+-- Space-wide mode changes; the latest is in effect and none means normal
+CREATE TABLE IF NOT EXISTS space_mode_changes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    mode TEXT NOT NULL,                   -- normal, unlocked or lockdown
+    reason TEXT NOT NULL DEFAULT '',
+    changed_by TEXT NOT NULL DEFAULT '',
+    changed_at DATETIME NOT NULL
+);
+
+-- Who is in the space, from entry and exit door swipes
+CREATE TABLE IF NOT EXISTS occupancy (
+    tag_id INTEGER PRIMARY KEY,
+    contact_id INTEGER,
+    mac_address TEXT NOT NULL,            -- door they came in through
+    entered_at DATETIME NOT NULL
+);
+
+-- Log of access changes that readers catch up on through /api/cacheDelta.
+-- A row without a tag_id tells the device in mac_address, or every device
+-- when it is empty, to reload its whole cache.
+CREATE TABLE IF NOT EXISTS access_changes (
+    sequence INTEGER PRIMARY KEY AUTOINCREMENT,
+    tag_id INTEGER,
+    mac_address TEXT NOT NULL DEFAULT '',
+    was_member INTEGER NOT NULL DEFAULT 0,
+    before_labels TEXT NOT NULL DEFAULT '[]',   -- JSON array of training labels
+    is_member INTEGER NOT NULL DEFAULT 0,
+    after_labels TEXT NOT NULL DEFAULT '[]',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS device_audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    mac_address TEXT NOT NULL,   -- not a foreign key; entries outlive deleted devices
+    action TEXT NOT NULL,
+    detail TEXT NOT NULL DEFAULT '',
+    actor TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_audit_log_mac ON device_audit_log(mac_address);
+
 CREATE TABLE IF NOT EXISTS trainings (
-    label TEXT PRIMARY KEY
+    label TEXT PRIMARY KEY,
+    validity_days INTEGER NOT NULL DEFAULT 0  -- days a grant stays valid; 0 never lapses
 );
 
+-- A lapsed training is kept but marked expired until the member recertifies
 CREATE TABLE IF NOT EXISTS members_trainings_link (
     tag_id INTEGER NOT NULL,
     label TEXT NOT NULL,
+    granted_at DATETIME DEFAULT CURRENT_TIMESTAMP, -- first seen by a sync (Wild Apricot has no grant date), or last recertified; upgrades date existing grants at the upgrade
+    expired INTEGER NOT NULL DEFAULT 0,
+    reminded_at DATETIME,                          -- recertification reminder sent for this grant
     FOREIGN KEY (tag_id) REFERENCES members(tag_id),
     FOREIGN KEY (label) REFERENCES trainings(label),
     UNIQUE (tag_id, label)
 );
 
+-- How trainings build on one another: a training counts only once the
+-- trainings it requires are held, and holding it counts as holding the
+-- trainings it implies
+CREATE TABLE IF NOT EXISTS training_relations (
+    label TEXT NOT NULL,
+    related TEXT NOT NULL,
+    relation TEXT NOT NULL,  -- 'requires' or 'implies'
+    FOREIGN KEY (label) REFERENCES trainings(label),
+    FOREIGN KEY (related) REFERENCES trainings(label),
+    PRIMARY KEY (label, relation, related)
+);
+
 CREATE TABLE IF NOT EXISTS devices_trainings_link (
     mac_address TEXT NOT NULL,
     label TEXT NOT NULL,
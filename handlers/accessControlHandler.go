@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 	"rfid-backend/services"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -11,24 +13,27 @@ import (
 
 type AccessControlHandler struct {
 	dbService *services.DBService
+	notifier  *services.Notifier
 	log       *logrus.Logger
 }
 
-func NewAccessControlHandler(dbService *services.DBService, logger *logrus.Logger) *AccessControlHandler {
+func NewAccessControlHandler(dbService *services.DBService, notifier *services.Notifier, logger *logrus.Logger) *AccessControlHandler {
 	return &AccessControlHandler{
 		dbService: dbService,
+		notifier:  notifier,
 		log:       logger,
 	}
 }
 
 // @Summary Authenticate a tag swipe
-// @Description Authenticates a tag swipe against the db
+// @Description Authenticates a tag swipe against the db. The body is the tag as the reader decoded it,
+// @Description in any configured tag format: decimal, facility:card, a raw Wiegand frame (0b...) or a hex UID.
 // @ID authenticate
 // @Accept  json
 // @Produce  json
-// @Success 200  {string}  string "Device registered successfully"
+// @Success 200  {string}  string "Access granted"
 // @Failure 400  {string}  string "Bad Request"
-// @Failure 500  {string}  string "Internal Server Error"
+// @Failure 401  {string}  string "Access denied"
 // @Router /api/authenticate [post]
 func (ach *AccessControlHandler) HandleAuthenticate(c *gin.Context) {
 	// Read the raw data from the request body
@@ -48,22 +53,42 @@ func (ach *AccessControlHandler) HandleAuthenticate(c *gin.Context) {
 		return
 	}
 
+	device := currentDevice(c)
+
 	// Log the received tag for debugging purposes
-	ach.log.Printf("Received tag for verification: %s", tag)
+	ach.log.Printf("Received tag for verification: %s from device %s", tag, device.MACAddress)
 
 	// Proceed with tag verification...
-	if ach.authenticateTag(tag) {
-		c.Status(http.StatusOK)
-	} else {
-		c.Status(http.StatusUnauthorized)
+	now := time.Now()
+	decision, err := ach.dbService.AuthorizeTagAt(*device, tag, now)
+	if err != nil {
+		ach.log.Printf("Error authorizing tag: %v", err)
 	}
-}
 
-func (ach *AccessControlHandler) authenticateTag(raw_tag string) bool {
-	exists, err := ach.dbService.TagExists(raw_tag)
+	decision, anomalies, err := ach.dbService.ScreenAccess(*device, tag, decision, now)
 	if err != nil {
-		ach.log.Printf("Error checking tag existence: %v", err)
-		return false
+		ach.log.Errorf("Error screening tag %s for anomalies: %v", tag, err)
+	}
+	for _, anomaly := range anomalies {
+		action := "flagged"
+		if anomaly.Denied {
+			action = "denied"
+		}
+		ach.notifier.Notify("Suspicious tag use", fmt.Sprintf("Tag %d at %s (%s): %s, %s",
+			anomaly.TagId, device.Name, device.MACAddress, anomaly.Detail, action))
+	}
+
+	if err := ach.dbService.RecordAccess(*device, tag, decision, now); err != nil {
+		ach.log.Errorf("Failed to log access for tag %s at device %s: %v", tag, device.MACAddress, err)
+	}
+
+	if decision.Granted {
+		if decision.PartnerTagId != 0 {
+			ach.log.Infof("Granted tag %s at device %s with partner tag %d", tag, device.MACAddress, decision.PartnerTagId)
+		}
+		c.Status(http.StatusOK)
+	} else {
+		ach.log.Infof("Denied tag %s at device %s: %s", tag, device.MACAddress, decision.Reason)
+		c.Status(http.StatusUnauthorized)
 	}
-	return exists
 }
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"rfid-backend/services"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// keepAliveInterval keeps idle push connections from being dropped by NAT
+// and lets readers notice a dead server.
+const keepAliveInterval = 25 * time.Second
+
+type AccessEventsHandler struct {
+	dbService *services.DBService
+	log       *logrus.Logger
+}
+
+func NewAccessEventsHandler(dbService *services.DBService, logger *logrus.Logger) *AccessEventsHandler {
+	return &AccessEventsHandler{
+		dbService: dbService,
+		log:       logger,
+	}
+}
+
+// @Summary Access change stream
+// @Description Server-Sent Events stream of changes to the requesting device's access list.
+// @Description "access" events carry {"sequence": N, "add": [...], "remove": [...]}; "reset" events mean
+// @Description the reader should download its whole cache again. A "ready" event is sent on connect.
+// @ID access-events
+// @Produce  text/event-stream
+// @Success 200  {string}  string "Event stream"
+// @Failure 401  {string}  string "Unauthorized"
+// @Failure 403  {string}  string "Device not approved"
+// @Router /api/accessEvents [get]
+func (ah *AccessEventsHandler) HandleAccessEvents(c *gin.Context) {
+	device := currentDevice(c)
+	if !device.IsApproved() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Device not approved"})
+		return
+	}
+	mac := device.MACAddress
+
+	sub := ah.dbService.SubscribeAccessChanges()
+	defer sub.Close()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("ready", gin.H{})
+	c.Writer.Flush()
+
+	ah.log.Infof("Device %s subscribed to access changes", mac)
+	defer ah.log.Infof("Device %s unsubscribed from access changes", mac)
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			return true
+		case change := <-sub.C:
+			return ah.send(c, mac, sub, change)
+		}
+	})
+}
+
+// send forwards one change to the device and reports whether to keep the
+// stream open.
+func (ah *AccessEventsHandler) send(c *gin.Context, mac string, sub *services.AccessSubscription, change services.AccessChange) bool {
+	if sub.Missed() {
+		c.SSEvent("reset", gin.H{})
+		return true
+	}
+
+	device, err := ah.dbService.GetDevice(mac)
+	if err != nil {
+		ah.log.Errorf("Failed to look up device %s for access change: %v", mac, err)
+		c.SSEvent("reset", gin.H{})
+		return true
+	}
+	// Deleted, decommissioned and revoked devices lose the stream
+	if device == nil || !device.IsApproved() {
+		c.SSEvent("reset", gin.H{})
+		return false
+	}
+
+	if change.Reset {
+		if change.MACAddress == "" || change.MACAddress == mac {
+			c.SSEvent("reset", gin.H{})
+		}
+		return true
+	}
+
+	add, remove, err := ah.dbService.DeviceAccessDelta(*device, change.Tags)
+	if err != nil {
+		ah.log.Errorf("Failed to work out access changes for device %s: %v", mac, err)
+		c.SSEvent("reset", gin.H{})
+		return true
+	}
+	if len(add) == 0 && len(remove) == 0 {
+		return true
+	}
+
+	if add == nil {
+		add = []uint64{}
+	}
+	if remove == nil {
+		remove = []uint64{}
+	}
+	c.SSEvent("access", gin.H{"sequence": change.Sequence, "add": add, "remove": remove})
+	return true
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"rfid-backend/models"
+	"rfid-backend/pki"
+	"rfid-backend/services"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type CacheHandler struct {
+	dbService *services.DBService
+	signer    *pki.SnapshotSigner
+	log       *logrus.Logger
+}
+
+func NewCacheHandler(dbService *services.DBService, signer *pki.SnapshotSigner, logger *logrus.Logger) *CacheHandler {
+	return &CacheHandler{
+		dbService: dbService,
+		signer:    signer,
+		log:       logger,
+	}
+}
+
+// @Summary Cache signing key
+// @Description Returns the Ed25519 public key that signs door and machine cache snapshots,
+// @Description base64 encoded, for building into reader firmware.
+// @ID cache-signing-key
+// @Produce  json
+// @Success 200  {object}  map[string]string
+// @Router /api/cacheSigningKey [get]
+func (ch *CacheHandler) HandleSigningKey(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"algorithm":  "ed25519",
+		"key_id":     ch.signer.KeyID(),
+		"public_key": base64.StdEncoding.EncodeToString(ch.signer.PublicKey()),
+	})
+}
+
+// @Summary Door cache
+// @Description Returns the tags of members who may open the requesting door, for offline access.
+// @Description Disabled doors and doors in maintenance receive an empty cache. The "snapshot"
+// @Description field carries the same list signed with the key from /api/cacheSigningKey.
+// @Description "schedules" holds the time windows the door and individual tags are limited to.
+// @Description "space_mode" is normal, unlocked (hold the door open) or lockdown.
+// @ID door-cache
+// @Produce  json
+// @Success 200  {object}  map[string]interface{}
+// @Failure 401  {string}  string "Unauthorized"
+// @Failure 403  {string}  string "Device not approved"
+// @Failure 409  {string}  string "Device is not a door"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/doorCache [get]
+func (ch *CacheHandler) HandleDoorCache(c *gin.Context) {
+	ch.serveCache(c, models.DeviceTypeDoor)
+}
+
+// @Summary Machine cache
+// @Description Returns the tags of members who meet the requesting machine's training requirement.
+// @Description Disabled machines and machines in maintenance receive an empty cache. The "snapshot"
+// @Description field carries the same list signed with the key from /api/cacheSigningKey.
+// @Description "schedules" holds the time windows the machine and individual tags are limited to.
+// @Description "space_mode" is normal, unlocked or lockdown.
+// @ID machine-cache
+// @Produce  json
+// @Success 200  {object}  map[string]interface{}
+// @Failure 401  {string}  string "Unauthorized"
+// @Failure 403  {string}  string "Device not approved"
+// @Failure 409  {string}  string "Device is not a machine, or has no training assigned"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/machineCache [get]
+func (ch *CacheHandler) HandleMachineCache(c *gin.Context) {
+	ch.serveCache(c, models.DeviceTypeMachine)
+}
+
+// @Summary Cache delta
+// @Description Returns the changes to the requesting door or machine's cache since the sequence
+// @Description it last saw, as {"full": false, "sequence": N, "add": [...], "remove": [...]}.
+// @Description When the changes are no longer on record, or the device was reset, the whole
+// @Description cache is sent instead as {"full": true, "sequence": N, "tag_ids": [...], "snapshot": {...}}.
+// @Description Both carry the current "schedules" and "space_mode", as in the full caches.
+// @ID cache-delta
+// @Produce  json
+// @Param since query int true "Sequence of the reader's current cache"
+// @Success 200  {object}  map[string]interface{}
+// @Failure 400  {string}  string "Invalid sequence"
+// @Failure 401  {string}  string "Unauthorized"
+// @Failure 403  {string}  string "Device not approved"
+// @Failure 409  {string}  string "Device does not keep a cache, or has no training assigned"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/cacheDelta [get]
+func (ch *CacheHandler) HandleCacheDelta(c *gin.Context) {
+	device := currentDevice(c)
+	if !device.IsApproved() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Device not approved"})
+		return
+	}
+	if device.Type != models.DeviceTypeDoor && device.Type != models.DeviceTypeMachine {
+		c.JSON(http.StatusConflict, gin.H{"error": "Device does not keep a cache"})
+		return
+	}
+
+	since, err := strconv.ParseInt(c.Query("since"), 10, 64)
+	if err != nil || since < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sequence"})
+		return
+	}
+
+	delta, err := ch.dbService.GetCacheDelta(*device, since)
+	if err == services.ErrNoTrainingAssigned {
+		c.JSON(http.StatusConflict, gin.H{"error": "Device has no training assigned"})
+		return
+	}
+	if err != nil {
+		ch.log.Errorf("Failed to build cache delta for device %s since %d: %v", device.MACAddress, since, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build cache delta"})
+		return
+	}
+
+	schedules, err := ch.dbService.GetCacheSchedules(*device)
+	if err != nil {
+		ch.log.Errorf("Failed to get schedules for device %s: %v", device.MACAddress, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build cache delta"})
+		return
+	}
+	mode, err := ch.dbService.GetSpaceMode()
+	if err != nil {
+		ch.log.Errorf("Failed to get space mode: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build cache delta"})
+		return
+	}
+
+	if delta.Full {
+		snapshot, err := ch.signSnapshot(*device, delta.Sequence, delta.TagIds, schedules, mode.Mode)
+		if err != nil {
+			ch.log.Errorf("Failed to sign cache for device %s: %v", device.MACAddress, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build cache delta"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"full": true, "sequence": delta.Sequence, "tag_ids": delta.TagIds, "schedules": schedules,
+			"space_mode": mode.Mode, "snapshot": snapshot})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"full": false, "sequence": delta.Sequence, "add": delta.Add, "remove": delta.Remove, "schedules": schedules,
+		"space_mode": mode.Mode})
+}
+
+// serveCache sends the tags the requesting device should admit while offline,
+// with the sequence to pass to /api/cacheDelta afterwards and a signed copy
+// the reader can keep.
+func (ch *CacheHandler) serveCache(c *gin.Context, deviceType string) {
+	device := currentDevice(c)
+	if !device.IsApproved() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Device not approved"})
+		return
+	}
+	if device.Type != deviceType {
+		c.JSON(http.StatusConflict, gin.H{"error": "Device is not a " + deviceType})
+		return
+	}
+
+	// Read the sequence first so changes made while building the list are
+	// replayed by the next delta rather than lost
+	seq, err := ch.dbService.CurrentAccessSequence()
+	if err != nil {
+		ch.log.Errorf("Failed to get access sequence: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build " + deviceType + " cache"})
+		return
+	}
+
+	tagIds, err := ch.dbService.GetDeviceCacheTags(*device)
+	if err == services.ErrNoTrainingAssigned {
+		c.JSON(http.StatusConflict, gin.H{"error": "Device has no training assigned"})
+		return
+	}
+	if err != nil {
+		ch.log.Errorf("Failed to build %s cache for device %s: %v", deviceType, device.MACAddress, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build " + deviceType + " cache"})
+		return
+	}
+
+	schedules, err := ch.dbService.GetCacheSchedules(*device)
+	if err != nil {
+		ch.log.Errorf("Failed to get schedules for device %s: %v", device.MACAddress, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build " + deviceType + " cache"})
+		return
+	}
+	mode, err := ch.dbService.GetSpaceMode()
+	if err != nil {
+		ch.log.Errorf("Failed to get space mode: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build " + deviceType + " cache"})
+		return
+	}
+
+	snapshot, err := ch.signSnapshot(*device, seq, tagIds, schedules, mode.Mode)
+	if err != nil {
+		ch.log.Errorf("Failed to sign %s cache for device %s: %v", deviceType, device.MACAddress, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build " + deviceType + " cache"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tag_ids": tagIds, "sequence": seq, "schedules": schedules, "space_mode": mode.Mode, "snapshot": snapshot})
+}
+
+// signSnapshot signs a device's full cache. The access sequence doubles as
+// the snapshot version, so it only increases.
+func (ch *CacheHandler) signSnapshot(device models.Device, seq int64, tagIds []uint64, schedules models.CacheSchedules, spaceMode string) (pki.SignedSnapshot, error) {
+	return ch.signer.Sign(pki.CacheSnapshot{
+		MACAddress: device.MACAddress,
+		DeviceType: device.Type,
+		Version:    seq,
+		TagIds:     tagIds,
+		Schedules:  &schedules,
+		SpaceMode:  spaceMode,
+	}, time.Now())
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"net/http"
+	"rfid-backend/config"
+	"rfid-backend/models"
+	"rfid-backend/services"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// deviceContextKey holds the authenticated *models.Device for reader requests.
+const deviceContextKey = "device"
+
+// seenInterval throttles last_seen writes from busy readers.
+const seenInterval = time.Minute
+
+type DeviceAuth struct {
+	cfg       *config.Config
+	dbService *services.DBService
+	log       *logrus.Logger
+}
+
+func NewDeviceAuth(dbService *services.DBService, cfg *config.Config, logger *logrus.Logger) *DeviceAuth {
+	return &DeviceAuth{
+		cfg:       cfg,
+		dbService: dbService,
+		log:       logger,
+	}
+}
+
+// RequireDevice authenticates reader requests. On the mutual TLS listener the
+// device is identified by the MAC address in its verified client certificate.
+// Otherwise devices send HTTP Basic auth with their MAC address as the
+// username and their issued credential as the password.
+func (da *DeviceAuth) RequireDevice(c *gin.Context) {
+	if tls := c.Request.TLS; tls != nil && len(tls.VerifiedChains) > 0 {
+		da.requireCertificate(c, tls.VerifiedChains[0][0].Subject.CommonName)
+		return
+	}
+
+	if da.cfg.MTLSRequired {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Client certificate required"})
+		return
+	}
+
+	mac, secret, ok := c.Request.BasicAuth()
+	if !ok {
+		c.Header("WWW-Authenticate", `Basic realm="dingus-devices"`)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Device credentials required"})
+		return
+	}
+
+	device, err := da.dbService.VerifyDeviceCredential(mac, secret)
+	if err != nil {
+		da.log.Errorf("Failed to verify credential for device %s: %v", mac, err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify device"})
+		return
+	}
+
+	if device == nil {
+		da.log.Warnf("Rejected device request from %s claiming MAC %s", c.ClientIP(), mac)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid device credentials"})
+		return
+	}
+
+	da.authenticated(c, device)
+}
+
+func (da *DeviceAuth) requireCertificate(c *gin.Context, mac string) {
+	device, err := da.dbService.GetDevice(mac)
+	if err != nil {
+		da.log.Errorf("Failed to look up device %s: %v", mac, err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify device"})
+		return
+	}
+
+	if device == nil {
+		da.log.Warnf("Rejected certificate for unregistered device %s from %s", mac, c.ClientIP())
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Device is not registered"})
+		return
+	}
+
+	da.authenticated(c, device)
+}
+
+// authenticated records where a verified device was seen, following it
+// across DHCP lease changes, and passes the request on.
+func (da *DeviceAuth) authenticated(c *gin.Context, device *models.Device) {
+	if ip, err := remoteIP(c); err == nil {
+		if ip != device.IPAddress || time.Since(device.LastSeen) > seenInterval {
+			if err := da.dbService.RecordDeviceSeen(*device, ip); err != nil {
+				da.log.Errorf("Failed to record device %s as seen: %v", device.MACAddress, err)
+			}
+			device.IPAddress = ip
+		}
+	}
+
+	c.Set(deviceContextKey, device)
+	c.Next()
+}
+
+// currentDevice returns the device authenticated by RequireDevice.
+func currentDevice(c *gin.Context) *models.Device {
+	device, _ := c.MustGet(deviceContextKey).(*models.Device)
+	return device
+}
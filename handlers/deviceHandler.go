@@ -0,0 +1,550 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"rfid-backend/auth"
+	"rfid-backend/models"
+	"rfid-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type DeviceHandler struct {
+	dbService *services.DBService
+	log       *logrus.Logger
+}
+
+func NewDeviceHandler(dbService *services.DBService, logger *logrus.Logger) *DeviceHandler {
+	return &DeviceHandler{
+		dbService: dbService,
+		log:       logger,
+	}
+}
+
+// DeviceRequest carries the admin-editable fields of a device.
+type DeviceRequest struct {
+	MACAddress     string   `json:"macAddress"` // only read when creating a device
+	Name           string   `json:"name" binding:"required"`
+	Location       string   `json:"location"`
+	Type           string   `json:"type" binding:"required"` // door, machine or kiosk
+	Notes          string   `json:"notes"`
+	Enabled        *bool    `json:"enabled"` // defaults to true on create and approval, unchanged on update
+	TrainingLabels []string `json:"trainingLabels"`
+	TrainingMode   string   `json:"trainingMode"` // "all" (default) or "any"
+}
+
+// details takes enabled from the request, or from the given default when
+// the request leaves it out.
+func (r DeviceRequest) details(enabled bool) models.DeviceDetails {
+	if r.Enabled != nil {
+		enabled = *r.Enabled
+	}
+	return models.DeviceDetails{
+		Name:           r.Name,
+		Location:       r.Location,
+		Type:           r.Type,
+		Notes:          r.Notes,
+		Enabled:        enabled,
+		TrainingMode:   r.TrainingMode,
+		TrainingLabels: r.TrainingLabels,
+	}
+}
+
+// DeviceRecord is a device as returned by the devices API.
+type DeviceRecord struct {
+	models.Device
+	CredentialStatus string   `json:"credential_status"`
+	TrainingLabels   []string `json:"training_labels"`
+}
+
+// @Summary List devices
+// @Description Returns every registered device with its trainings.
+// @ID list-devices
+// @Produce  json
+// @Success 200  {array}   DeviceRecord
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/devices [get]
+func (dh *DeviceHandler) ListDevices(c *gin.Context) {
+	devices, err := dh.dbService.GetDevices()
+	if err != nil {
+		dh.log.Errorf("Failed to get devices: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get devices"})
+		return
+	}
+
+	records := []DeviceRecord{}
+	for _, device := range devices {
+		record, err := dh.record(device)
+		if err != nil {
+			dh.log.Errorf("Failed to get trainings for device %s: %v", device.MACAddress, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get devices"})
+			return
+		}
+		records = append(records, record)
+	}
+
+	c.JSON(http.StatusOK, records)
+}
+
+// @Summary Get device
+// @Description Returns a single device with its trainings.
+// @ID get-device
+// @Produce  json
+// @Param   mac  path    string  true  "Device MAC address"
+// @Success 200  {object}  DeviceRecord
+// @Failure 404  {string}  string "Device not found"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/devices/{mac} [get]
+func (dh *DeviceHandler) GetDevice(c *gin.Context) {
+	mac := c.Param("mac")
+
+	device, err := dh.dbService.GetDevice(mac)
+	if err != nil {
+		dh.log.Errorf("Failed to get device %s: %v", mac, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get device"})
+		return
+	}
+	if device == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+
+	record, err := dh.record(*device)
+	if err != nil {
+		dh.log.Errorf("Failed to get trainings for device %s: %v", mac, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get device"})
+		return
+	}
+
+	c.JSON(http.StatusOK, record)
+}
+
+// @Summary Create device
+// @Description Records a device before it first registers. It is approved like any other
+// @Description pending device once it registers from the network.
+// @ID create-device
+// @Accept  json
+// @Produce  json
+// @Param   device  body    DeviceRequest  true  "Device details"
+// @Success 201  {string}  string "Device created"
+// @Failure 400  {string}  string "Bad Request"
+// @Failure 409  {string}  string "Device already exists"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/devices [post]
+func (dh *DeviceHandler) CreateDevice(c *gin.Context) {
+	var req DeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.MACAddress == "" {
+		dh.log.Errorf("Failed to bind new device: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A MAC address, name and type are required"})
+		return
+	}
+
+	err := dh.dbService.CreateDevice(req.MACAddress, req.details(true))
+	if err == services.ErrDeviceExists {
+		c.JSON(http.StatusConflict, gin.H{"error": "Device already exists"})
+		return
+	}
+	if !dh.checkDetailsError(c, err, "Failed to create device") {
+		return
+	}
+
+	auditDevice(c, dh.dbService, dh.log, req.MACAddress, models.DeviceActionCreated, req.Name+" ("+req.Type+")")
+	c.JSON(http.StatusCreated, gin.H{"message": "Device created"})
+}
+
+// @Summary Update device
+// @Description Replaces a device's name, location, type, notes, enabled flag and trainings.
+// @Description An omitted enabled flag is left unchanged.
+// @ID update-device
+// @Accept  json
+// @Produce  json
+// @Param   mac     path    string         true  "Device MAC address"
+// @Param   device  body    DeviceRequest  true  "Device details"
+// @Success 200  {string}  string "Device updated"
+// @Failure 400  {string}  string "Bad Request"
+// @Failure 404  {string}  string "Device not found"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/devices/{mac} [put]
+func (dh *DeviceHandler) UpdateDevice(c *gin.Context) {
+	mac := c.Param("mac")
+
+	var req DeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		dh.log.Errorf("Failed to bind device update: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A name and type are required"})
+		return
+	}
+
+	device, err := dh.dbService.GetDevice(mac)
+	if err != nil {
+		dh.log.Errorf("Failed to get device %s: %v", mac, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update device"})
+		return
+	}
+	if device == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+
+	// Leaving enabled out keeps the device as it is rather than re-enabling it
+	details := req.details(device.Enabled)
+	err = dh.dbService.UpdateDevice(mac, details)
+	if err == services.ErrDeviceNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+	if !dh.checkDetailsError(c, err, "Failed to update device") {
+		return
+	}
+
+	auditDevice(c, dh.dbService, dh.log, mac, models.DeviceActionUpdated, describeDetails(details))
+	c.JSON(http.StatusOK, gin.H{"message": "Device updated"})
+}
+
+// @Summary Delete device
+// @Description Removes a device and its credential, along with its schedules, unlock window doors,
+// @Description device overrides and reservations. The reader must register again.
+// @ID delete-device
+// @Produce  json
+// @Param   mac  path    string  true  "Device MAC address"
+// @Success 200  {string}  string "Device deleted"
+// @Failure 404  {string}  string "Device not found"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/devices/{mac} [delete]
+func (dh *DeviceHandler) DeleteDevice(c *gin.Context) {
+	mac := c.Param("mac")
+
+	err := dh.dbService.DeleteDevice(mac)
+	if err == services.ErrDeviceNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+	if err != nil {
+		dh.log.Errorf("Failed to delete device %s: %v", mac, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete device"})
+		return
+	}
+
+	auditDevice(c, dh.dbService, dh.log, mac, models.DeviceActionDeleted, "")
+	c.JSON(http.StatusOK, gin.H{"message": "Device deleted"})
+}
+
+type MaintenanceRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// @Summary Decommission device
+// @Description Takes a device out of service permanently. Its credential is removed and
+// @Description registrations are refused, but the record and audit trail are kept.
+// @ID decommission-device
+// @Produce  json
+// @Param   mac  path    string  true  "Device MAC address"
+// @Success 200  {string}  string "Device decommissioned"
+// @Failure 404  {string}  string "Device not found"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/devices/{mac}/decommission [post]
+func (dh *DeviceHandler) DecommissionDevice(c *gin.Context) {
+	mac := c.Param("mac")
+
+	err := dh.dbService.DecommissionDevice(mac)
+	if err == services.ErrDeviceNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+	if err != nil {
+		dh.log.Errorf("Failed to decommission device %s: %v", mac, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decommission device"})
+		return
+	}
+
+	auditDevice(c, dh.dbService, dh.log, mac, models.DeviceActionDecommissioned, "")
+	c.JSON(http.StatusOK, gin.H{"message": "Device decommissioned"})
+}
+
+// @Summary Put device in maintenance
+// @Description Temporarily locks out a device. Every swipe is denied and its cache is emptied
+// @Description until it is restored.
+// @ID device-maintenance
+// @Accept  json
+// @Produce  json
+// @Param   mac          path    string              true  "Device MAC address"
+// @Param   maintenance  body    MaintenanceRequest  true  "Reason for the lockout"
+// @Success 200  {string}  string "Device in maintenance"
+// @Failure 400  {string}  string "Bad Request"
+// @Failure 404  {string}  string "Device not found"
+// @Failure 409  {string}  string "Device not approved"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/devices/{mac}/maintenance [post]
+func (dh *DeviceHandler) SetMaintenance(c *gin.Context) {
+	mac := c.Param("mac")
+
+	var req MaintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required"})
+		return
+	}
+
+	err := dh.dbService.SetDeviceMaintenance(mac, req.Reason)
+	if err == services.ErrDeviceNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+	if err == services.ErrDeviceNotApproved {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only approved devices can be put in maintenance"})
+		return
+	}
+	if err != nil {
+		dh.log.Errorf("Failed to put device %s in maintenance: %v", mac, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to put device in maintenance"})
+		return
+	}
+
+	auditDevice(c, dh.dbService, dh.log, mac, models.DeviceActionMaintenance, req.Reason)
+	c.JSON(http.StatusOK, gin.H{"message": "Device in maintenance"})
+}
+
+type TwoPersonRuleRequest struct {
+	Rule          string `json:"rule"`           // "", partner or keyholder
+	WindowSeconds int    `json:"window_seconds"` // how long a first swipe waits for a partner; default 60
+}
+
+// @Summary Set two-person rule
+// @Description Requires a second authorized tag within a time window ("partner"), or a keyholder in the
+// @Description space ("keyholder"), before a machine is granted. An empty rule removes the requirement.
+// @Description Machines under a rule get an empty offline cache.
+// @ID two-person-rule
+// @Accept  json
+// @Produce  json
+// @Param   mac   path    string                true  "Device MAC address"
+// @Param   rule  body    TwoPersonRuleRequest  true  "Rule"
+// @Success 200  {string}  string "Two-person rule set"
+// @Failure 400  {string}  string "Bad Request"
+// @Failure 404  {string}  string "Device not found"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/devices/{mac}/twoPersonRule [put]
+func (dh *DeviceHandler) SetTwoPersonRule(c *gin.Context) {
+	mac := c.Param("mac")
+
+	var req TwoPersonRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two-person rule"})
+		return
+	}
+	if req.WindowSeconds == 0 {
+		req.WindowSeconds = 60
+	}
+
+	err := dh.dbService.SetTwoPersonRule(mac, req.Rule, req.WindowSeconds)
+	if err == services.ErrDeviceNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+	if err == services.ErrInvalidTwoPersonRule {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		dh.log.Errorf("Failed to set two-person rule of device %s: %v", mac, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set two-person rule"})
+		return
+	}
+
+	detail := "two-person rule removed"
+	if req.Rule != models.TwoPersonNone {
+		detail = fmt.Sprintf("two-person rule %s (%ds window)", req.Rule, req.WindowSeconds)
+	}
+	auditDevice(c, dh.dbService, dh.log, mac, models.DeviceActionUpdated, detail)
+	c.JSON(http.StatusOK, gin.H{"message": "Two-person rule set"})
+}
+
+type ReservableRequest struct {
+	Reservable bool `json:"reservable"`
+}
+
+// @Summary Set reservable
+// @Description Makes a machine take reservations: while a booking is open only its member is granted,
+// @Description and anyone trained otherwise. Reservable machines get an empty offline cache.
+// @ID set-reservable
+// @Accept  json
+// @Produce  json
+// @Param   mac         path    string             true  "Device MAC address"
+// @Param   reservable  body    ReservableRequest  true  "Reservable"
+// @Success 200  {string}  string "Reservations updated"
+// @Failure 400  {string}  string "Bad Request"
+// @Failure 404  {string}  string "Device not found"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/devices/{mac}/reservable [put]
+func (dh *DeviceHandler) SetReservable(c *gin.Context) {
+	mac := c.Param("mac")
+
+	var req ReservableRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reservable setting"})
+		return
+	}
+
+	err := dh.dbService.SetReservable(mac, req.Reservable)
+	if err == services.ErrDeviceNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+	if err == services.ErrReservableNotMachine {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		dh.log.Errorf("Failed to set reservations of device %s: %v", mac, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update reservations"})
+		return
+	}
+
+	detail := "reservations disabled"
+	if req.Reservable {
+		detail = "reservations enabled"
+	}
+	auditDevice(c, dh.dbService, dh.log, mac, models.DeviceActionUpdated, detail)
+	c.JSON(http.StatusOK, gin.H{"message": "Reservations updated"})
+}
+
+type DoorDirectionRequest struct {
+	Direction string `json:"direction" binding:"required"` // entry or exit
+}
+
+// @Summary Set door direction
+// @Description Marks a door reader as an entry or exit reader. Swipes at exit readers count people
+// @Description as leaving the space for occupancy tracking.
+// @ID door-direction
+// @Accept  json
+// @Produce  json
+// @Param   mac        path    string                true  "Device MAC address"
+// @Param   direction  body    DoorDirectionRequest  true  "Direction"
+// @Success 200  {string}  string "Door direction set"
+// @Failure 400  {string}  string "Bad Request"
+// @Failure 404  {string}  string "Device not found"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/devices/{mac}/direction [put]
+func (dh *DeviceHandler) SetDoorDirection(c *gin.Context) {
+	mac := c.Param("mac")
+
+	var req DoorDirectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A direction is required"})
+		return
+	}
+
+	err := dh.dbService.SetDoorDirection(mac, req.Direction)
+	if err == services.ErrDeviceNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+	if err == services.ErrInvalidDoorDirection {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		dh.log.Errorf("Failed to set direction of device %s: %v", mac, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set door direction"})
+		return
+	}
+
+	auditDevice(c, dh.dbService, dh.log, mac, models.DeviceActionUpdated, "direction "+req.Direction)
+	c.JSON(http.StatusOK, gin.H{"message": "Door direction set"})
+}
+
+// @Summary Restore device
+// @Description Ends maintenance, or returns a decommissioned device to pending approval.
+// @ID restore-device
+// @Produce  json
+// @Param   mac  path    string  true  "Device MAC address"
+// @Success 200  {string}  string "Device restored"
+// @Failure 404  {string}  string "Device not found"
+// @Failure 409  {string}  string "Device is in service"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/devices/{mac}/restore [post]
+func (dh *DeviceHandler) RestoreDevice(c *gin.Context) {
+	mac := c.Param("mac")
+
+	restored, err := dh.dbService.RestoreDevice(mac)
+	if err == services.ErrDeviceNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+	if err == services.ErrNothingToRestore {
+		c.JSON(http.StatusConflict, gin.H{"error": "Device is already in service"})
+		return
+	}
+	if err != nil {
+		dh.log.Errorf("Failed to restore device %s: %v", mac, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore device"})
+		return
+	}
+
+	auditDevice(c, dh.dbService, dh.log, mac, models.DeviceActionRestored, restored)
+	c.JSON(http.StatusOK, gin.H{"message": "Device restored: " + restored})
+}
+
+// @Summary Device audit trail
+// @Description Returns the admin changes made to a device, newest first.
+// @ID device-audit
+// @Produce  json
+// @Param   mac  path    string  true  "Device MAC address"
+// @Success 200  {array}   models.DeviceAuditEntry
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/devices/{mac}/audit [get]
+func (dh *DeviceHandler) GetDeviceAudit(c *gin.Context) {
+	mac := c.Param("mac")
+
+	entries, err := dh.dbService.GetDeviceAudit(mac)
+	if err != nil {
+		dh.log.Errorf("Failed to get audit trail for device %s: %v", mac, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get audit trail"})
+		return
+	}
+	if entries == nil {
+		entries = []models.DeviceAuditEntry{}
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+func (dh *DeviceHandler) record(device models.Device) (DeviceRecord, error) {
+	labels, err := dh.dbService.GetDeviceTrainingLabels(device.MACAddress)
+	if labels == nil {
+		labels = []string{}
+	}
+	return DeviceRecord{Device: device, CredentialStatus: device.CredentialStatus(), TrainingLabels: labels}, err
+}
+
+// checkDetailsError writes the response for a failed create or update and
+// reports whether the request succeeded.
+func (dh *DeviceHandler) checkDetailsError(c *gin.Context, err error, message string) bool {
+	switch err {
+	case nil:
+		return true
+	case services.ErrInvalidDeviceType, services.ErrInvalidTrainingMode:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		dh.log.Errorf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+	return false
+}
+
+// auditDevice logs an admin change to a device and records it in the audit
+// trail. The change has already been made, so a failure to record it is
+// only logged.
+func auditDevice(c *gin.Context, dbService *services.DBService, log *logrus.Logger, mac, action, detail string) {
+	actor := auth.CurrentUser(c)
+	log.Infof("Device %s %s by %s %s", mac, action, actor, detail)
+
+	if err := dbService.RecordDeviceAudit(mac, action, detail, actor); err != nil {
+		log.Errorf("Failed to record %s of device %s in audit trail: %v", action, mac, err)
+	}
+}
+
+func describeDetails(d models.DeviceDetails) string {
+	return fmt.Sprintf("name=%q location=%q type=%s enabled=%t trainings=%s of %v",
+		d.Name, d.Location, d.Type, d.Enabled, d.TrainingMode, d.TrainingLabels)
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"net/http"
+	"rfid-backend/auth"
+	"rfid-backend/models"
+	"rfid-backend/services"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type DoorUnlockHandler struct {
+	dbService *services.DBService
+	log       *logrus.Logger
+}
+
+func NewDoorUnlockHandler(dbService *services.DBService, logger *logrus.Logger) *DoorUnlockHandler {
+	return &DoorUnlockHandler{
+		dbService: dbService,
+		log:       logger,
+	}
+}
+
+// UnlockWindowRequest describes a new window holding doors unlocked.
+type UnlockWindowRequest struct {
+	Name     string    `json:"name" binding:"required"`
+	StartsAt time.Time `json:"starts_at" binding:"required"` // RFC 3339
+	EndsAt   time.Time `json:"ends_at" binding:"required"`   // RFC 3339
+	Doors    []string  `json:"doors" binding:"required"`     // door MAC addresses
+}
+
+// @Summary Door state
+// @Description Door readers poll this to learn whether to hold their lock open, e.g. during open
+// @Description hours or an event. "until" is set when an unlock window holds the door open.
+// @ID door-state
+// @Produce  json
+// @Success 200  {object}  models.DoorState
+// @Failure 401  {string}  string "Unauthorized"
+// @Failure 409  {string}  string "Device is not a door"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/doorState [get]
+func (uh *DoorUnlockHandler) HandleDoorState(c *gin.Context) {
+	device := currentDevice(c)
+	if !device.IsDoor() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Device is not a door"})
+		return
+	}
+
+	state, err := uh.dbService.DoorStateAt(*device, time.Now())
+	if err != nil {
+		uh.log.Errorf("Failed to get door state for device %s: %v", device.MACAddress, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get door state"})
+		return
+	}
+
+	c.JSON(http.StatusOK, state)
+}
+
+// @Summary List unlock windows
+// @Description Returns every window holding doors unlocked, latest start first, including ended
+// @Description ones and those synced from Wild Apricot events.
+// @ID list-unlock-windows
+// @Produce  json
+// @Success 200  {array}   models.UnlockWindow
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/unlockWindows [get]
+func (uh *DoorUnlockHandler) ListUnlockWindows(c *gin.Context) {
+	windows, err := uh.dbService.GetUnlockWindows()
+	if err != nil {
+		uh.log.Errorf("Failed to get unlock windows: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get unlock windows"})
+		return
+	}
+
+	c.JSON(http.StatusOK, windows)
+}
+
+// @Summary Create unlock window
+// @Description Holds the given doors unlocked for a time window, e.g. an open house night.
+// @ID create-unlock-window
+// @Accept  json
+// @Produce  json
+// @Param   window  body    UnlockWindowRequest  true  "Unlock window"
+// @Success 201  {object}  map[string]int64
+// @Failure 400  {string}  string "Bad Request"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/unlockWindows [post]
+func (uh *DoorUnlockHandler) CreateUnlockWindow(c *gin.Context) {
+	var req UnlockWindowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		uh.log.Errorf("Failed to bind unlock window: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A name, start, end and doors are required"})
+		return
+	}
+
+	window := models.UnlockWindow{
+		Name:      req.Name,
+		StartsAt:  req.StartsAt,
+		EndsAt:    req.EndsAt,
+		Doors:     req.Doors,
+		CreatedBy: auth.CurrentUser(c),
+	}
+
+	id, err := uh.dbService.CreateUnlockWindow(window)
+	switch err {
+	case nil:
+	case services.ErrInvalidUnlockWindow, services.ErrUnlockDoorInvalid:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	default:
+		uh.log.Errorf("Failed to create unlock window: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create unlock window"})
+		return
+	}
+
+	uh.log.Infof("Unlock window %d created by %s: %q for %v from %s to %s",
+		id, window.CreatedBy, window.Name, window.Doors, window.StartsAt, window.EndsAt)
+	c.JSON(http.StatusCreated, gin.H{"id": id})
+}
+
+// @Summary Delete unlock window
+// @Description Removes an unlock window, locking its doors again if it is open. Windows synced
+// @Description from an event come back on the next sync while the event is public.
+// @ID delete-unlock-window
+// @Produce  json
+// @Param   id  path    int  true  "Unlock window id"
+// @Success 200  {string}  string "Unlock window deleted"
+// @Failure 400  {string}  string "Invalid unlock window id"
+// @Failure 404  {string}  string "Unlock window not found"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/unlockWindows/{id} [delete]
+func (uh *DoorUnlockHandler) DeleteUnlockWindow(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid unlock window id"})
+		return
+	}
+
+	err = uh.dbService.DeleteUnlockWindow(id)
+	if err == services.ErrUnlockWindowNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unlock window not found"})
+		return
+	}
+	if err != nil {
+		uh.log.Errorf("Failed to delete unlock window %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete unlock window"})
+		return
+	}
+
+	uh.log.Infof("Unlock window %d deleted by %s", id, auth.CurrentUser(c))
+	c.JSON(http.StatusOK, gin.H{"message": "Unlock window deleted"})
+}
+
+// doorUnlockRow is a door on the Door Unlocks page with its unlock schedule.
+type doorUnlockRow struct {
+	Device     models.Device
+	ScheduleID int64
+	State      models.DoorState
+}
+
+// ServeDoorUnlocksPage renders the doors with their unlock schedules and
+// state, and the unlock windows.
+func (uh *DoorUnlockHandler) ServeDoorUnlocksPage(c *gin.Context) {
+	windows, err := uh.dbService.GetUnlockWindows()
+	if err != nil {
+		uh.log.Errorf("Failed to get unlock windows: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get unlock windows"})
+		return
+	}
+	devices, err := uh.dbService.GetDevices()
+	if err != nil {
+		uh.log.Errorf("Failed to get devices: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get devices"})
+		return
+	}
+	schedules, err := uh.dbService.GetSchedules()
+	if err != nil {
+		uh.log.Errorf("Failed to get schedules: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get schedules"})
+		return
+	}
+	assignments, err := uh.dbService.GetScheduleAssignments()
+	if err != nil {
+		uh.log.Errorf("Failed to get schedule assignments: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get schedules"})
+		return
+	}
+	unlockSchedules := make(map[string]int64)
+	for _, assignment := range assignments {
+		if assignment.TargetType == models.ScheduleTargetUnlock {
+			unlockSchedules[assignment.Target] = assignment.ScheduleID
+		}
+	}
+
+	now := time.Now()
+	var doors []doorUnlockRow
+	for _, device := range devices {
+		if !device.IsDoor() || !device.IsApproved() {
+			continue
+		}
+		state, err := uh.dbService.DoorStateAt(device, now)
+		if err != nil {
+			uh.log.Errorf("Failed to get door state for device %s: %v", device.MACAddress, err)
+		}
+		doors = append(doors, doorUnlockRow{Device: device, ScheduleID: unlockSchedules[device.MACAddress], State: state})
+	}
+
+	c.HTML(http.StatusOK, "doorUnlocks.tmpl", gin.H{
+		"title":     "Door Unlocks",
+		"Doors":     doors,
+		"Schedules": schedules,
+		"Windows":   windows,
+		"Now":       now,
+		"csrfToken": auth.CSRFToken(c),
+	})
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"net/http"
+	"rfid-backend/auth"
+	"rfid-backend/models"
+	"rfid-backend/services"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type GuestPassHandler struct {
+	dbService *services.DBService
+	log       *logrus.Logger
+}
+
+func NewGuestPassHandler(dbService *services.DBService, logger *logrus.Logger) *GuestPassHandler {
+	return &GuestPassHandler{
+		dbService: dbService,
+		log:       logger,
+	}
+}
+
+// GuestPassRequest describes a new guest pass. Give the tag as TagId or as
+// Tag in any configured format. Leave Doors empty to open every door.
+type GuestPassRequest struct {
+	Name             string    `json:"name" binding:"required"`
+	TagId            uint64    `json:"tag_id"`
+	Tag              string    `json:"tag"` // e.g. 123:45678 or 04:A2:1B:3C
+	SponsorContactId int       `json:"sponsor_contact_id" binding:"required"`
+	StartsAt         time.Time `json:"starts_at" binding:"required"` // RFC 3339
+	EndsAt           time.Time `json:"ends_at" binding:"required"`   // RFC 3339
+	Doors            []string  `json:"doors"`                        // door MAC addresses
+}
+
+// @Summary List guest passes
+// @Description Returns every guest pass, latest start first, including revoked and ended ones.
+// @ID list-guest-passes
+// @Produce  json
+// @Success 200  {array}   models.GuestPass
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/guestPasses [get]
+func (gh *GuestPassHandler) ListGuestPasses(c *gin.Context) {
+	passes, err := gh.dbService.GetGuestPasses()
+	if err != nil {
+		gh.log.Errorf("Failed to get guest passes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get guest passes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, passes)
+}
+
+// @Summary Create guest pass
+// @Description Gives a non-member's tag door access for a limited time. The sponsor must be a current
+// @Description member. Guest passes are kept apart from Wild Apricot data and expire on their own.
+// @ID create-guest-pass
+// @Accept  json
+// @Produce  json
+// @Param   guestPass  body    GuestPassRequest  true  "Guest pass"
+// @Success 201  {object}  map[string]int64
+// @Failure 400  {string}  string "Bad Request"
+// @Failure 409  {string}  string "Tag already in use"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/guestPasses [post]
+func (gh *GuestPassHandler) CreateGuestPass(c *gin.Context) {
+	var req GuestPassRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		gh.log.Errorf("Failed to bind guest pass: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A name, tag, sponsor, start and end are required"})
+		return
+	}
+
+	tagId, err := requestTag(gh.dbService, req.TagId, req.Tag)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pass := models.GuestPass{
+		Name:             req.Name,
+		TagId:            tagId,
+		SponsorContactId: req.SponsorContactId,
+		StartsAt:         req.StartsAt,
+		EndsAt:           req.EndsAt,
+		Doors:            req.Doors,
+		CreatedBy:        auth.CurrentUser(c),
+	}
+
+	id, err := gh.dbService.CreateGuestPass(pass)
+	switch err {
+	case nil:
+	case services.ErrInvalidGuestPass, services.ErrSponsorNotMember, services.ErrGuestDoorInvalid:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case services.ErrGuestTagInUse:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	default:
+		gh.log.Errorf("Failed to create guest pass: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create guest pass"})
+		return
+	}
+
+	gh.log.Infof("Guest pass %d created by %s: %q tag=%d sponsor=%d from %s to %s",
+		id, pass.CreatedBy, pass.Name, pass.TagId, pass.SponsorContactId, pass.StartsAt, pass.EndsAt)
+	c.JSON(http.StatusCreated, gin.H{"id": id})
+}
+
+// @Summary Revoke guest pass
+// @Description Ends a guest pass early. Readers drop the tag from their caches.
+// @ID revoke-guest-pass
+// @Produce  json
+// @Param   id  path    int  true  "Guest pass id"
+// @Success 200  {string}  string "Guest pass revoked"
+// @Failure 400  {string}  string "Invalid guest pass id"
+// @Failure 404  {string}  string "Guest pass not found"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/guestPasses/{id} [delete]
+func (gh *GuestPassHandler) RevokeGuestPass(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid guest pass id"})
+		return
+	}
+
+	err = gh.dbService.RevokeGuestPass(id)
+	if err == services.ErrGuestPassNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Guest pass not found"})
+		return
+	}
+	if err != nil {
+		gh.log.Errorf("Failed to revoke guest pass %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke guest pass"})
+		return
+	}
+
+	gh.log.Infof("Guest pass %d revoked by %s", id, auth.CurrentUser(c))
+	c.JSON(http.StatusOK, gin.H{"message": "Guest pass revoked"})
+}
+
+// ServeGuestPassesPage renders the guest pass list and the form for
+// creating one.
+func (gh *GuestPassHandler) ServeGuestPassesPage(c *gin.Context) {
+	passes, err := gh.dbService.GetGuestPasses()
+	if err != nil {
+		gh.log.Errorf("Failed to get guest passes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get guest passes"})
+		return
+	}
+
+	devices, err := gh.dbService.GetDevices()
+	if err != nil {
+		gh.log.Errorf("Failed to get devices: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get devices"})
+		return
+	}
+	var doors []models.Device
+	for _, device := range devices {
+		if device.IsDoor() && device.IsApproved() {
+			doors = append(doors, device)
+		}
+	}
+
+	c.HTML(http.StatusOK, "guestPasses.tmpl", gin.H{
+		"title":       "Guest Passes",
+		"GuestPasses": passes,
+		"Doors":       doors,
+		"Now":         time.Now(),
+		"csrfToken":   auth.CSRFToken(c),
+	})
+}
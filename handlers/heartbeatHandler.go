@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"rfid-backend/models"
+	"rfid-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type HeartbeatHandler struct {
+	dbService *services.DBService
+	log       *logrus.Logger
+}
+
+func NewHeartbeatHandler(dbService *services.DBService, logger *logrus.Logger) *HeartbeatHandler {
+	return &HeartbeatHandler{
+		dbService: dbService,
+		log:       logger,
+	}
+}
+
+// @Summary Device heartbeat
+// @Description Readers report their firmware version, uptime, cache version and local
+// @Description counters about once a minute so offline readers can be detected.
+// @ID heartbeat
+// @Accept  json
+// @Produce  json
+// @Param   heartbeat  body    models.Heartbeat  true  "Reader status"
+// @Success 200  {string}  string "Heartbeat recorded"
+// @Failure 400  {string}  string "Bad Request"
+// @Failure 401  {string}  string "Unauthorized"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/heartbeat [post]
+func (hh *HeartbeatHandler) HandleHeartbeat(c *gin.Context) {
+	device := currentDevice(c)
+
+	var heartbeat models.Heartbeat
+	if err := c.ShouldBindJSON(&heartbeat); err != nil {
+		hh.log.Errorf("Failed to bind heartbeat from device %s: %v", device.MACAddress, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid heartbeat"})
+		return
+	}
+
+	if err := hh.dbService.RecordHeartbeat(device.MACAddress, heartbeat); err != nil {
+		hh.log.Errorf("Failed to record heartbeat from device %s: %v", device.MACAddress, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record heartbeat"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Heartbeat recorded"})
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"net/http"
+	"rfid-backend/services"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type MachineSessionHandler struct {
+	dbService *services.DBService
+	log       *logrus.Logger
+}
+
+func NewMachineSessionHandler(dbService *services.DBService, logger *logrus.Logger) *MachineSessionHandler {
+	return &MachineSessionHandler{
+		dbService: dbService,
+		log:       logger,
+	}
+}
+
+// SessionStartRequest is a machine controller reporting power-on.
+// Either TagId or Tag names the tag.
+type SessionStartRequest struct {
+	TagId uint64     `json:"tag_id"`
+	Tag   string     `json:"tag"` // the tag in any configured format, e.g. 123:45678
+	At    *time.Time `json:"at"`  // RFC 3339; omit for now, set when replaying buffered events
+}
+
+// SessionStopRequest is a machine controller reporting power-off.
+type SessionStopRequest struct {
+	At *time.Time `json:"at"` // RFC 3339; omit for now
+}
+
+// @Summary Start machine session
+// @Description Machine controllers report that the machine powered on for a tag.
+// @ID start-machine-session
+// @Accept  json
+// @Produce  json
+// @Param   session  body    SessionStartRequest  true  "Power-on"
+// @Success 201  {object}  map[string]int64
+// @Failure 400  {string}  string "Bad Request"
+// @Failure 401  {string}  string "Unauthorized"
+// @Failure 403  {string}  string "Tag not recognized"
+// @Failure 409  {string}  string "Device is not a machine or not in service"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/machineSessions/start [post]
+func (mh *MachineSessionHandler) HandleSessionStart(c *gin.Context) {
+	device := currentDevice(c)
+
+	var req SessionStartRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		mh.log.Errorf("Failed to bind session start from device %s: %v", device.MACAddress, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session start"})
+		return
+	}
+	tagId, err := requestTag(mh.dbService, req.TagId, req.Tag)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if tagId == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A tag_id or tag is required"})
+		return
+	}
+
+	id, err := mh.dbService.StartMachineSession(*device, tagId, eventTime(req.At))
+	switch err {
+	case nil:
+	case services.ErrNotMachine:
+		c.JSON(http.StatusConflict, gin.H{"error": "Device is not a machine"})
+		return
+	case services.ErrMachineUnavailable:
+		c.JSON(http.StatusConflict, gin.H{"error": "Machine is not in service"})
+		return
+	case services.ErrUnknownSessionTag:
+		c.JSON(http.StatusForbidden, gin.H{"error": "Tag is not a member's or guest's and was not granted at this machine"})
+		return
+	default:
+		mh.log.Errorf("Failed to start session on device %s: %v", device.MACAddress, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start session"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id})
+}
+
+// @Summary Stop machine session
+// @Description Machine controllers report that the machine powered off, ending its running session.
+// @ID stop-machine-session
+// @Accept  json
+// @Produce  json
+// @Param   session  body    SessionStopRequest  false  "Power-off"
+// @Success 200  {object}  models.MachineSession
+// @Failure 400  {string}  string "Bad Request"
+// @Failure 401  {string}  string "Unauthorized"
+// @Failure 404  {string}  string "No running session"
+// @Failure 409  {string}  string "Device is not a machine"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/machineSessions/stop [post]
+func (mh *MachineSessionHandler) HandleSessionStop(c *gin.Context) {
+	device := currentDevice(c)
+
+	var req SessionStopRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			mh.log.Errorf("Failed to bind session stop from device %s: %v", device.MACAddress, err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session stop"})
+			return
+		}
+	}
+
+	session, err := mh.dbService.StopMachineSession(*device, eventTime(req.At))
+	switch err {
+	case nil:
+	case services.ErrNotMachine:
+		c.JSON(http.StatusConflict, gin.H{"error": "Device is not a machine"})
+		return
+	case services.ErrNoOpenSession:
+		c.JSON(http.StatusNotFound, gin.H{"error": "No running session"})
+		return
+	default:
+		mh.log.Errorf("Failed to stop session on device %s: %v", device.MACAddress, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stop session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// @Summary List machine sessions
+// @Description Returns the latest machine sessions, running ones included.
+// @ID list-machine-sessions
+// @Produce  json
+// @Param   mac    query   string  false  "Only sessions of this device"
+// @Param   limit  query   int     false  "Number of sessions, at most 500"
+// @Success 200  {array}   models.MachineSession
+// @Failure 400  {string}  string "Bad Request"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/machineSessions [get]
+func (mh *MachineSessionHandler) ListSessions(c *gin.Context) {
+	limit := 0
+	if raw := c.Query("limit"); raw != "" {
+		var err error
+		if limit, err = strconv.Atoi(raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+	}
+
+	sessions, err := mh.dbService.GetMachineSessions(c.Query("mac"), limit)
+	if err != nil {
+		mh.log.Errorf("Failed to get machine sessions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get machine sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// @Summary Machine usage report
+// @Description Totals finished machine sessions per machine, per member and per machine and month,
+// @Description for maintenance scheduling and consumable billing. Defaults to the last year.
+// @ID machine-usage
+// @Produce  json
+// @Param   from  query   string  false  "Start, RFC 3339 or YYYY-MM-DD (UTC)"
+// @Param   to    query   string  false  "End, exclusive, RFC 3339 or YYYY-MM-DD (UTC)"
+// @Success 200  {object}  models.UsageReport
+// @Failure 400  {string}  string "Bad Request"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/machineUsage [get]
+func (mh *MachineSessionHandler) HandleUsageReport(c *gin.Context) {
+	to, err := reportTime(c.Query("to"), time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to"})
+		return
+	}
+	from, err := reportTime(c.Query("from"), to.AddDate(-1, 0, 0))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from"})
+		return
+	}
+
+	report, err := mh.dbService.GetUsageReport(from, to)
+	if err == services.ErrInvalidReport {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		mh.log.Errorf("Failed to build usage report: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build usage report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// eventTime is when a controller says an event happened, or now.
+func eventTime(at *time.Time) time.Time {
+	if at == nil || at.IsZero() {
+		return time.Now()
+	}
+	return *at
+}
+
+func reportTime(raw string, fallback time.Time) (time.Time, error) {
+	if raw == "" {
+		return fallback, nil
+	}
+	if t, err := time.Parse("2006-01-02", raw); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"net/http"
+	"rfid-backend/auth"
+	"rfid-backend/services"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type OccupancyHandler struct {
+	dbService *services.DBService
+	log       *logrus.Logger
+}
+
+func NewOccupancyHandler(dbService *services.DBService, logger *logrus.Logger) *OccupancyHandler {
+	return &OccupancyHandler{
+		dbService: dbService,
+		log:       logger,
+	}
+}
+
+// @Summary Current occupancy
+// @Description Returns who is believed to be in the space, from entry and exit door swipes.
+// @ID occupancy
+// @Produce  json
+// @Success 200  {array}   models.Occupant
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/occupancy [get]
+func (oh *OccupancyHandler) ListOccupants(c *gin.Context) {
+	occupants, err := oh.dbService.GetOccupants(time.Now())
+	if err != nil {
+		oh.log.Errorf("Failed to get occupants: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get occupancy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, occupants)
+}
+
+// @Summary Occupancy count
+// @Description Public count of people in the space, for an "open" badge on the website. Names are never shown.
+// @ID occupancy-count
+// @Produce  json
+// @Success 200  {object}  map[string]interface{}
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/occupancyCount [get]
+func (oh *OccupancyHandler) HandleOccupancyCount(c *gin.Context) {
+	occupants, err := oh.dbService.GetOccupants(time.Now())
+	if err != nil {
+		oh.log.Errorf("Failed to get occupants: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get occupancy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"count": len(occupants), "open": len(occupants) > 0})
+}
+
+// @Summary Access log
+// @Description Returns the latest tags checked through /api/authenticate, newest first.
+// @ID access-log
+// @Produce  json
+// @Param   mac    query   string  false  "Only swipes at this device"
+// @Param   limit  query   int     false  "Number of entries, at most 500"
+// @Success 200  {array}   models.AccessLogEntry
+// @Failure 400  {string}  string "Bad Request"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/accessLog [get]
+func (oh *OccupancyHandler) ListAccessLog(c *gin.Context) {
+	limit := 0
+	if raw := c.Query("limit"); raw != "" {
+		var err error
+		if limit, err = strconv.Atoi(raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+	}
+
+	entries, err := oh.dbService.GetAccessLog(c.Query("mac"), limit)
+	if err != nil {
+		oh.log.Errorf("Failed to get access log: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get access log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// @Summary Access anomalies
+// @Description Returns the latest suspicious swipes found by anti-passback and tag sharing checks, newest first.
+// @ID access-anomalies
+// @Produce  json
+// @Param   limit  query   int     false  "Number of anomalies, at most 500"
+// @Success 200  {array}   models.AccessAnomaly
+// @Failure 400  {string}  string "Bad Request"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/accessAnomalies [get]
+func (oh *OccupancyHandler) ListAnomalies(c *gin.Context) {
+	limit := 0
+	if raw := c.Query("limit"); raw != "" {
+		var err error
+		if limit, err = strconv.Atoi(raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+	}
+
+	anomalies, err := oh.dbService.GetAccessAnomalies(limit)
+	if err != nil {
+		oh.log.Errorf("Failed to get access anomalies: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get access anomalies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, anomalies)
+}
+
+// ServeOccupancyPage renders who is in the space.
+func (oh *OccupancyHandler) ServeOccupancyPage(c *gin.Context) {
+	occupants, err := oh.dbService.GetOccupants(time.Now())
+	if err != nil {
+		oh.log.Errorf("Failed to get occupants: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get occupancy"})
+		return
+	}
+
+	c.HTML(http.StatusOK, "occupancy.tmpl", gin.H{
+		"title":     "Who's In",
+		"Occupants": occupants,
+		"csrfToken": auth.CSRFToken(c),
+	})
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"rfid-backend/auth"
+	"rfid-backend/models"
+	"rfid-backend/services"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type OverrideHandler struct {
+	dbService *services.DBService
+	log       *logrus.Logger
+}
+
+func NewOverrideHandler(dbService *services.DBService, logger *logrus.Logger) *OverrideHandler {
+	return &OverrideHandler{
+		dbService: dbService,
+		log:       logger,
+	}
+}
+
+// OverrideRequest describes a new access override. Set exactly one of
+// TagId, Tag and ContactId.
+type OverrideRequest struct {
+	Effect     string     `json:"effect" binding:"required"` // allow or deny
+	TagId      uint64     `json:"tag_id"`
+	Tag        string     `json:"tag"` // the tag in any configured format, e.g. 123:45678
+	ContactId  int        `json:"contact_id"`
+	MACAddress string     `json:"mac_address"` // limits the override to one device
+	ExpiresAt  *time.Time `json:"expires_at"`  // RFC 3339; omit for no expiry
+	Reason     string     `json:"reason" binding:"required"`
+}
+
+// @Summary List access overrides
+// @Description Returns every local access override, newest first, including expired ones.
+// @ID list-overrides
+// @Produce  json
+// @Success 200  {array}   models.AccessOverride
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/overrides [get]
+func (oh *OverrideHandler) ListOverrides(c *gin.Context) {
+	overrides, err := oh.dbService.GetOverrides()
+	if err != nil {
+		oh.log.Errorf("Failed to get overrides: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get overrides"})
+		return
+	}
+
+	c.JSON(http.StatusOK, overrides)
+}
+
+// @Summary Create access override
+// @Description Allows or denies a tag, or a Wild Apricot contact's current tag, regardless of
+// @Description Wild Apricot data. Deny overrides win over allow overrides. Overrides survive syncs.
+// @ID create-override
+// @Accept  json
+// @Produce  json
+// @Param   override  body    OverrideRequest  true  "Override"
+// @Success 201  {object}  map[string]int64
+// @Failure 400  {string}  string "Bad Request"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/overrides [post]
+func (oh *OverrideHandler) CreateOverride(c *gin.Context) {
+	var req OverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		oh.log.Errorf("Failed to bind override: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An effect and reason are required"})
+		return
+	}
+
+	tagId, err := requestTag(oh.dbService, req.TagId, req.Tag)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	override := models.AccessOverride{
+		Effect:     req.Effect,
+		TagId:      tagId,
+		ContactId:  req.ContactId,
+		MACAddress: req.MACAddress,
+		Reason:     req.Reason,
+		CreatedBy:  auth.CurrentUser(c),
+	}
+	if req.ExpiresAt != nil {
+		override.ExpiresAt = *req.ExpiresAt
+	}
+
+	id, err := oh.dbService.CreateOverride(override)
+	if err == services.ErrInvalidOverride {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		oh.log.Errorf("Failed to create override: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create override"})
+		return
+	}
+
+	oh.log.Infof("Override %d created by %s: %s tag=%d contact=%d device=%q: %s",
+		id, override.CreatedBy, override.Effect, override.TagId, override.ContactId, override.MACAddress, override.Reason)
+	c.JSON(http.StatusCreated, gin.H{"id": id})
+}
+
+// @Summary Delete access override
+// @Description Removes an override, returning the tag to what Wild Apricot says.
+// @ID delete-override
+// @Produce  json
+// @Param   id  path    int  true  "Override id"
+// @Success 200  {string}  string "Override deleted"
+// @Failure 400  {string}  string "Invalid override id"
+// @Failure 404  {string}  string "Override not found"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/overrides/{id} [delete]
+func (oh *OverrideHandler) DeleteOverride(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid override id"})
+		return
+	}
+
+	err = oh.dbService.DeleteOverride(id)
+	if err == services.ErrOverrideNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Override not found"})
+		return
+	}
+	if err != nil {
+		oh.log.Errorf("Failed to delete override %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete override"})
+		return
+	}
+
+	oh.log.Infof("Override %d deleted by %s", id, auth.CurrentUser(c))
+	c.JSON(http.StatusOK, gin.H{"message": "Override deleted"})
+}
+
+// requestTag returns the tag an admin request names, either as the stored
+// number or written in one of the configured tag formats.
+func requestTag(dbService *services.DBService, tagId uint64, tag string) (uint64, error) {
+	if tag == "" {
+		return tagId, nil
+	}
+	parsed, err := dbService.NormalizeTag(tag)
+	if err != nil {
+		return 0, err
+	}
+	if tagId != 0 && tagId != parsed {
+		return 0, fmt.Errorf("tag_id %d and tag %q name different tags", tagId, tag)
+	}
+	return parsed, nil
+}
@@ -4,18 +4,47 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"rfid-backend/auth"
 	"rfid-backend/config"
+	"rfid-backend/models"
 	"rfid-backend/services"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
 
 type DeviceWithTraining struct {
-	IPAddress        string
-	MACAddress       string
-	SelectedTraining string
+	IPAddress         string
+	MACAddress        string
+	Name              string
+	Location          string
+	Type              string
+	Notes             string
+	Enabled           bool
+	InMaintenance     bool
+	MaintenanceReason string
+	Status            string
+	TrainingMode      string
+	TrainingOptions   []TrainingOption
+	CredentialStatus  string
+	FirstSeen         time.Time
+	LastSeen          time.Time
+	IPConflict        bool
+	RegisteredFrom    string // set when the last registration came from another address
+	Online            bool
+	FirmwareVersion   string
+	Uptime            string
+	CacheVersion      string
+	LastHeartbeat     time.Time
+	Stats             string
+}
+
+// TrainingOption is one entry of a device's training multi-select.
+type TrainingOption struct {
+	Label    string
+	Selected bool
 }
 
 type RegistrationHandler struct {
@@ -33,17 +62,22 @@ func NewRegistrationHandler(dbService *services.DBService, cfg *config.Config, l
 }
 
 // @Summary Register device
-// @Description Register a new device with its IP and name.
+// @Description Enrolls a reader by MAC address. New devices wait until an admin approves them,
+// @Description which shows the admin a one-time enrollment code. A registration carrying that
+// @Description code collects the device's credential.
 // @ID register-device
-// @Accept  json
+// @Accept  plain
 // @Produce  json
-// @Param   trainingLabel  query    string  true  "Device Name"
-// @Success 200  {string}  string "Device registered successfully"
+// @Param   macAddress       body    string  true   "Device MAC address"
+// @Param   X-Enrollment-Code  header  string  false  "One-time enrollment code shown at approval"
+// @Success 200  {string}  string "Device enrolled"
+// @Success 202  {string}  string "Awaiting admin approval"
 // @Failure 400  {string}  string "Bad Request"
+// @Failure 403  {string}  string "Invalid enrollment code"
 // @Failure 500  {string}  string "Internal Server Error"
-// @Router /api/registerDevice [post]
+// @Router /api/register [post]
 func (rh *RegistrationHandler) HandleRegisterDevice(c *gin.Context) {
-	ip, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	ip, err := remoteIP(c)
 	if err != nil {
 		rh.log.Errorf("Failed to get IP address: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get IP address"})
@@ -56,7 +90,7 @@ func (rh *RegistrationHandler) HandleRegisterDevice(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read MAC address from request body"})
 		return
 	}
-	macAddress := string(bodyBytes)
+	macAddress := strings.TrimSpace(string(bodyBytes))
 
 	if macAddress == "" {
 		rh.log.Errorf("MAC address is empty")
@@ -64,16 +98,212 @@ func (rh *RegistrationHandler) HandleRegisterDevice(c *gin.Context) {
 		return
 	}
 
-	rh.log.Infof("Registering device with IP %s and MAC %s", ip, macAddress)
+	device, err := rh.dbService.GetDevice(macAddress)
+	if err != nil {
+		rh.log.Errorf("Failed to look up device %s: %v", macAddress, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up device"})
+		return
+	}
+
+	if device == nil {
+		rh.log.Infof("Registering device with IP %s and MAC %s", ip, macAddress)
+
+		err = rh.dbService.InsertDevice(ip, macAddress, 0)
+		if err != nil {
+			rh.log.Errorf("Failed to insert device: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert device"})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{"status": "pending", "message": "Device registered, awaiting admin approval"})
+		return
+	}
+
+	// Registrations are unauthenticated, so they never move a device's IP;
+	// enrolled devices update it by authenticating, and enrolling ones once
+	// their code checks out. The sender is kept for the admin to compare.
+	if device.CredentialStatus() == "none" {
+		if err := rh.dbService.RecordRegistration(*device, ip); err != nil {
+			rh.log.Errorf("Failed to update device %s: %v", macAddress, err)
+		}
+	}
+
+	if device.Status == models.DeviceStatusRejected {
+		c.JSON(http.StatusForbidden, gin.H{"status": "rejected", "message": "Device registration was rejected"})
+		return
+	}
+	if device.Status == models.DeviceStatusDecommissioned {
+		c.JSON(http.StatusForbidden, gin.H{"status": "decommissioned", "message": "Device has been decommissioned"})
+		return
+	}
+
+	switch device.CredentialStatus() {
+	case "none":
+		c.JSON(http.StatusAccepted, gin.H{"status": "pending", "message": "Device awaiting admin approval"})
+	case "issued":
+		code := c.GetHeader("X-Enrollment-Code")
+		if code == "" {
+			c.JSON(http.StatusAccepted, gin.H{"status": "pending", "message": "Device approved, awaiting its enrollment code"})
+			return
+		}
+		secret, err := rh.dbService.EnrollDevice(*device, code)
+		if err == services.ErrInvalidEnrollmentCode {
+			rh.log.Warnf("Device %s presented a wrong enrollment code from %s", macAddress, ip)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid enrollment code"})
+			return
+		}
+		if err != nil {
+			rh.log.Errorf("Failed to enroll device %s: %v", macAddress, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enroll device"})
+			return
+		}
+		if secret == "" {
+			c.JSON(http.StatusOK, gin.H{"status": "enrolled"})
+			return
+		}
+		if err := rh.dbService.RecordDeviceSeen(*device, ip); err != nil {
+			rh.log.Errorf("Failed to update device %s: %v", macAddress, err)
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "enrolled", "secret": secret})
+	default:
+		c.JSON(http.StatusOK, gin.H{"status": "enrolled"})
+	}
+}
+
+// remoteIP is the address the request arrived from. Forwarding headers are
+// ignored since readers talk to the server directly.
+func remoteIP(c *gin.Context) (string, error) {
+	ip, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	return ip, err
+}
+
+// @Summary Issue device credential
+// @Description Revokes the device's credential and returns a one-time enrollment code for it. The
+// @Description device presents the code on /api/register to collect its new credential.
+// @ID issue-device-credential
+// @Produce  json
+// @Param   mac  path    string  true  "Device MAC address"
+// @Success 200  {string}  string "Credential issued"
+// @Failure 404  {string}  string "Device not found"
+// @Failure 409  {string}  string "Device not approved"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/devices/{mac}/credential [post]
+func (rh *RegistrationHandler) IssueDeviceCredential(c *gin.Context) {
+	mac := c.Param("mac")
 
-	err = rh.dbService.InsertDevice(ip, macAddress, 0)
+	code, err := rh.dbService.IssueDeviceCredential(mac)
+	if err == services.ErrDeviceNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+	if err == services.ErrDeviceNotApproved {
+		c.JSON(http.StatusConflict, gin.H{"error": "Device must be approved first"})
+		return
+	}
 	if err != nil {
-		rh.log.Errorf("Failed to insert device: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert device"})
+		rh.log.Errorf("Failed to issue credential for device %s: %v", mac, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue credential"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Device registered successfully"})
+	auditDevice(c, rh.dbService, rh.log, mac, models.DeviceActionCredentialIssued, "")
+	c.JSON(http.StatusOK, gin.H{"message": "Credential issued", "enrollment_code": code})
+}
+
+// @Summary Revoke device credential
+// @Description Revokes a device's credential and returns it to pending approval.
+// @ID revoke-device-credential
+// @Produce  json
+// @Param   mac  path    string  true  "Device MAC address"
+// @Success 200  {string}  string "Credential revoked"
+// @Failure 404  {string}  string "Device not found"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/devices/{mac}/credential [delete]
+func (rh *RegistrationHandler) RevokeDeviceCredential(c *gin.Context) {
+	mac := c.Param("mac")
+
+	err := rh.dbService.RevokeDeviceCredential(mac)
+	if err == services.ErrDeviceNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+	if err != nil {
+		rh.log.Errorf("Failed to revoke credential for device %s: %v", mac, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke credential"})
+		return
+	}
+
+	auditDevice(c, rh.dbService, rh.log, mac, models.DeviceActionCredentialRevoked, "")
+	c.JSON(http.StatusOK, gin.H{"message": "Credential revoked"})
+}
+
+// @Summary Approve device
+// @Description Approves a pending device, sets its name, location, type and trainings,
+// @Description and returns the one-time enrollment code the device collects its credential with.
+// @ID approve-device
+// @Accept  json
+// @Produce  json
+// @Param   mac  path    string  true  "Device MAC address"
+// @Param   approval  body    DeviceRequest  true  "Device details"
+// @Success 200  {string}  string "Device approved"
+// @Failure 400  {string}  string "Bad Request"
+// @Failure 404  {string}  string "Device not found"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/devices/{mac}/approve [post]
+func (rh *RegistrationHandler) ApproveDevice(c *gin.Context) {
+	mac := c.Param("mac")
+
+	var approval DeviceRequest
+	if err := c.ShouldBindJSON(&approval); err != nil {
+		rh.log.Errorf("Failed to bind device approval: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A device name and type are required"})
+		return
+	}
+
+	code, err := rh.dbService.ApproveDevice(mac, approval.details(true))
+	if err == services.ErrDeviceNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+	if err == services.ErrInvalidDeviceType || err == services.ErrInvalidTrainingMode {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		rh.log.Errorf("Failed to approve device %s: %v", mac, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve device"})
+		return
+	}
+
+	auditDevice(c, rh.dbService, rh.log, mac, models.DeviceActionApproved, approval.Name+" ("+approval.Type+")")
+	c.JSON(http.StatusOK, gin.H{"message": "Device approved", "enrollment_code": code})
+}
+
+// @Summary Reject device
+// @Description Rejects a device registration; further registrations from it are refused.
+// @ID reject-device
+// @Produce  json
+// @Param   mac  path    string  true  "Device MAC address"
+// @Success 200  {string}  string "Device rejected"
+// @Failure 404  {string}  string "Device not found"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/devices/{mac}/reject [post]
+func (rh *RegistrationHandler) RejectDevice(c *gin.Context) {
+	mac := c.Param("mac")
+
+	err := rh.dbService.RejectDevice(mac)
+	if err == services.ErrDeviceNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+	if err != nil {
+		rh.log.Errorf("Failed to reject device %s: %v", mac, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reject device"})
+		return
+	}
+
+	auditDevice(c, rh.dbService, rh.log, mac, models.DeviceActionRejected, "")
+	c.JSON(http.StatusOK, gin.H{"message": "Device rejected"})
 }
 
 // @Summary Serve Device Management Page
@@ -97,7 +327,6 @@ func (rh *RegistrationHandler) ServeDeviceManagementPage(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get trainings"})
 		return
 	}
-	trainings = append(trainings, "Door") // Manually append Door since it is not a device that requires training i.e. not on the DB
 
 	dtl, err := rh.dbService.GetDevicesTrainings()
 	if err != nil {
@@ -106,31 +335,93 @@ func (rh *RegistrationHandler) ServeDeviceManagementPage(c *gin.Context) {
 		return
 	}
 
-	macToTraining := make(map[string]string)
+	macToTrainings := make(map[string]map[string]bool)
 	for _, dt := range dtl {
-		macToTraining[dt.MACAddress] = dt.Label
+		if macToTrainings[dt.MACAddress] == nil {
+			macToTrainings[dt.MACAddress] = make(map[string]bool)
+		}
+		macToTrainings[dt.MACAddress][dt.Label] = true
 	}
 
-	var devicesWithLabels []DeviceWithTraining
+	conflicts, err := rh.dbService.GetIPConflicts()
+	if err != nil {
+		rh.log.Errorf("Failed to get IP conflicts: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get devices"})
+		return
+	}
+
+	auditLog, err := rh.dbService.GetRecentDeviceAudit(50)
+	if err != nil {
+		rh.log.Errorf("Failed to get device audit trail: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get devices"})
+		return
+	}
+
+	var devicesWithLabels, pendingDevices, decommissioned []DeviceWithTraining
 	for _, device := range devices {
-		selectedTraining := macToTraining[device.MACAddress]
-		devicesWithLabels = append(devicesWithLabels, DeviceWithTraining{
-			IPAddress:        device.IPAddress,
-			MACAddress:       device.MACAddress,
-			SelectedTraining: selectedTraining,
-		})
+		var options []TrainingOption
+		for _, training := range trainings {
+			options = append(options, TrainingOption{
+				Label:    training,
+				Selected: macToTrainings[device.MACAddress][training],
+			})
+		}
+		dwt := DeviceWithTraining{
+			IPAddress:         device.IPAddress,
+			MACAddress:        device.MACAddress,
+			Name:              device.Name,
+			Location:          device.Location,
+			Type:              device.Type,
+			Notes:             device.Notes,
+			Enabled:           device.Enabled,
+			InMaintenance:     device.InMaintenance,
+			MaintenanceReason: device.MaintenanceReason,
+			Status:            device.Status,
+			TrainingMode:      device.TrainingMode,
+			TrainingOptions:   options,
+			CredentialStatus:  device.CredentialStatus(),
+			FirstSeen:         device.FirstSeen,
+			LastSeen:          device.LastSeen,
+			IPConflict:        len(conflicts[device.IPAddress]) > 1,
+			Online:            device.Online,
+			FirmwareVersion:   device.FirmwareVersion,
+			CacheVersion:      device.CacheVersion,
+			LastHeartbeat:     device.LastHeartbeat,
+			Stats:             device.Stats,
+		}
+		if device.RegisteredFrom != "" && device.RegisteredFrom != device.IPAddress {
+			dwt.RegisteredFrom = device.RegisteredFrom
+		}
+		if !device.LastHeartbeat.IsZero() {
+			dwt.Uptime = (time.Duration(device.UptimeSeconds) * time.Second).String()
+		}
+		switch {
+		case device.IsApproved():
+			devicesWithLabels = append(devicesWithLabels, dwt)
+		case device.Status == models.DeviceStatusDecommissioned:
+			decommissioned = append(decommissioned, dwt)
+		default:
+			pendingDevices = append(pendingDevices, dwt)
+		}
 	}
 
 	c.HTML(http.StatusOK, "deviceManagement.tmpl", gin.H{
+		"PendingDevices":    pendingDevices,
+		"IPConflicts":       conflicts,
 		"DevicesWithLabels": devicesWithLabels,
+		"Decommissioned":    decommissioned,
+		"AuditLog":          auditLog,
 		"Trainings":         trainings,
+		"DeviceTypes":       []string{models.DeviceTypeDoor, models.DeviceTypeMachine, models.DeviceTypeKiosk},
+		"csrfToken":         auth.CSRFToken(c),
 	})
 }
 
 type DeviceAssignment struct {
-	IPAddress     string `json:"ipAddress"`
-	MACAddress    string `json:"macAddress"`
-	TrainingLabel string `json:"trainingLabel"`
+	IPAddress      string   `json:"ipAddress"`
+	MACAddress     string   `json:"macAddress"`
+	TrainingLabels []string `json:"trainingLabels"`
+	TrainingMode   string   `json:"trainingMode"` // "all" (default) or "any"
 }
 
 func (rh *RegistrationHandler) UpdateDeviceAssignments(c *gin.Context) {
@@ -147,26 +438,11 @@ func (rh *RegistrationHandler) UpdateDeviceAssignments(c *gin.Context) {
 	for _, assignment := range assignments {
 		rh.log.Infof("Processing assignment for device %s", assignment.MACAddress)
 
-		// Determine if a training label indicates a special condition (e.g., "door")
-		trainingRequired := strings.Contains(strings.ToLower(assignment.TrainingLabel), "door")
-
-		// Insert or update the device with its training label as needed
-		if trainingRequired {
-			err := rh.dbService.InsertDevice(assignment.IPAddress, assignment.MACAddress, 1)
-			if err != nil {
-				rh.log.Errorf("Failed to insert device assignment for %s: %v", assignment.MACAddress, err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update device assignments"})
-				return
-			}
-		} else {
-			err := rh.dbService.InsertDevice(assignment.IPAddress, assignment.MACAddress, 0)
-			if err != nil {
-				rh.log.Errorf("Failed to insert device assignment for %s: %v", assignment.MACAddress, err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update device assignments"})
-				return
-			}
+		err := rh.dbService.SetDeviceTrainings(assignment.MACAddress, assignment.TrainingMode, assignment.TrainingLabels)
+		if err == services.ErrInvalidTrainingMode {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
-		err := rh.dbService.InsertDeviceTrainingLink(assignment.MACAddress, assignment.TrainingLabel)
 		if err != nil {
 			rh.log.Errorf("Failed to process device assignment for %s: %v", assignment.MACAddress, err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update device assignments"})
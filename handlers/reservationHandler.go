@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"net/http"
+	"rfid-backend/auth"
+	"rfid-backend/models"
+	"rfid-backend/services"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// reservationCalendarDays is how far ahead the calendar lists bookings by
+// default.
+const reservationCalendarDays = 14
+
+type ReservationHandler struct {
+	dbService *services.DBService
+	log       *logrus.Logger
+}
+
+func NewReservationHandler(dbService *services.DBService, logger *logrus.Logger) *ReservationHandler {
+	return &ReservationHandler{
+		dbService: dbService,
+		log:       logger,
+	}
+}
+
+// ReservationRequest books a machine. Members book for themselves; admins
+// may book for another member by contact id.
+type ReservationRequest struct {
+	MACAddress string    `json:"mac_address" binding:"required"`
+	StartsAt   time.Time `json:"starts_at" binding:"required"` // RFC 3339
+	EndsAt     time.Time `json:"ends_at" binding:"required"`   // RFC 3339
+	Note       string    `json:"note"`
+	ContactId  int       `json:"contact_id"` // admins only; defaults to the caller
+}
+
+// @Summary List reservations
+// @Description Returns the machine bookings overlapping a time range, earliest first. Cancelled
+// @Description bookings are left out.
+// @ID list-reservations
+// @Produce  json
+// @Param mac  query string false "Only this machine's bookings"
+// @Param from query string false "RFC 3339 start of the range (default now)"
+// @Param to   query string false "RFC 3339 end of the range (default two weeks after from)"
+// @Success 200  {array}   models.Reservation
+// @Failure 400  {string}  string "Bad Request"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/reservations [get]
+func (rh *ReservationHandler) ListReservations(c *gin.Context) {
+	from, to, ok := reservationRange(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from and to must be RFC 3339 times, from before to"})
+		return
+	}
+
+	reservations, err := rh.dbService.GetReservations(c.Query("mac"), from, to)
+	if err != nil {
+		rh.log.Errorf("Failed to get reservations: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get reservations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, reservations)
+}
+
+// @Summary Reserve a machine
+// @Description Books a reservable machine. While the booking is open the machine only grants the
+// @Description member holding it. The member must hold the machine's trainings, and bookings are
+// @Description limited in length, how far ahead they start and total upcoming time per member.
+// @ID create-reservation
+// @Accept  json
+// @Produce  json
+// @Param   reservation  body    ReservationRequest  true  "Reservation"
+// @Success 201  {object}  map[string]int64
+// @Failure 400  {string}  string "Bad Request"
+// @Failure 403  {string}  string "Only admins can book for another member"
+// @Failure 409  {string}  string "Machine already reserved"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/reservations [post]
+func (rh *ReservationHandler) CreateReservation(c *gin.Context) {
+	var req ReservationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		rh.log.Errorf("Failed to bind reservation: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A machine, start and end are required"})
+		return
+	}
+
+	user := auth.CurrentUser(c)
+	contactId, _ := strconv.Atoi(user)
+	if req.ContactId != 0 && req.ContactId != contactId {
+		if !auth.IsAdmin(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can book for another member"})
+			return
+		}
+		contactId = req.ContactId
+	}
+	if contactId == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A contact_id is required when booking with the API key"})
+		return
+	}
+
+	reservation := models.Reservation{
+		MACAddress: req.MACAddress,
+		ContactId:  contactId,
+		StartsAt:   req.StartsAt,
+		EndsAt:     req.EndsAt,
+		Note:       req.Note,
+		CreatedBy:  user,
+	}
+
+	id, err := rh.dbService.CreateReservation(reservation, time.Now())
+	switch err {
+	case nil:
+	case services.ErrReservationConflict:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case services.ErrInvalidReservation, services.ErrNotReservable, services.ErrReservationNotEligible,
+		services.ErrReservationTooLong, services.ErrReservationTooFar, services.ErrReservationLimit:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	default:
+		rh.log.Errorf("Failed to create reservation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reservation"})
+		return
+	}
+
+	rh.log.Infof("Reservation %d created by %s: machine %s for contact %d from %s to %s",
+		id, user, reservation.MACAddress, reservation.ContactId, reservation.StartsAt, reservation.EndsAt)
+	c.JSON(http.StatusCreated, gin.H{"id": id})
+}
+
+// @Summary Cancel reservation
+// @Description Frees a booked machine. A booking that has started is ended now instead. Members can
+// @Description only cancel their own bookings.
+// @ID cancel-reservation
+// @Produce  json
+// @Param   id  path    int  true  "Reservation id"
+// @Success 200  {string}  string "Reservation cancelled"
+// @Failure 400  {string}  string "Invalid reservation id"
+// @Failure 403  {string}  string "Not your reservation"
+// @Failure 404  {string}  string "Reservation not found"
+// @Failure 409  {string}  string "Reservation already ended"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/reservations/{id} [delete]
+func (rh *ReservationHandler) CancelReservation(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reservation id"})
+		return
+	}
+
+	reservation, err := rh.dbService.GetReservation(id)
+	if err != nil {
+		rh.log.Errorf("Failed to get reservation %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel reservation"})
+		return
+	}
+	if reservation == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reservation not found"})
+		return
+	}
+	user := auth.CurrentUser(c)
+	if strconv.Itoa(reservation.ContactId) != user && !auth.IsAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not your reservation"})
+		return
+	}
+
+	err = rh.dbService.CancelReservation(id, user, time.Now())
+	switch err {
+	case nil:
+	case services.ErrReservationNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reservation not found"})
+		return
+	case services.ErrReservationEnded:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	default:
+		rh.log.Errorf("Failed to cancel reservation %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel reservation"})
+		return
+	}
+
+	rh.log.Infof("Reservation %d cancelled by %s", id, user)
+	c.JSON(http.StatusOK, gin.H{"message": "Reservation cancelled"})
+}
+
+// machineCalendar is a reservable machine on the Reservations page with its
+// upcoming bookings.
+type machineCalendar struct {
+	Device       models.Device
+	Reservations []models.Reservation
+}
+
+// ServeReservationsPage renders a calendar of upcoming bookings for each
+// reservable machine, with a form to book one.
+func (rh *ReservationHandler) ServeReservationsPage(c *gin.Context) {
+	devices, err := rh.dbService.GetDevices()
+	if err != nil {
+		rh.log.Errorf("Failed to get devices: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get devices"})
+		return
+	}
+	now := time.Now()
+	reservations, err := rh.dbService.GetReservations("", now, now.AddDate(0, 0, reservationCalendarDays))
+	if err != nil {
+		rh.log.Errorf("Failed to get reservations: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get reservations"})
+		return
+	}
+	byMachine := make(map[string][]models.Reservation)
+	for _, r := range reservations {
+		byMachine[r.MACAddress] = append(byMachine[r.MACAddress], r)
+	}
+
+	var machines []machineCalendar
+	for _, device := range devices {
+		if device.Reservable && device.IsApproved() {
+			machines = append(machines, machineCalendar{Device: device, Reservations: byMachine[device.MACAddress]})
+		}
+	}
+
+	userID, isAdmin := auth.SessionUser(c)
+	c.HTML(http.StatusOK, "reservations.tmpl", gin.H{
+		"title":     "Reservations",
+		"Machines":  machines,
+		"UserID":    userID,
+		"IsAdmin":   isAdmin,
+		"Now":       now,
+		"csrfToken": auth.CSRFToken(c),
+	})
+}
+
+// reservationRange reads the from and to query parameters, defaulting to
+// the next two weeks.
+func reservationRange(c *gin.Context) (from, to time.Time, ok bool) {
+	from = time.Now()
+	if value := c.Query("from"); value != "" {
+		var err error
+		if from, err = time.Parse(time.RFC3339, value); err != nil {
+			return from, to, false
+		}
+	}
+	to = from.AddDate(0, 0, reservationCalendarDays)
+	if value := c.Query("to"); value != "" {
+		var err error
+		if to, err = time.Parse(time.RFC3339, value); err != nil {
+			return from, to, false
+		}
+	}
+	return from, to, to.After(from)
+}
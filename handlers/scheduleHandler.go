@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"rfid-backend/models"
+	"rfid-backend/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type ScheduleHandler struct {
+	dbService *services.DBService
+	log       *logrus.Logger
+}
+
+func NewScheduleHandler(dbService *services.DBService, logger *logrus.Logger) *ScheduleHandler {
+	return &ScheduleHandler{
+		dbService: dbService,
+		log:       logger,
+	}
+}
+
+// ScheduleRequest carries a schedule's name, zone, windows and holidays.
+type ScheduleRequest struct {
+	Name     string                  `json:"name" binding:"required"`
+	Timezone string                  `json:"timezone"` // IANA zone; empty for the server's
+	Windows  []models.ScheduleWindow `json:"windows"`
+	Holidays []models.Holiday        `json:"holidays"`
+}
+
+// AssignmentRequest attaches a schedule, or with schedule_id 0 detaches it.
+type AssignmentRequest struct {
+	TargetType string `json:"target_type" binding:"required"` // level, member, device or unlock
+	Target     string `json:"target" binding:"required"`      // level id, contact id or MAC address
+	ScheduleID int64  `json:"schedule_id"`
+}
+
+// @Summary List schedules
+// @Description Returns every access schedule with its windows and holidays.
+// @ID list-schedules
+// @Produce  json
+// @Success 200  {array}   models.Schedule
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/schedules [get]
+func (sh *ScheduleHandler) ListSchedules(c *gin.Context) {
+	schedules, err := sh.dbService.GetSchedules()
+	if err != nil {
+		sh.log.Errorf("Failed to get schedules: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get schedules"})
+		return
+	}
+	if schedules == nil {
+		schedules = []models.Schedule{}
+	}
+
+	c.JSON(http.StatusOK, schedules)
+}
+
+// @Summary Get schedule
+// @Description Returns a single access schedule.
+// @ID get-schedule
+// @Produce  json
+// @Param   id  path    int  true  "Schedule id"
+// @Success 200  {object}  models.Schedule
+// @Failure 404  {string}  string "Schedule not found"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/schedules/{id} [get]
+func (sh *ScheduleHandler) GetSchedule(c *gin.Context) {
+	id, ok := scheduleId(c)
+	if !ok {
+		return
+	}
+
+	schedule, err := sh.dbService.GetSchedule(id)
+	if err != nil {
+		sh.log.Errorf("Failed to get schedule %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get schedule"})
+		return
+	}
+	if schedule == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+// @Summary Create schedule
+// @Description Creates an access schedule. Windows are {"weekday": 0-6 (Sunday first),
+// @Description "start": "HH:MM", "end": "HH:MM"}; holidays are {"date": "YYYY-MM-DD", "name": "..."}.
+// @ID create-schedule
+// @Accept  json
+// @Produce  json
+// @Param   schedule  body    ScheduleRequest  true  "Schedule"
+// @Success 201  {object}  map[string]int64
+// @Failure 400  {string}  string "Bad Request"
+// @Failure 409  {string}  string "Schedule already exists"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/schedules [post]
+func (sh *ScheduleHandler) CreateSchedule(c *gin.Context) {
+	var req ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sh.log.Errorf("Failed to bind new schedule: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A name is required"})
+		return
+	}
+
+	id, err := sh.dbService.CreateSchedule(req.schedule(0))
+	if !sh.checkScheduleError(c, err, "Failed to create schedule") {
+		return
+	}
+
+	sh.log.Infof("Schedule %q created", req.Name)
+	c.JSON(http.StatusCreated, gin.H{"id": id})
+}
+
+// @Summary Update schedule
+// @Description Replaces a schedule's name, timezone, windows and holidays.
+// @ID update-schedule
+// @Accept  json
+// @Produce  json
+// @Param   id        path    int              true  "Schedule id"
+// @Param   schedule  body    ScheduleRequest  true  "Schedule"
+// @Success 200  {string}  string "Schedule updated"
+// @Failure 400  {string}  string "Bad Request"
+// @Failure 404  {string}  string "Schedule not found"
+// @Failure 409  {string}  string "Schedule already exists"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/schedules/{id} [put]
+func (sh *ScheduleHandler) UpdateSchedule(c *gin.Context) {
+	id, ok := scheduleId(c)
+	if !ok {
+		return
+	}
+
+	var req ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sh.log.Errorf("Failed to bind schedule update: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A name is required"})
+		return
+	}
+
+	err := sh.dbService.UpdateSchedule(req.schedule(id))
+	if !sh.checkScheduleError(c, err, "Failed to update schedule") {
+		return
+	}
+
+	sh.log.Infof("Schedule %d updated", id)
+	c.JSON(http.StatusOK, gin.H{"message": "Schedule updated"})
+}
+
+// @Summary Delete schedule
+// @Description Deletes a schedule. Whatever it was attached to is no longer time restricted.
+// @ID delete-schedule
+// @Produce  json
+// @Param   id  path    int  true  "Schedule id"
+// @Success 200  {string}  string "Schedule deleted"
+// @Failure 404  {string}  string "Schedule not found"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/schedules/{id} [delete]
+func (sh *ScheduleHandler) DeleteSchedule(c *gin.Context) {
+	id, ok := scheduleId(c)
+	if !ok {
+		return
+	}
+
+	err := sh.dbService.DeleteSchedule(id)
+	if !sh.checkScheduleError(c, err, "Failed to delete schedule") {
+		return
+	}
+
+	sh.log.Infof("Schedule %d deleted", id)
+	c.JSON(http.StatusOK, gin.H{"message": "Schedule deleted"})
+}
+
+// @Summary List schedule assignments
+// @Description Returns which schedule is attached to each membership level, member and device.
+// @ID list-schedule-assignments
+// @Produce  json
+// @Success 200  {array}   models.ScheduleAssignment
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/scheduleAssignments [get]
+func (sh *ScheduleHandler) ListAssignments(c *gin.Context) {
+	assignments, err := sh.dbService.GetScheduleAssignments()
+	if err != nil {
+		sh.log.Errorf("Failed to get schedule assignments: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get schedule assignments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, assignments)
+}
+
+// @Summary Assign schedule
+// @Description Attaches a schedule to a membership level (by level id), a member (by contact id)
+// @Description or a device (by MAC address), replacing any it had. A schedule_id of 0 detaches it.
+// @Description A member's own schedule takes precedence over their level's. The "unlock" target type
+// @Description makes the schedule a door's unlock schedule: the door stays unlocked while it is open.
+// @ID assign-schedule
+// @Accept  json
+// @Produce  json
+// @Param   assignment  body    AssignmentRequest  true  "Assignment"
+// @Success 200  {string}  string "Schedule assigned"
+// @Failure 400  {string}  string "Bad Request"
+// @Failure 404  {string}  string "Schedule not found"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/scheduleAssignments [put]
+func (sh *ScheduleHandler) AssignSchedule(c *gin.Context) {
+	var req AssignmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sh.log.Errorf("Failed to bind schedule assignment: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A target type and target are required"})
+		return
+	}
+
+	err := sh.dbService.AssignSchedule(req.TargetType, req.Target, req.ScheduleID)
+	if !sh.checkScheduleError(c, err, "Failed to assign schedule") {
+		return
+	}
+
+	switch req.TargetType {
+	case models.ScheduleTargetDevice:
+		auditDevice(c, sh.dbService, sh.log, req.Target, models.DeviceActionScheduled, fmt.Sprintf("schedule=%d", req.ScheduleID))
+	case models.ScheduleTargetUnlock:
+		auditDevice(c, sh.dbService, sh.log, req.Target, models.DeviceActionScheduled, fmt.Sprintf("unlock_schedule=%d", req.ScheduleID))
+	default:
+		sh.log.Infof("Schedule %d assigned to %s %s", req.ScheduleID, req.TargetType, req.Target)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Schedule assigned"})
+}
+
+// @Summary List membership levels
+// @Description Returns the Wild Apricot membership levels seen during sync, for attaching schedules.
+// @ID list-membership-levels
+// @Produce  json
+// @Success 200  {array}   models.Level
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/membershipLevels [get]
+func (sh *ScheduleHandler) ListMembershipLevels(c *gin.Context) {
+	levels, err := sh.dbService.GetMembershipLevels()
+	if err != nil {
+		sh.log.Errorf("Failed to get membership levels: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get membership levels"})
+		return
+	}
+
+	c.JSON(http.StatusOK, levels)
+}
+
+func (r ScheduleRequest) schedule(id int64) models.Schedule {
+	return models.Schedule{
+		ID:       id,
+		Name:     r.Name,
+		Timezone: r.Timezone,
+		Windows:  r.Windows,
+		Holidays: r.Holidays,
+	}
+}
+
+// scheduleId parses the :id path parameter, answering 400 if it is not a number.
+func scheduleId(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule id"})
+		return 0, false
+	}
+	return id, true
+}
+
+// checkScheduleError answers a failed schedule change and reports whether
+// err was nil.
+func (sh *ScheduleHandler) checkScheduleError(c *gin.Context, err error, message string) bool {
+	switch err {
+	case nil:
+		return true
+	case services.ErrScheduleNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+	case services.ErrScheduleExists:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case services.ErrInvalidSchedule, services.ErrInvalidTimezone, services.ErrInvalidScheduleTarget:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		sh.log.Errorf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"rfid-backend/auth"
+	"rfid-backend/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type SpaceModeHandler struct {
+	dbService *services.DBService
+	notifier  *services.Notifier
+	log       *logrus.Logger
+}
+
+func NewSpaceModeHandler(dbService *services.DBService, notifier *services.Notifier, logger *logrus.Logger) *SpaceModeHandler {
+	return &SpaceModeHandler{
+		dbService: dbService,
+		notifier:  notifier,
+		log:       logger,
+	}
+}
+
+// SpaceModeRequest switches the whole space to a mode.
+type SpaceModeRequest struct {
+	Mode   string `json:"mode" binding:"required"` // normal, unlocked or lockdown
+	Reason string `json:"reason"`
+}
+
+// @Summary Space mode
+// @Description Returns the space-wide mode in effect: normal, unlocked (every door opens for anyone)
+// @Description or lockdown (only members with the lockdown training pass), with who set it.
+// @ID get-space-mode
+// @Produce  json
+// @Success 200  {object}  models.SpaceMode
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/spaceMode [get]
+func (sh *SpaceModeHandler) GetSpaceMode(c *gin.Context) {
+	mode, err := sh.dbService.GetSpaceMode()
+	if err != nil {
+		sh.log.Errorf("Failed to get space mode: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get space mode"})
+		return
+	}
+
+	c.JSON(http.StatusOK, mode)
+}
+
+// @Summary Set space mode
+// @Description Switches every reader to normal, unlocked or lockdown mode, e.g. unlocked for an
+// @Description event or a fire alarm. Readers are reset so their caches follow the new mode, and
+// @Description admins are alerted.
+// @ID set-space-mode
+// @Accept  json
+// @Produce  json
+// @Param   mode  body    SpaceModeRequest  true  "Mode"
+// @Success 200  {object}  models.SpaceMode
+// @Failure 400  {string}  string "Bad Request"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/spaceMode [put]
+func (sh *SpaceModeHandler) SetSpaceMode(c *gin.Context) {
+	var req SpaceModeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sh.log.Errorf("Failed to bind space mode: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A mode is required"})
+		return
+	}
+
+	change, err := sh.dbService.SetSpaceMode(req.Mode, req.Reason, auth.CurrentUser(c))
+	if err == services.ErrInvalidSpaceMode {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		sh.log.Errorf("Failed to set space mode: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set space mode"})
+		return
+	}
+
+	message := fmt.Sprintf("%s set the space to %s", change.ChangedBy, change.Mode)
+	if change.Reason != "" {
+		message += ": " + change.Reason
+	}
+	sh.notifier.Notify("Space mode changed", message)
+	c.JSON(http.StatusOK, change)
+}
+
+// @Summary Space mode history
+// @Description Returns the latest space mode changes with who made them, newest first.
+// @ID space-mode-history
+// @Produce  json
+// @Param limit query int false "Most changes to return (default and max 100)"
+// @Success 200  {array}   models.SpaceMode
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/spaceMode/history [get]
+func (sh *SpaceModeHandler) ListSpaceModeChanges(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	changes, err := sh.dbService.GetSpaceModeChanges(limit)
+	if err != nil {
+		sh.log.Errorf("Failed to get space mode changes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get space mode history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, changes)
+}
+
+// ServeSpaceModePage renders the space mode switch and its history.
+func (sh *SpaceModeHandler) ServeSpaceModePage(c *gin.Context) {
+	changes, err := sh.dbService.GetSpaceModeChanges(20)
+	if err != nil {
+		sh.log.Errorf("Failed to get space mode changes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get space mode"})
+		return
+	}
+	mode, err := sh.dbService.GetSpaceMode()
+	if err != nil {
+		sh.log.Errorf("Failed to get space mode: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get space mode"})
+		return
+	}
+
+	c.HTML(http.StatusOK, "spaceMode.tmpl", gin.H{
+		"title":     "Space Mode",
+		"Mode":      mode,
+		"Changes":   changes,
+		"csrfToken": auth.CSRFToken(c),
+	})
+}
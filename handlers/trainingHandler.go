@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"net/http"
+	"rfid-backend/auth"
+	"rfid-backend/models"
+	"rfid-backend/services"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultDueDays is how far ahead trainings are listed as due for
+// recertification unless asked otherwise.
+const defaultDueDays = 30
+
+type TrainingHandler struct {
+	dbService *services.DBService
+	log       *logrus.Logger
+}
+
+func NewTrainingHandler(dbService *services.DBService, logger *logrus.Logger) *TrainingHandler {
+	return &TrainingHandler{
+		dbService: dbService,
+		log:       logger,
+	}
+}
+
+// TrainingValidityRequest sets how long a training stays valid once granted.
+type TrainingValidityRequest struct {
+	ValidityDays int `json:"validity_days"` // 0 never lapses
+}
+
+// TrainingRelationsRequest sets how a training builds on others.
+type TrainingRelationsRequest struct {
+	Requires []string `json:"requires"` // trainings that must be held for it to count
+	Implies  []string `json:"implies"`  // trainings it counts as
+}
+
+// RecertifyRequest renews a member's training.
+type RecertifyRequest struct {
+	ContactId int `json:"contact_id" binding:"required"`
+}
+
+// @Summary List trainings
+// @Description Returns every training label with the days a grant stays valid (0 never lapses) and
+// @Description the trainings it requires and implies.
+// @ID list-trainings
+// @Produce  json
+// @Success 200  {array}   models.Training
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/trainings [get]
+func (th *TrainingHandler) ListTrainings(c *gin.Context) {
+	trainings, err := th.dbService.GetTrainings()
+	if err != nil {
+		th.log.Errorf("Failed to get trainings: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get trainings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, trainings)
+}
+
+// @Summary Set training validity
+// @Description Sets how many days a grant of the training stays valid, e.g. 365 for an annual
+// @Description refresher, or 0 so it never lapses. Grants are expired or restored to match at once.
+// @ID set-training-validity
+// @Accept  json
+// @Produce  json
+// @Param   label     path    string                   true  "Training label"
+// @Param   validity  body    TrainingValidityRequest  true  "Validity"
+// @Success 200  {string}  string "Training validity set"
+// @Failure 400  {string}  string "Bad Request"
+// @Failure 404  {string}  string "Training not found"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/trainings/{label} [put]
+func (th *TrainingHandler) SetTrainingValidity(c *gin.Context) {
+	label := c.Param("label")
+
+	var req TrainingValidityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid training validity"})
+		return
+	}
+
+	err := th.dbService.SetTrainingValidity(label, req.ValidityDays, time.Now())
+	switch err {
+	case nil:
+	case services.ErrTrainingNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Training not found"})
+		return
+	case services.ErrInvalidTrainingValidity:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	default:
+		th.log.Errorf("Failed to set validity of training %s: %v", label, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set training validity"})
+		return
+	}
+
+	th.log.Infof("Training %s validity set to %d days by %s", label, req.ValidityDays, auth.CurrentUser(c))
+	c.JSON(http.StatusOK, gin.H{"message": "Training validity set"})
+}
+
+// @Summary Set training prerequisites
+// @Description Replaces the trainings a training requires and implies. A training only counts for
+// @Description access once its prerequisites are held, and holding it counts as holding the trainings
+// @Description it implies. Readers pick up the resulting access changes at once.
+// @ID set-training-relations
+// @Accept  json
+// @Produce  json
+// @Param   label      path    string                    true  "Training label"
+// @Param   relations  body    TrainingRelationsRequest  true  "Relations"
+// @Success 200  {string}  string "Training prerequisites set"
+// @Failure 400  {string}  string "Bad Request"
+// @Failure 404  {string}  string "Training not found"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/trainings/{label}/relations [put]
+func (th *TrainingHandler) SetTrainingRelations(c *gin.Context) {
+	label := c.Param("label")
+
+	var req TrainingRelationsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid training relations"})
+		return
+	}
+
+	err := th.dbService.SetTrainingRelations(label, req.Requires, req.Implies)
+	switch err {
+	case nil:
+	case services.ErrTrainingNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Training not found"})
+		return
+	case services.ErrInvalidTrainingRelations, services.ErrUnknownRelatedTraining, services.ErrTrainingCycle:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	default:
+		th.log.Errorf("Failed to set relations of training %s: %v", label, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set training prerequisites"})
+		return
+	}
+
+	th.log.Infof("Training %s set to require %v and imply %v by %s", label, req.Requires, req.Implies, auth.CurrentUser(c))
+	c.JSON(http.StatusOK, gin.H{"message": "Training prerequisites set"})
+}
+
+// @Summary Member training progress
+// @Description Returns the member's status with every training: held, implied by another training,
+// @Description blocked on prerequisites, expired, available to train, or locked behind prerequisites,
+// @Description with the prerequisites still missing.
+// @ID training-progress
+// @Produce  json
+// @Param contact_id query int true "Member's contact id"
+// @Success 200  {array}   models.TrainingProgress
+// @Failure 400  {string}  string "Bad Request"
+// @Failure 404  {string}  string "Member not found"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/trainings/progress [get]
+func (th *TrainingHandler) GetTrainingProgress(c *gin.Context) {
+	contactId, err := strconv.Atoi(c.Query("contact_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A contact_id is required"})
+		return
+	}
+
+	progress, err := th.dbService.GetTrainingProgress(contactId)
+	if err == services.ErrMemberNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	}
+	if err != nil {
+		th.log.Errorf("Failed to get training progress of member %d: %v", contactId, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get training progress"})
+		return
+	}
+
+	c.JSON(http.StatusOK, progress)
+}
+
+// @Summary Trainings waiting on prerequisites
+// @Description Returns the trainings members were granted that do not count yet because they lack
+// @Description prerequisites.
+// @ID prerequisite-gaps
+// @Produce  json
+// @Success 200  {array}   models.PrerequisiteGap
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/trainings/gaps [get]
+func (th *TrainingHandler) ListPrerequisiteGaps(c *gin.Context) {
+	gaps, err := th.dbService.GetPrerequisiteGaps()
+	if err != nil {
+		th.log.Errorf("Failed to get prerequisite gaps: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get prerequisite gaps"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gaps)
+}
+
+// @Summary Trainings due for recertification
+// @Description Returns members' trainings that have expired or expire within the given number of
+// @Description days, soonest first.
+// @ID trainings-due
+// @Produce  json
+// @Param days query int false "Days ahead to look (default 30)"
+// @Success 200  {array}   models.MemberTraining
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/trainings/due [get]
+func (th *TrainingHandler) ListTrainingsDue(c *gin.Context) {
+	days, err := strconv.Atoi(c.Query("days"))
+	if err != nil || days < 0 {
+		days = defaultDueDays
+	}
+
+	due, err := th.dbService.GetTrainingsDue(time.Now(), time.Duration(days)*24*time.Hour)
+	if err != nil {
+		th.log.Errorf("Failed to get trainings due: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get trainings due"})
+		return
+	}
+
+	c.JSON(http.StatusOK, due)
+}
+
+// @Summary Recertify member
+// @Description Renews a member's training from today, restoring it if it had expired. Readers pick
+// @Description the change up like any training change.
+// @ID recertify-training
+// @Accept  json
+// @Produce  json
+// @Param   label      path    string            true  "Training label"
+// @Param   recertify  body    RecertifyRequest  true  "Member"
+// @Success 200  {string}  string "Training renewed"
+// @Failure 400  {string}  string "Bad Request"
+// @Failure 404  {string}  string "Member does not hold that training"
+// @Failure 500  {string}  string "Internal Server Error"
+// @Router /api/trainings/{label}/recertify [post]
+func (th *TrainingHandler) Recertify(c *gin.Context) {
+	label := c.Param("label")
+
+	var req RecertifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A contact_id is required"})
+		return
+	}
+
+	err := th.dbService.Recertify(req.ContactId, label, time.Now())
+	if err == services.ErrMemberTrainingNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		th.log.Errorf("Failed to recertify member %d for %s: %v", req.ContactId, label, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to renew training"})
+		return
+	}
+
+	th.log.Infof("Member %d recertified for %s by %s", req.ContactId, label, auth.CurrentUser(c))
+	c.JSON(http.StatusOK, gin.H{"message": "Training renewed"})
+}
+
+// trainingRow is a training on the Trainings page with its prerequisite
+// and implied multi-selects, the trainings leading up to it, foundations
+// first, and those that require it.
+type trainingRow struct {
+	models.Training
+	RequireOptions []TrainingOption
+	ImplyOptions   []TrainingOption
+	Path           []string
+	RequiredBy     []string
+}
+
+// ServeTrainingsPage renders the trainings with their validity periods and
+// prerequisites, the members due for recertification and those waiting on
+// prerequisites.
+func (th *TrainingHandler) ServeTrainingsPage(c *gin.Context) {
+	trainings, err := th.dbService.GetTrainings()
+	if err != nil {
+		th.log.Errorf("Failed to get trainings: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get trainings"})
+		return
+	}
+	now := time.Now()
+	due, err := th.dbService.GetTrainingsDue(now, defaultDueDays*24*time.Hour)
+	if err != nil {
+		th.log.Errorf("Failed to get trainings due: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get trainings due"})
+		return
+	}
+	gaps, err := th.dbService.GetPrerequisiteGaps()
+	if err != nil {
+		th.log.Errorf("Failed to get prerequisite gaps: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get prerequisite gaps"})
+		return
+	}
+	graph, err := th.dbService.GetTrainingGraph()
+	if err != nil {
+		th.log.Errorf("Failed to get training graph: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get trainings"})
+		return
+	}
+
+	requiredBy := make(map[string][]string)
+	for _, t := range trainings {
+		for _, prerequisite := range t.Requires {
+			requiredBy[prerequisite] = append(requiredBy[prerequisite], t.Label)
+		}
+	}
+	rows := make([]trainingRow, 0, len(trainings))
+	for _, t := range trainings {
+		row := trainingRow{
+			Training:   t,
+			Path:       append(graph.Missing(t.Label, nil), t.Label),
+			RequiredBy: requiredBy[t.Label],
+		}
+		for _, other := range trainings {
+			if other.Label == t.Label {
+				continue
+			}
+			row.RequireOptions = append(row.RequireOptions, TrainingOption{Label: other.Label, Selected: slices.Contains(t.Requires, other.Label)})
+			row.ImplyOptions = append(row.ImplyOptions, TrainingOption{Label: other.Label, Selected: slices.Contains(t.Implies, other.Label)})
+		}
+		rows = append(rows, row)
+	}
+
+	c.HTML(http.StatusOK, "trainings.tmpl", gin.H{
+		"title":     "Trainings",
+		"Trainings": rows,
+		"Due":       due,
+		"Gaps":      gaps,
+		"DueDays":   defaultDueDays,
+		"csrfToken": auth.CSRFToken(c),
+	})
+}
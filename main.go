@@ -21,12 +21,20 @@ Main Functionality:
 - Creates a DBService instance for handling database operations.
 - Initializes a CacheHandler with the DBService and configuration settings to handle HTTP requests.
 - Registers HTTP endpoints `/api/machineCache` and `/api/doorCache` for fetching RFID data
-  related to machines and door access.
+  related to machines and door access. Readers authenticate with the per-device credential
+  an admin issues from the Device Management page.
 - Starts a background routine that periodically fetches contact data from the Wild Apricot
   API and updates the local SQLite database. This ensures the database is regularly
   synchronized with the latest data from Wild Apricot.
 - Launches an HTTPS server on port 443 to listen for incoming requests, using the SSL
   certificate and key specified in the `config.yml`.
+- Starts a device monitor that marks readers offline when their heartbeats stop and
+  raises alerts on online/offline transitions.
+- Retires expired access overrides and starts and ends guest passes so readers pick them up.
+- Lapses trainings past their validity period and alerts admins to recertifications due.
+- Optionally holds doors unlocked during upcoming public Wild Apricot events.
+- Optionally launches a second HTTPS listener on `mtls_listen_addr` that requires reader
+  client certificates issued by the local CA (see cmd/dingus-ca).
 
 Usage:
 - Before running, ensure that the `config.yml` is properly set up with the necessary configuration, including database path, Wild Apricot account ID, SSL certificate, and key file locations.
@@ -63,7 +71,7 @@ const hackPghBanner = `
 +------------------------------------------------------------------+
 | DINGUS for HackPGH                                  |
 | - Configure via 'config.yml' or '/' endpoint                     |
-| - Serves '/api/doorCache' & '/api/machineCache?machineName= '    |
+| - Serves '/api/doorCache' & '/api/machineCache' to readers      |
 | - Ensure SSL certificates are in place for HTTPS.                |
 | Want to contribute? https://github.com/hackpgh/rfid-backend      |
 +------------------------------------------------------------------+
@@ -82,13 +90,24 @@ func main() {
 	defer db.Close()
 
 	router := gin.Default()
-
-	setup.SetupRoutes(router, cfg, db, logger)
+	notifier := services.NewNotifier(cfg, logger)
 
 	waService := services.NewWildApricotService(cfg, logger)
+	// Routes and background tasks share one DBService, and with it the
+	// access events readers subscribe to
 	dbService := services.NewDBService(db, cfg, logger)
 
+	setup.SetupRoutes(router, cfg, dbService, waService, notifier, logger)
+
 	setup.StartBackgroundDatabaseUpdate(waService, dbService, logger)
+	setup.StartDeviceMonitor(dbService, notifier, cfg, logger)
+	setup.StartAccessExpiry(dbService, logger)
+	setup.StartTrainingExpiry(dbService, notifier, logger)
+	setup.StartEventSync(waService, dbService, cfg, logger)
+
+	if err := setup.StartMTLSListener(router, cfg, logger); err != nil {
+		logger.Fatalf("Failed to set up mutual TLS listener: %v", err)
+	}
 
 	err = router.RunTLS(":443", cfg.CertFile, cfg.KeyFile)
 	if err != nil {
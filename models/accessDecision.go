@@ -0,0 +1,30 @@
+// accessDecision.go
+
+package models
+
+// AccessDecision is the outcome of a tag swipe at a device. Reason explains
+// a denial for the logs and is empty when access is granted. PartnerTagId
+// is the second person who satisfied a two-person rule, if any.
+// DoorUnlocked marks a grant at a door held unlocked, which lets anyone in.
+type AccessDecision struct {
+	Granted      bool
+	Reason       string
+	PartnerTagId uint64
+	DoorUnlocked bool
+}
+
+func Grant() AccessDecision {
+	return AccessDecision{Granted: true}
+}
+
+func GrantWithPartner(partnerTagId uint64) AccessDecision {
+	return AccessDecision{Granted: true, PartnerTagId: partnerTagId}
+}
+
+func GrantUnlocked() AccessDecision {
+	return AccessDecision{Granted: true, DoorUnlocked: true}
+}
+
+func Deny(reason string) AccessDecision {
+	return AccessDecision{Reason: reason}
+}
@@ -0,0 +1,38 @@
+// accessOverride.go
+
+package models
+
+import "time"
+
+// Override effects. Deny overrides win over everything, including allow
+// overrides for the same tag.
+const (
+	OverrideAllow = "allow"
+	OverrideDeny  = "deny"
+)
+
+// AccessOverride is a local exception to what Wild Apricot says, e.g. a ban
+// after an incident or temporary access for a contractor. It names either a
+// tag or a Wild Apricot contact, whose current tag it then follows.
+type AccessOverride struct {
+	ID         int64     `json:"id"`
+	Effect     string    `json:"effect"`
+	TagId      uint64    `json:"tag_id,omitempty"`
+	ContactId  int       `json:"contact_id,omitempty"`
+	MACAddress string    `json:"mac_address"` // device scope; empty for every device
+	ExpiresAt  time.Time `json:"expires_at"`  // zero if the override does not expire
+	Expired    bool      `json:"expired"`
+	Reason     string    `json:"reason"`
+	CreatedBy  string    `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ActiveAt reports whether the override is in force at t.
+func (o AccessOverride) ActiveAt(t time.Time) bool {
+	return !o.Expired && (o.ExpiresAt.IsZero() || t.Before(o.ExpiresAt))
+}
+
+// AppliesTo reports whether the override covers device mac.
+func (o AccessOverride) AppliesTo(mac string) bool {
+	return o.MACAddress == "" || o.MACAddress == mac
+}
@@ -2,8 +2,123 @@
 
 package models
 
+import "time"
+
+// Device registration states. Readers register as pending and only become
+// usable once an admin approves them. Decommissioned devices are kept on
+// record for the audit trail but refused like rejected ones.
+const (
+	DeviceStatusPending        = "pending"
+	DeviceStatusApproved       = "approved"
+	DeviceStatusRejected       = "rejected"
+	DeviceStatusDecommissioned = "decommissioned"
+)
+
+// Device types. Doors admit any member who meets their (usually empty)
+// training requirement and download the door cache; machines require at
+// least one training and download the machine cache; kiosks only check tags
+// online.
+const (
+	DeviceTypeDoor    = "door"
+	DeviceTypeMachine = "machine"
+	DeviceTypeKiosk   = "kiosk"
+)
+
+// Door directions. People swiping at an exit reader are counted as leaving
+// the space; every other door swipe counts as entering it.
+const (
+	DoorDirectionEntry = "entry"
+	DoorDirectionExit  = "exit"
+)
+
+// Two-person rules for hazardous machines. Under TwoPersonPartner a second
+// authorized tag must be swiped at the machine within its partner window;
+// under TwoPersonKeyholder a keyholder must be in the space.
+const (
+	TwoPersonNone      = ""
+	TwoPersonPartner   = "partner"
+	TwoPersonKeyholder = "keyholder"
+)
+
 type Device struct {
-	IPAddress        string
-	MACAddress       string
-	RequiresTraining int
+	IPAddress            string    `json:"ip_address"`
+	MACAddress           string    `json:"mac_address"`
+	RequiresTraining     int       `json:"-"`
+	SecretHash           string    `json:"-"` // SHA-256 of the device credential, empty when none is issued
+	EnrollmentHash       string    `json:"-"` // SHA-256 of the one-time code the device presents to collect its credential
+	Status               string    `json:"status"`
+	Name                 string    `json:"name"`
+	Location             string    `json:"location"`
+	Type                 string    `json:"type"`
+	Notes                string    `json:"notes"`
+	Enabled              bool      `json:"enabled"`
+	InMaintenance        bool      `json:"in_maintenance"` // denies every swipe until restored
+	MaintenanceReason    string    `json:"maintenance_reason"`
+	TrainingMode         string    `json:"training_mode"`   // TrainingModeAll or TrainingModeAny
+	DoorDirection        string    `json:"door_direction"`  // DoorDirectionEntry or DoorDirectionExit
+	TwoPersonRule        string    `json:"two_person_rule"` // TwoPersonNone, TwoPersonPartner or TwoPersonKeyholder
+	PartnerWindowSeconds int       `json:"partner_window_seconds"`
+	Reservable           bool      `json:"reservable"` // machines only grant the holder of an open reservation
+	FirstSeen            time.Time `json:"first_seen"`
+	LastSeen             time.Time `json:"last_seen"` // zero if the device has not been heard from since registering
+	FirmwareVersion      string    `json:"firmware_version"`
+	UptimeSeconds        int64     `json:"uptime_seconds"`
+	CacheVersion         string    `json:"cache_version"`
+	Stats                string    `json:"stats"` // JSON object of reader-defined counters from the last heartbeat
+	LastHeartbeat        time.Time `json:"last_heartbeat"`
+	Online               bool      `json:"online"`
+	RegisteredFrom       string    `json:"registered_from"` // address of the last unauthenticated registration
+}
+
+// DeviceDetails are the admin-editable properties of a device.
+type DeviceDetails struct {
+	Name           string
+	Location       string
+	Type           string
+	Notes          string
+	Enabled        bool
+	TrainingMode   string
+	TrainingLabels []string
+}
+
+// Heartbeat is the periodic status report a reader posts to /api/heartbeat.
+type Heartbeat struct {
+	FirmwareVersion string                 `json:"firmware_version"`
+	UptimeSeconds   int64                  `json:"uptime_seconds"`
+	CacheVersion    string                 `json:"cache_version"`
+	Stats           map[string]interface{} `json:"stats"`
+}
+
+// CredentialStatus summarizes where the device is in enrollment.
+func (d Device) CredentialStatus() string {
+	switch {
+	case d.EnrollmentHash != "":
+		return "issued"
+	case d.SecretHash == "":
+		return "none"
+	default:
+		return "active"
+	}
+}
+
+func (d Device) IsApproved() bool {
+	return d.Status == DeviceStatusApproved
+}
+
+func (d Device) IsDoor() bool {
+	return d.Type == DeviceTypeDoor
+}
+
+// OnlineOnly reports whether the device has rules a reader cannot check
+// offline, a two-person rule or reservations, so its cache is kept empty.
+func (d Device) OnlineOnly() bool {
+	return d.TwoPersonRule != TwoPersonNone || d.Reservable
+}
+
+func ValidDeviceType(deviceType string) bool {
+	switch deviceType {
+	case DeviceTypeDoor, DeviceTypeMachine, DeviceTypeKiosk:
+		return true
+	}
+	return false
 }
@@ -0,0 +1,29 @@
+// deviceAudit.go
+
+package models
+
+import "time"
+
+// Actions recorded in the device audit trail.
+const (
+	DeviceActionCreated           = "created"
+	DeviceActionUpdated           = "updated"
+	DeviceActionDeleted           = "deleted"
+	DeviceActionApproved          = "approved"
+	DeviceActionRejected          = "rejected"
+	DeviceActionCredentialIssued  = "credential_issued"
+	DeviceActionCredentialRevoked = "credential_revoked"
+	DeviceActionDecommissioned    = "decommissioned"
+	DeviceActionMaintenance       = "maintenance"
+	DeviceActionRestored          = "restored"
+	DeviceActionScheduled         = "scheduled"
+)
+
+type DeviceAuditEntry struct {
+	ID         int64     `json:"id"`
+	MACAddress string    `json:"mac_address"`
+	Action     string    `json:"action"`
+	Detail     string    `json:"detail"`
+	Actor      string    `json:"actor"` // admin who made the change
+	CreatedAt  time.Time `json:"created_at"`
+}
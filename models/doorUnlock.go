@@ -0,0 +1,42 @@
+// doorUnlock.go
+
+package models
+
+import "time"
+
+// UnlockWindow holds Doors unlocked from StartsAt up to EndsAt, e.g. for an
+// open house. Windows synced from a Wild Apricot event carry its EventId.
+type UnlockWindow struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Doors     []string  `json:"doors"` // door MAC addresses
+	EventId   int       `json:"event_id,omitempty"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OpenAt reports whether the window holds its doors unlocked at t.
+func (w UnlockWindow) OpenAt(t time.Time) bool {
+	return !t.Before(w.StartsAt) && t.Before(w.EndsAt)
+}
+
+// Covers reports whether the window unlocks the door with the given MAC.
+func (w UnlockWindow) Covers(mac string) bool {
+	for _, door := range w.Doors {
+		if door == mac {
+			return true
+		}
+	}
+	return false
+}
+
+// DoorState tells a door reader whether to hold its lock open. Reason names
+// what holds it open, or why it stays locked when that is not the norm.
+type DoorState struct {
+	Unlocked  bool       `json:"unlocked"`
+	Reason    string     `json:"reason,omitempty"`
+	Until     *time.Time `json:"until,omitempty"` // end of the unlock window, if one holds it open
+	SpaceMode string     `json:"space_mode"`
+}
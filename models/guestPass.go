@@ -0,0 +1,43 @@
+// guestPass.go
+
+package models
+
+import "time"
+
+// GuestPass lets a non-member through doors for a limited time, e.g. during
+// a workshop. Guests are kept apart from Wild Apricot data and are only
+// admitted while their sponsor is a current member.
+type GuestPass struct {
+	ID               int64     `json:"id"`
+	Name             string    `json:"name"`
+	TagId            uint64    `json:"tag_id"`
+	SponsorContactId int       `json:"sponsor_contact_id"`
+	StartsAt         time.Time `json:"starts_at"`
+	EndsAt           time.Time `json:"ends_at"`
+	Doors            []string  `json:"doors"` // MAC addresses; empty for every door
+	Revoked          bool      `json:"revoked"`
+	CreatedBy        string    `json:"created_by"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// ValidAt reports whether the pass is within its window at t and has not
+// been revoked. It does not check the sponsor.
+func (g GuestPass) ValidAt(t time.Time) bool {
+	return !g.Revoked && !t.Before(g.StartsAt) && t.Before(g.EndsAt)
+}
+
+// Admits reports whether the pass covers device, which must be a door.
+func (g GuestPass) Admits(device Device) bool {
+	if !device.IsDoor() {
+		return false
+	}
+	if len(g.Doors) == 0 {
+		return true
+	}
+	for _, mac := range g.Doors {
+		if mac == device.MACAddress {
+			return true
+		}
+	}
+	return false
+}
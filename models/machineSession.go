@@ -0,0 +1,59 @@
+// machineSession.go
+
+package models
+
+import "time"
+
+// MachineSession is one run of a machine, from the controller reporting
+// power-on for a tag until it reports power-off. ContactId is the member
+// who held the tag when the session started, or 0 for guests and tags let
+// in by an override.
+type MachineSession struct {
+	ID              int64     `json:"id"`
+	MACAddress      string    `json:"mac_address"`
+	TagId           uint64    `json:"tag_id"`
+	ContactId       int       `json:"contact_id"`
+	StartedAt       time.Time `json:"started_at"`
+	EndedAt         time.Time `json:"ended_at"` // zero while the machine is running
+	DurationSeconds int64     `json:"duration_seconds"`
+}
+
+// Running reports whether the machine has not been switched off yet.
+func (s MachineSession) Running() bool {
+	return s.EndedAt.IsZero()
+}
+
+// UsageReport totals finished machine sessions that started between From
+// and To. Months are in the space's configured timezone.
+type UsageReport struct {
+	From     time.Time      `json:"from"`
+	To       time.Time      `json:"to"`
+	Machines []MachineUsage `json:"machines"`
+	Members  []MemberUsage  `json:"members"`
+	Months   []MonthUsage   `json:"months"`
+}
+
+// MachineUsage is the time a machine ran.
+type MachineUsage struct {
+	MACAddress string  `json:"mac_address"`
+	Name       string  `json:"name"`
+	Sessions   int     `json:"sessions"`
+	Hours      float64 `json:"hours"`
+}
+
+// MemberUsage is the machine time run up by one member, or by one tag for
+// sessions of no member.
+type MemberUsage struct {
+	ContactId int     `json:"contact_id"`
+	TagId     uint64  `json:"tag_id,omitempty"` // only set when ContactId is 0
+	Sessions  int     `json:"sessions"`
+	Hours     float64 `json:"hours"`
+}
+
+// MonthUsage is the time a machine ran in one month, "YYYY-MM".
+type MonthUsage struct {
+	Month      string  `json:"month"`
+	MACAddress string  `json:"mac_address"`
+	Sessions   int     `json:"sessions"`
+	Hours      float64 `json:"hours"`
+}
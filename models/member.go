@@ -3,6 +3,6 @@
 package models
 
 type Member struct {
-	TagId           uint32 // corresponds to RFIDFieldName in config
+	TagId           uint64 // corresponds to RFIDFieldName in config
 	MembershipLevel int
 }
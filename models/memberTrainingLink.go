@@ -3,6 +3,6 @@
 package models
 
 type MemberTrainingLink struct {
-	TagID        uint32 // Foreign Key to Members (is an rfid)
+	TagID        uint64 // Foreign Key to Members (is an rfid)
 	TrainingName string // Foreign Key to Trainings
 }
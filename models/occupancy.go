@@ -0,0 +1,57 @@
+// occupancy.go
+
+package models
+
+import "time"
+
+// Occupant is someone believed to be in the space: they were let in at an
+// entry door and have not swiped out at an exit reader since.
+type Occupant struct {
+	TagId      uint64    `json:"tag_id"`
+	ContactId  int       `json:"contact_id"` // 0 for guests and tags let in by an override
+	GuestName  string    `json:"guest_name,omitempty"`
+	MACAddress string    `json:"mac_address"` // door they came in through
+	DoorName   string    `json:"door_name"`
+	EnteredAt  time.Time `json:"entered_at"`
+}
+
+// AccessLogEntry records one tag checked through /api/authenticate.
+type AccessLogEntry struct {
+	ID         int64  `json:"id"`
+	MACAddress string `json:"mac_address"`
+	TagId      uint64 `json:"tag_id"`
+	ContactId  int    `json:"contact_id"`
+	Granted    bool   `json:"granted"`
+	Reason     string `json:"reason"`
+	// The second person under a two-person rule; 0 when there was none
+	PartnerTagId     uint64    `json:"partner_tag_id,omitempty"`
+	PartnerContactId int       `json:"partner_contact_id,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// Kinds of suspicious tag use.
+const (
+	AnomalyPassback  = "passback"   // entered again while recorded inside
+	AnomalySharedTag = "shared_tag" // used at two doors too quickly for one person
+)
+
+// What to do about an anomaly: nothing, record it and alert admins, or also
+// deny the swipe.
+const (
+	AnomalyActionOff  = "off"
+	AnomalyActionFlag = "flag"
+	AnomalyActionDeny = "deny"
+)
+
+// AccessAnomaly is a swipe that suggests a tag is being shared or passed
+// back.
+type AccessAnomaly struct {
+	ID         int64     `json:"id"`
+	Kind       string    `json:"kind"`
+	TagId      uint64    `json:"tag_id"`
+	ContactId  int       `json:"contact_id"`
+	MACAddress string    `json:"mac_address"`
+	Detail     string    `json:"detail"`
+	Denied     bool      `json:"denied"`
+	CreatedAt  time.Time `json:"created_at"`
+}
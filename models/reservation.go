@@ -0,0 +1,31 @@
+// reservation.go
+
+package models
+
+import "time"
+
+// Reservation books a reservable machine for a member. While it is open the
+// machine only grants that member; outside reservations it is first come,
+// first served.
+type Reservation struct {
+	ID          int64     `json:"id"`
+	MACAddress  string    `json:"mac_address"`
+	ContactId   int       `json:"contact_id"`
+	StartsAt    time.Time `json:"starts_at"`
+	EndsAt      time.Time `json:"ends_at"`
+	Note        string    `json:"note"`
+	Cancelled   bool      `json:"cancelled"`
+	CancelledBy string    `json:"cancelled_by,omitempty"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// OpenAt reports whether the reservation holds its machine at t.
+func (r Reservation) OpenAt(t time.Time) bool {
+	return !r.Cancelled && !t.Before(r.StartsAt) && t.Before(r.EndsAt)
+}
+
+// Overlaps reports whether the two reservations share any time.
+func (r Reservation) Overlaps(other Reservation) bool {
+	return r.StartsAt.Before(other.EndsAt) && other.StartsAt.Before(r.EndsAt)
+}
@@ -0,0 +1,110 @@
+// schedule.go
+
+package models
+
+import (
+	"regexp"
+	"time"
+)
+
+// What a schedule can be attached to. Targets are identified by membership
+// level id, member contact id and device MAC address respectively. An
+// unlock schedule holds a door, by MAC address, unlocked while it is open.
+const (
+	ScheduleTargetLevel  = "level"
+	ScheduleTargetMember = "member"
+	ScheduleTargetDevice = "device"
+	ScheduleTargetUnlock = "unlock"
+)
+
+// Schedule is a set of weekly windows during which access is allowed. On
+// its holidays it is closed all day. Times are local to Timezone, an IANA
+// zone name; an empty Timezone means the server's configured zone.
+type Schedule struct {
+	ID       int64            `json:"id"`
+	Name     string           `json:"name"`
+	Timezone string           `json:"timezone"`
+	Windows  []ScheduleWindow `json:"windows"`
+	Holidays []Holiday        `json:"holidays"`
+}
+
+// ScheduleWindow opens a schedule on Weekday (0 is Sunday) from Start up to
+// but excluding End, both "HH:MM". End may be "24:00"; a window spanning
+// midnight is written as two windows.
+type ScheduleWindow struct {
+	Weekday int    `json:"weekday"`
+	Start   string `json:"start"`
+	End     string `json:"end"`
+}
+
+// Holiday closes a schedule on Date, "YYYY-MM-DD" in the schedule's zone.
+type Holiday struct {
+	Date string `json:"date"`
+	Name string `json:"name"`
+}
+
+// ScheduleAssignment attaches a schedule to a membership level, member or
+// device.
+type ScheduleAssignment struct {
+	TargetType string `json:"target_type"`
+	Target     string `json:"target"`
+	ScheduleID int64  `json:"schedule_id"`
+}
+
+// CacheSchedules are the schedule rules a reader needs to enforce its cache
+// offline: its own schedule, and the schedule of each cached tag that has one.
+type CacheSchedules struct {
+	DeviceSchedule int64              `json:"device_schedule,omitempty"`
+	TagSchedules   map[uint64]int64   `json:"tag_schedules"`
+	Schedules      map[int64]Schedule `json:"schedules"`
+}
+
+var clockTime = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+
+func ValidScheduleTarget(targetType string) bool {
+	switch targetType {
+	case ScheduleTargetLevel, ScheduleTargetMember, ScheduleTargetDevice, ScheduleTargetUnlock:
+		return true
+	}
+	return false
+}
+
+// Valid reports whether the window's weekday and times are well formed and
+// it does not end before it starts.
+func (w ScheduleWindow) Valid() bool {
+	if w.Weekday < 0 || w.Weekday > 6 || !clockTime.MatchString(w.Start) {
+		return false
+	}
+	if w.End != "24:00" && !clockTime.MatchString(w.End) {
+		return false
+	}
+	// Zero padded clock times compare correctly as strings
+	return w.Start < w.End
+}
+
+// Valid reports whether Date is a calendar date.
+func (h Holiday) Valid() bool {
+	_, err := time.Parse("2006-01-02", h.Date)
+	return err == nil
+}
+
+// OpenAt reports whether the schedule allows access at t, evaluated in loc.
+func (s Schedule) OpenAt(t time.Time, loc *time.Location) bool {
+	local := t.In(loc)
+
+	date := local.Format("2006-01-02")
+	for _, holiday := range s.Holidays {
+		if holiday.Date == date {
+			return false
+		}
+	}
+
+	weekday := int(local.Weekday())
+	clock := local.Format("15:04")
+	for _, window := range s.Windows {
+		if window.Weekday == weekday && window.Start <= clock && clock < window.End {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,22 @@
+// spaceMode.go
+
+package models
+
+import "time"
+
+// Space modes override every reader at once.
+const (
+	SpaceModeNormal   = "normal"   // readers follow their usual rules
+	SpaceModeUnlocked = "unlocked" // every door opens for anyone, e.g. for an event or a fire alarm
+	SpaceModeLockdown = "lockdown" // only members with the lockdown training pass
+)
+
+// SpaceMode is a change of the space-wide mode. The latest change is in
+// effect; with none the space is in normal mode.
+type SpaceMode struct {
+	ID        int64     `json:"id,omitempty"`
+	Mode      string    `json:"mode"`
+	Reason    string    `json:"reason"`
+	ChangedBy string    `json:"changed_by"`
+	ChangedAt time.Time `json:"changed_at"`
+}
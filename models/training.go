@@ -2,6 +2,37 @@
 
 package models
 
+import "time"
+
+// Training is a training label members can hold. A grant stays valid for
+// ValidityDays, after which the member must recertify; 0 never lapses. It
+// counts only once the Requires trainings are held too, and counts as
+// holding the Implies ones.
 type Training struct {
-	TrainingName string
+	Label        string   `json:"label"`
+	ValidityDays int      `json:"validity_days"`
+	Requires     []string `json:"requires"`
+	Implies      []string `json:"implies"`
+}
+
+// MemberTraining is one training a member holds and when it was granted.
+// ExpiresAt is zero for trainings that never lapse.
+type MemberTraining struct {
+	ContactId  int       `json:"contact_id"`
+	TagId      uint64    `json:"tag_id"`
+	Label      string    `json:"label"`
+	GrantedAt  time.Time `json:"granted_at"`
+	ExpiresAt  time.Time `json:"expires_at,omitempty"`
+	Expired    bool      `json:"expired"`
+	RemindedAt time.Time `json:"-"`
+}
+
+// Lapses reports whether the training has an expiry.
+func (t MemberTraining) Lapses() bool {
+	return !t.ExpiresAt.IsZero()
+}
+
+// ExpiredAt reports whether the training has lapsed by now.
+func (t MemberTraining) ExpiredAt(now time.Time) bool {
+	return t.Lapses() && !now.Before(t.ExpiresAt)
 }
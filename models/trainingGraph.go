@@ -0,0 +1,206 @@
+// trainingGraph.go
+
+package models
+
+import "sort"
+
+// How one training relates to another.
+const (
+	TrainingRelationRequires = "requires" // counts only once the other is held too
+	TrainingRelationImplies  = "implies"  // holding it counts as holding the other
+)
+
+// How far a member has got with a training, as shown to instructors.
+const (
+	TrainingStatusHeld      = "held"      // granted and counting
+	TrainingStatusImplied   = "implied"   // counting through a training that implies it
+	TrainingStatusBlocked   = "blocked"   // granted but waiting on prerequisites
+	TrainingStatusExpired   = "expired"   // granted but lapsed; recertify
+	TrainingStatusAvailable = "available" // prerequisites met; ready to train
+	TrainingStatusLocked    = "locked"    // prerequisites still missing
+)
+
+// TrainingGraph relates trainings to one another, e.g. "CNC Router"
+// requires "Shop Basics" and "Advanced Laser" implies "Laser". Both maps
+// are keyed by the training the relation belongs to.
+type TrainingGraph struct {
+	Requires map[string][]string
+	Implies  map[string][]string
+}
+
+// TrainingProgress is one training's status for a member. Missing lists
+// the prerequisites still needed for it to count, foundations first.
+type TrainingProgress struct {
+	Label   string   `json:"label"`
+	Status  string   `json:"status"`
+	Missing []string `json:"missing,omitempty"`
+}
+
+// PrerequisiteGap is a training a member was granted that does not count
+// yet because they lack its prerequisites.
+type PrerequisiteGap struct {
+	ContactId int      `json:"contact_id"`
+	TagId     uint64   `json:"tag_id"`
+	Label     string   `json:"label"`
+	Missing   []string `json:"missing"`
+}
+
+// Effective returns the trainings that count for a member granted the
+// given ones: every grant and what it implies, less those whose
+// prerequisites are not met. A training dropped for a missing prerequisite
+// implies nothing.
+func (g TrainingGraph) Effective(granted []string) []string {
+	blocked := make(map[string]bool)
+	for {
+		held := make(map[string]bool)
+		var hold func(label string)
+		hold = func(label string) {
+			if held[label] || blocked[label] {
+				return
+			}
+			held[label] = true
+			for _, implied := range g.Implies[label] {
+				hold(implied)
+			}
+		}
+		for _, label := range granted {
+			hold(label)
+		}
+
+		settled := true
+		for label := range held {
+			for _, prerequisite := range g.Requires[label] {
+				if !held[prerequisite] {
+					blocked[label] = true
+					settled = false
+					break
+				}
+			}
+		}
+		if settled {
+			labels := make([]string, 0, len(held))
+			for label := range held {
+				labels = append(labels, label)
+			}
+			sort.Strings(labels)
+			return labels
+		}
+	}
+}
+
+// Missing returns the prerequisites of label, direct or through other
+// prerequisites, that are not among held, foundations first.
+func (g TrainingGraph) Missing(label string, held []string) []string {
+	holds := make(map[string]bool, len(held))
+	for _, h := range held {
+		holds[h] = true
+	}
+
+	var missing []string
+	visited := make(map[string]bool)
+	var visit func(label string)
+	visit = func(label string) {
+		for _, prerequisite := range g.Requires[label] {
+			if visited[prerequisite] || holds[prerequisite] {
+				continue
+			}
+			visited[prerequisite] = true
+			visit(prerequisite)
+			missing = append(missing, prerequisite)
+		}
+	}
+	visit(label)
+	return missing
+}
+
+// Progress returns the status of each of labels for a member granted the
+// given trainings, of which lapsed have expired.
+func (g TrainingGraph) Progress(labels, granted, lapsed []string) []TrainingProgress {
+	effective := g.Effective(granted)
+	counts := make(map[string]bool, len(effective))
+	for _, label := range effective {
+		counts[label] = true
+	}
+	grants := make(map[string]bool, len(granted))
+	for _, label := range granted {
+		grants[label] = true
+	}
+	expired := make(map[string]bool, len(lapsed))
+	for _, label := range lapsed {
+		expired[label] = true
+	}
+
+	progress := make([]TrainingProgress, 0, len(labels))
+	for _, label := range labels {
+		p := TrainingProgress{Label: label}
+		switch {
+		case counts[label] && grants[label]:
+			p.Status = TrainingStatusHeld
+		case counts[label]:
+			p.Status = TrainingStatusImplied
+		case expired[label]:
+			p.Status = TrainingStatusExpired
+		default:
+			p.Missing = g.Missing(label, effective)
+			switch {
+			case grants[label]:
+				p.Status = TrainingStatusBlocked
+			case len(p.Missing) == 0:
+				p.Status = TrainingStatusAvailable
+			default:
+				p.Status = TrainingStatusLocked
+			}
+		}
+		progress = append(progress, p)
+	}
+	return progress
+}
+
+// Cycle returns a chain of trainings that leads back to its start through
+// relations, or nil if there is none.
+func Cycle(relations map[string][]string) []string {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int)
+	var path []string
+
+	var visit func(label string) []string
+	visit = func(label string) []string {
+		state[label] = visiting
+		path = append(path, label)
+		for _, next := range relations[label] {
+			switch state[next] {
+			case visiting:
+				for i, l := range path {
+					if l == next {
+						return append(append([]string{}, path[i:]...), next)
+					}
+				}
+			case unvisited:
+				if cycle := visit(next); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[label] = done
+		return nil
+	}
+
+	labels := make([]string, 0, len(relations))
+	for label := range relations {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		if state[label] == unvisited {
+			if cycle := visit(label); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
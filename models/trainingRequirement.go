@@ -0,0 +1,43 @@
+// trainingRequirement.go
+
+package models
+
+// How a device combines its training labels.
+const (
+	TrainingModeAll = "all" // member must hold every label
+	TrainingModeAny = "any" // member must hold at least one label
+)
+
+// TrainingRequirement is the set of trainings a device demands before it
+// lets a member use it. A requirement with no labels admits every member.
+type TrainingRequirement struct {
+	Mode   string
+	Labels []string
+}
+
+func ValidTrainingMode(mode string) bool {
+	return mode == TrainingModeAll || mode == TrainingModeAny
+}
+
+// SatisfiedBy reports whether a member holding the given training labels
+// meets the requirement.
+func (r TrainingRequirement) SatisfiedBy(held []string) bool {
+	if len(r.Labels) == 0 {
+		return true
+	}
+
+	holds := make(map[string]bool, len(held))
+	for _, label := range held {
+		holds[label] = true
+	}
+
+	for _, label := range r.Labels {
+		if holds[label] && r.Mode == TrainingModeAny {
+			return true
+		}
+		if !holds[label] && r.Mode != TrainingModeAny {
+			return false
+		}
+	}
+	return r.Mode != TrainingModeAny
+}
@@ -4,7 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"rfid-backend/config"
-	"strconv"
+	"rfid-backend/tagformat"
 )
 
 // Contact represents the structure of a contact in the Wild Apricot API's /Contacts response.
@@ -21,6 +21,13 @@ type Contact struct {
 	IsAccountAdministrator bool         `json:"IsAccountAdministrator"`
 	TermsOfUseAccepted     bool         `json:"TermsOfUseAccepted"`
 	Status                 string       `json:"Status"`
+	MembershipLevel        *Level       `json:"MembershipLevel"`
+}
+
+// Level is a Wild Apricot membership level, e.g. Associate or Full Member.
+type Level struct {
+	Id   int    `json:"Id"`
+	Name string `json:"Name"`
 }
 
 // FieldValue represents the structure for field values in a contact.
@@ -37,10 +44,10 @@ type SafetyTraining struct {
 }
 
 // Returns contact_id, tagId, trainings
-func (c *Contact) ExtractTagID(cfg *config.Config) (uint32, error) {
+func (c *Contact) ExtractTagID(cfg *config.Config, tags *tagformat.Parser) (uint64, error) {
 	for _, val := range c.FieldValues {
 		if val.FieldName == cfg.TagIdFieldName {
-			return parseTagId(val)
+			return parseTagId(val, tags)
 		}
 	}
 	return 0, nil // Return 0 if TagId field is not found
@@ -56,9 +63,17 @@ func (c *Contact) ExtractTrainingLabels(cfg *config.Config) ([]string, error) {
 	return nil, nil // Return nil if Training field is not found
 }
 
+// LevelId returns the contact's membership level id, or 0 if it has none.
+func (c *Contact) LevelId() int {
+	if c.MembershipLevel == nil {
+		return 0
+	}
+	return c.MembershipLevel.Id
+}
+
 // Combines extraction of Tag ID and Training Labels.
-func (c *Contact) ExtractContactData(cfg *config.Config) (int, uint32, []string, error) {
-	tagID, err := c.ExtractTagID(cfg)
+func (c *Contact) ExtractContactData(cfg *config.Config, tags *tagformat.Parser) (int, uint64, []string, error) {
+	tagID, err := c.ExtractTagID(cfg, tags)
 	if err != nil {
 		return 0, 0, nil, fmt.Errorf("error extracting TagId for contact %d: %v", c.Id, err)
 	}
@@ -71,7 +86,9 @@ func (c *Contact) ExtractContactData(cfg *config.Config) (int, uint32, []string,
 	return c.Id, tagID, trainingLabels, err
 }
 
-func parseTagId(fieldValue FieldValue) (uint32, error) {
+// parseTagId normalizes the tag field, which members may fill in using any
+// of the configured tag formats.
+func parseTagId(fieldValue FieldValue, tags *tagformat.Parser) (uint64, error) {
 	// Check that the field has a value before trying to convert it to a string.
 	if fieldValue.Value == nil {
 		return 0, nil
@@ -84,19 +101,15 @@ func parseTagId(fieldValue FieldValue) (uint32, error) {
 
 	if len(strVal) <= 0 {
 		// Suppress error on empty TagId field value, return 0
-		return uint32(0), nil
+		return uint64(0), nil
 	}
 
-	tagId, err := strconv.ParseInt(strVal, 10, 32)
+	tagId, err := tags.Parse(strVal)
 	if err != nil {
-		return 0, fmt.Errorf("failed to convert string TagId to int: %v", err)
-	}
-
-	if tagId <= 0 {
-		return 0, errors.New("TagId value is non-positive")
+		return 0, fmt.Errorf("failed to convert TagId: %v", err)
 	}
 
-	return uint32(tagId), nil
+	return tagId, nil
 }
 
 func parseTrainingLabels(fieldValue FieldValue) ([]string, error) {
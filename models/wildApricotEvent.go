@@ -0,0 +1,18 @@
+// wildApricotEvent.go
+
+package models
+
+import "time"
+
+// Event is an event in the Wild Apricot API's /events response.
+type Event struct {
+	Id          int       `json:"Id"`
+	Name        string    `json:"Name"`
+	StartDate   time.Time `json:"StartDate"`
+	EndDate     time.Time `json:"EndDate"`
+	Location    string    `json:"Location"`
+	AccessLevel string    `json:"AccessLevel"` // Public, AdminOnly or Restricted
+}
+
+// EventAccessPublic marks events anyone may see and attend.
+const EventAccessPublic = "Public"
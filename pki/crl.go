@@ -0,0 +1,200 @@
+package pki
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+// CRLValidity is how long a freshly signed CRL is valid for. Re-signing it
+// with `dingus-ca crl` (or any revocation) pushes the next update forward.
+const CRLValidity = 365 * 24 * time.Hour
+
+// Revoke adds serial to the CRL at crlFile and re-signs it. A missing CRL
+// file is treated as an empty list.
+func (ca *CA) Revoke(crlFile string, serial *big.Int) error {
+	entries, number, err := ca.readEntries(crlFile)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.SerialNumber.Cmp(serial) == 0 {
+			return fmt.Errorf("certificate %s is already revoked", serial.Text(16))
+		}
+	}
+
+	entries = append(entries, x509.RevocationListEntry{
+		SerialNumber:   serial,
+		RevocationTime: time.Now(),
+	})
+	return ca.writeCRL(crlFile, entries, number)
+}
+
+// RefreshCRL re-signs the CRL at crlFile with its current entries.
+func (ca *CA) RefreshCRL(crlFile string) error {
+	entries, number, err := ca.readEntries(crlFile)
+	if err != nil {
+		return err
+	}
+	return ca.writeCRL(crlFile, entries, number)
+}
+
+// RevokedSerials lists the serials on the CRL at crlFile.
+func (ca *CA) RevokedSerials(crlFile string) ([]*big.Int, error) {
+	entries, _, err := ca.readEntries(crlFile)
+	if err != nil {
+		return nil, err
+	}
+
+	serials := make([]*big.Int, 0, len(entries))
+	for _, entry := range entries {
+		serials = append(serials, entry.SerialNumber)
+	}
+	return serials, nil
+}
+
+func (ca *CA) readEntries(crlFile string) ([]x509.RevocationListEntry, *big.Int, error) {
+	der, err := readPEM(crlFile, "X509 CRL")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, big.NewInt(0), nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := crl.CheckSignatureFrom(ca.Cert); err != nil {
+		return nil, nil, fmt.Errorf("CRL %s was not signed by this CA: %v", crlFile, err)
+	}
+
+	return crl.RevokedCertificateEntries, crl.Number, nil
+}
+
+func (ca *CA) writeCRL(crlFile string, entries []x509.RevocationListEntry, lastNumber *big.Int) error {
+	now := time.Now()
+	template := &x509.RevocationList{
+		RevokedCertificateEntries: entries,
+		Number:                    new(big.Int).Add(lastNumber, big.NewInt(1)),
+		ThisUpdate:                now,
+		NextUpdate:                now.Add(CRLValidity),
+	}
+
+	der, err := x509.CreateRevocationList(rand.Reader, template, ca.Cert, ca.Key)
+	if err != nil {
+		return err
+	}
+	return writePEM(crlFile, "X509 CRL", der, 0644)
+}
+
+// RevocationChecker rejects TLS connections from device certificates listed
+// on the CA's CRL. The CRL file is re-read whenever its modification time
+// changes, so revocations made with the CLI apply without restarting the
+// server. Once the CRL is past its next update every connection is refused
+// until it is re-signed, since revocations may be missing from it.
+type RevocationChecker struct {
+	caCert  *x509.Certificate
+	crlFile string
+	now     func() time.Time
+
+	mu         sync.Mutex
+	modTime    time.Time
+	revoked    map[string]struct{}
+	nextUpdate time.Time
+}
+
+func NewRevocationChecker(caCert *x509.Certificate, crlFile string) (*RevocationChecker, error) {
+	rc := &RevocationChecker{caCert: caCert, crlFile: crlFile, now: time.Now}
+	if _, err := rc.load(); err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+// VerifyConnection is suitable for tls.Config.VerifyConnection. It runs after
+// the chain has been verified against the CA.
+func (rc *RevocationChecker) VerifyConnection(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("client certificate required")
+	}
+
+	revoked, err := rc.load()
+	if err != nil {
+		return err
+	}
+	if rc.Stale() {
+		return fmt.Errorf("CRL %s expired; re-sign it with `dingus-ca crl`", rc.crlFile)
+	}
+
+	serial := cs.PeerCertificates[0].SerialNumber.Text(16)
+	if _, ok := revoked[serial]; ok {
+		return fmt.Errorf("client certificate %s has been revoked", serial)
+	}
+	return nil
+}
+
+// Stale reports whether the loaded CRL is past its next update time.
+func (rc *RevocationChecker) Stale() bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return !rc.nextUpdate.IsZero() && rc.now().After(rc.nextUpdate)
+}
+
+func (rc *RevocationChecker) load() (map[string]struct{}, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	info, err := os.Stat(rc.crlFile)
+	if err != nil {
+		return nil, fmt.Errorf("CRL unavailable: %v", err)
+	}
+	if rc.revoked != nil && info.ModTime().Equal(rc.modTime) {
+		return rc.revoked, nil
+	}
+
+	der, err := readPEM(rc.crlFile, "X509 CRL")
+	if err != nil {
+		return nil, err
+	}
+
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		return nil, err
+	}
+	if err := crl.CheckSignatureFrom(rc.caCert); err != nil {
+		return nil, fmt.Errorf("CRL signature invalid: %v", err)
+	}
+
+	revoked := make(map[string]struct{}, len(crl.RevokedCertificateEntries))
+	for _, entry := range crl.RevokedCertificateEntries {
+		revoked[entry.SerialNumber.Text(16)] = struct{}{}
+	}
+
+	rc.revoked = revoked
+	rc.modTime = info.ModTime()
+	rc.nextUpdate = crl.NextUpdate
+	return revoked, nil
+}
+
+// ServerTLSConfig builds the TLS configuration for the mutual TLS listener.
+// Only certificates signed by caCert and absent from the CRL are accepted.
+func ServerTLSConfig(caCert *x509.Certificate, checker *RevocationChecker) *tls.Config {
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+
+	return &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		ClientAuth:       tls.RequireAndVerifyClientCert,
+		ClientCAs:        pool,
+		VerifyConnection: checker.VerifyConnection,
+	}
+}
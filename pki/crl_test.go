@@ -0,0 +1,56 @@
+package pki
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevocationChecker(t *testing.T) {
+	dir := t.TempDir()
+	crlFile := filepath.Join(dir, "crl.pem")
+
+	ca, err := InitCA(filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem"), "Test CA", time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, ca.RefreshCRL(crlFile))
+
+	issue := func(mac string) *x509.Certificate {
+		certPEM, _, _, err := ca.IssueDeviceCert(mac, time.Hour)
+		require.NoError(t, err)
+		block, _ := pem.Decode(certPEM)
+		cert, err := x509.ParseCertificate(block.Bytes)
+		require.NoError(t, err)
+		return cert
+	}
+	kept := issue("AA:AA:AA:AA:AA:AA")
+	revoked := issue("BB:BB:BB:BB:BB:BB")
+
+	checker, err := NewRevocationChecker(ca.Cert, crlFile)
+	require.NoError(t, err)
+
+	state := func(cert *x509.Certificate) tls.ConnectionState {
+		return tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	}
+	assert.NoError(t, checker.VerifyConnection(state(revoked)))
+
+	require.NoError(t, ca.Revoke(crlFile, revoked.SerialNumber))
+	// Coarse filesystem timestamps could hide the rewrite from the checker
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(crlFile, later, later))
+
+	assert.Error(t, checker.VerifyConnection(state(revoked)))
+	assert.NoError(t, checker.VerifyConnection(state(kept)))
+	assert.Error(t, ca.Revoke(crlFile, revoked.SerialNumber), "revoking twice should fail")
+
+	// A CRL past its next update may be missing revocations, so nobody passes
+	checker.now = func() time.Time { return time.Now().Add(CRLValidity + time.Hour) }
+	assert.True(t, checker.Stale())
+	assert.Error(t, checker.VerifyConnection(state(kept)))
+}
@@ -0,0 +1,156 @@
+package pki
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"rfid-backend/models"
+	"time"
+)
+
+var (
+	ErrBadSnapshotSignature = errors.New("cache snapshot signature does not verify")
+	ErrSnapshotExpired      = errors.New("cache snapshot has expired")
+)
+
+// CacheSnapshot is the access list a reader stores for offline use. Readers
+// should refuse snapshots for another MAC address, snapshots past ExpiresAt
+// and snapshots with a lower Version than the one they hold.
+type CacheSnapshot struct {
+	MACAddress string   `json:"mac_address"`
+	DeviceType string   `json:"device_type"`
+	Version    int64    `json:"version"`
+	IssuedAt   int64    `json:"issued_at"`
+	ExpiresAt  int64    `json:"expires_at"`
+	TagIds     []uint64 `json:"tag_ids"`
+	// Schedules restrict when the device and individual tags may be used
+	Schedules *models.CacheSchedules `json:"schedules,omitempty"`
+	// SpaceMode is normal, unlocked (doors open for anyone) or lockdown
+	SpaceMode string `json:"space_mode,omitempty"`
+}
+
+// SignedSnapshot carries a CacheSnapshot as the exact JSON bytes that were
+// signed, so readers verify the payload before parsing it.
+type SignedSnapshot struct {
+	KeyID     string `json:"key_id"`
+	Payload   string `json:"payload"`   // base64 JSON CacheSnapshot
+	Signature string `json:"signature"` // base64 Ed25519 signature of the decoded payload
+}
+
+// SnapshotSigner signs reader cache snapshots with the server's Ed25519 key.
+type SnapshotSigner struct {
+	key      ed25519.PrivateKey
+	validity time.Duration
+}
+
+// LoadSnapshotSigner reads the signing key from keyFile, generating and
+// saving a new one if the file does not exist yet.
+func LoadSnapshotSigner(keyFile string, validity time.Duration) (*SnapshotSigner, error) {
+	keyDER, err := readPEM(keyFile, "PRIVATE KEY")
+	if errors.Is(err, os.ErrNotExist) {
+		return createSnapshotSigner(keyFile, validity)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(keyDER)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("signing key " + keyFile + " is not an Ed25519 key")
+	}
+
+	return NewSnapshotSigner(key, validity), nil
+}
+
+func createSnapshotSigner(keyFile string, validity time.Duration) (*SnapshotSigner, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := writePEM(keyFile, "PRIVATE KEY", keyDER, 0600); err != nil {
+		return nil, err
+	}
+
+	return NewSnapshotSigner(key, validity), nil
+}
+
+// NewSnapshotSigner signs snapshots with key that stay valid for validity.
+func NewSnapshotSigner(key ed25519.PrivateKey, validity time.Duration) *SnapshotSigner {
+	return &SnapshotSigner{key: key, validity: validity}
+}
+
+// PublicKey is the key firmware verifies snapshots with.
+func (s *SnapshotSigner) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// KeyID identifies the public key, so readers can tell when it was rotated.
+func (s *SnapshotSigner) KeyID() string {
+	return SnapshotKeyID(s.PublicKey())
+}
+
+// Sign stamps snapshot with its issue and expiry times and signs it.
+func (s *SnapshotSigner) Sign(snapshot CacheSnapshot, now time.Time) (SignedSnapshot, error) {
+	snapshot.IssuedAt = now.Unix()
+	snapshot.ExpiresAt = now.Add(s.validity).Unix()
+	if snapshot.TagIds == nil {
+		snapshot.TagIds = []uint64{}
+	}
+
+	payload, err := json.Marshal(snapshot)
+	if err != nil {
+		return SignedSnapshot{}, err
+	}
+
+	return SignedSnapshot{
+		KeyID:     s.KeyID(),
+		Payload:   base64.StdEncoding.EncodeToString(payload),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, payload)),
+	}, nil
+}
+
+// VerifySnapshot checks signed against pub and returns the snapshot if it
+// has not expired. It is what reader firmware is expected to do.
+func VerifySnapshot(pub ed25519.PublicKey, signed SignedSnapshot, now time.Time) (CacheSnapshot, error) {
+	payload, err := base64.StdEncoding.DecodeString(signed.Payload)
+	if err != nil {
+		return CacheSnapshot{}, err
+	}
+	signature, err := base64.StdEncoding.DecodeString(signed.Signature)
+	if err != nil {
+		return CacheSnapshot{}, err
+	}
+	if !ed25519.Verify(pub, payload, signature) {
+		return CacheSnapshot{}, ErrBadSnapshotSignature
+	}
+
+	var snapshot CacheSnapshot
+	if err := json.Unmarshal(payload, &snapshot); err != nil {
+		return CacheSnapshot{}, err
+	}
+	if now.Unix() >= snapshot.ExpiresAt {
+		return CacheSnapshot{}, ErrSnapshotExpired
+	}
+	return snapshot, nil
+}
+
+// SnapshotKeyID is the first 8 bytes of the public key's SHA-256, in hex.
+func SnapshotKeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
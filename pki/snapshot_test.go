@@ -0,0 +1,53 @@
+package pki
+
+import (
+	"encoding/base64"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotSigner(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "cache-signing-key.pem")
+
+	signer, err := LoadSnapshotSigner(keyFile, time.Hour)
+	require.NoError(t, err)
+
+	// The generated key is reused on the next start
+	reloaded, err := LoadSnapshotSigner(keyFile, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, signer.PublicKey(), reloaded.PublicKey())
+	assert.Len(t, signer.KeyID(), 16)
+
+	now := time.Now()
+	signed, err := signer.Sign(CacheSnapshot{MACAddress: "AA:AA:AA:AA:AA:AA", DeviceType: "door", Version: 7, TagIds: []uint64{111}}, now)
+	require.NoError(t, err)
+
+	snapshot, err := VerifySnapshot(signer.PublicKey(), signed, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), snapshot.Version)
+	assert.Equal(t, []uint64{111}, snapshot.TagIds)
+	assert.Equal(t, now.Add(time.Hour).Unix(), snapshot.ExpiresAt)
+
+	_, err = VerifySnapshot(signer.PublicKey(), signed, now.Add(2*time.Hour))
+	assert.Equal(t, ErrSnapshotExpired, err)
+
+	// A list with an extra tag no longer matches the signature
+	forged, err := signer.Sign(CacheSnapshot{MACAddress: "AA:AA:AA:AA:AA:AA", Version: 7, TagIds: []uint64{111, 999}}, now)
+	require.NoError(t, err)
+	forged.Signature = signed.Signature
+	_, err = VerifySnapshot(signer.PublicKey(), forged, now)
+	assert.Equal(t, ErrBadSnapshotSignature, err)
+
+	other, err := LoadSnapshotSigner(filepath.Join(t.TempDir(), "other.pem"), time.Hour)
+	require.NoError(t, err)
+	_, err = VerifySnapshot(other.PublicKey(), signed, now)
+	assert.Equal(t, ErrBadSnapshotSignature, err)
+
+	signed.Payload = base64.StdEncoding.EncodeToString([]byte("{}"))
+	_, err = VerifySnapshot(signer.PublicKey(), signed, now)
+	assert.Equal(t, ErrBadSnapshotSignature, err)
+}
@@ -0,0 +1,245 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"rfid-backend/models"
+	"time"
+)
+
+const (
+	// accessChangeRetention is how many access_changes rows are kept.
+	// Readers further behind than this get a full snapshot.
+	accessChangeRetention = 10000
+	// maxDeltaChanges caps the rows replayed for one delta; beyond it a
+	// snapshot is smaller anyway.
+	maxDeltaChanges = 1000
+)
+
+// ErrNoTrainingAssigned is returned when building the cache of a machine
+// that requires no training, which would admit nobody.
+var ErrNoTrainingAssigned = errors.New("device has no training assigned")
+
+// CacheDelta brings a reader's cache up to Sequence. It is either the
+// changes since the reader's sequence or, when Full is set, the whole list.
+type CacheDelta struct {
+	Full     bool
+	Sequence int64
+	TagIds   []uint64
+	Add      []uint64
+	Remove   []uint64
+}
+
+// GetDeviceCacheTags returns the tags device should admit while offline,
+// guest passes and overrides included. Devices out of service get an empty list so they deny
+// everyone. During a lockdown only admins are listed.
+func (s *DBService) GetDeviceCacheTags(device models.Device) ([]uint64, error) {
+	if !deviceDecision(device).Granted {
+		return []uint64{}, nil
+	}
+
+	req, err := s.GetDeviceRequirement(device)
+	if err != nil {
+		return nil, err
+	}
+	if device.Type == models.DeviceTypeMachine && len(req.Labels) == 0 {
+		return nil, ErrNoTrainingAssigned
+	}
+	// Readers cannot check for a second person or a reservation offline
+	if device.OnlineOnly() {
+		return []uint64{}, nil
+	}
+
+	tagIds, err := s.GetEligibleTagIds(req)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	guests, err := s.guestTags(device, now)
+	if err != nil {
+		return nil, err
+	}
+	tagIds, err = s.applyOverrides(device, append(tagIds, guests...), now)
+	if err != nil {
+		return nil, err
+	}
+
+	mode, err := s.GetSpaceMode()
+	if err != nil {
+		return nil, err
+	}
+	if mode.Mode == models.SpaceModeLockdown {
+		return s.lockdownTags(tagIds)
+	}
+	if tagIds == nil {
+		tagIds = []uint64{}
+	}
+	return tagIds, nil
+}
+
+// CurrentAccessSequence is the sequence of the latest logged access change.
+func (s *DBService) CurrentAccessSequence() (int64, error) {
+	var seq int64
+	err := s.db.QueryRow(GetAccessSequenceQuery).Scan(&seq)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return seq, err
+}
+
+// GetCacheDelta returns what changed in device's cache since the given
+// sequence, or a full snapshot when the changes are no longer on record,
+// too many, or include a reset for the device.
+func (s *DBService) GetCacheDelta(device models.Device, since int64) (CacheDelta, error) {
+	current, err := s.CurrentAccessSequence()
+	if err != nil {
+		return CacheDelta{}, err
+	}
+	if since == current {
+		return CacheDelta{Sequence: current, Add: []uint64{}, Remove: []uint64{}}, nil
+	}
+	if since > current {
+		return s.fullDelta(device, current)
+	}
+
+	rows, err := s.db.Query(GetAccessChangesSinceQuery, since, maxDeltaChanges+1)
+	if err != nil {
+		return CacheDelta{}, err
+	}
+	defer rows.Close()
+
+	var (
+		composed []TagChange
+		index    = make(map[uint64]int)
+		expected = since + 1
+	)
+	for rows.Next() {
+		var (
+			seq                 int64
+			tagId               sql.NullInt64
+			mac, before, after  string
+			wasMember, isMember bool
+		)
+		if err := rows.Scan(&seq, &tagId, &mac, &wasMember, &before, &isMember, &after); err != nil {
+			return CacheDelta{}, err
+		}
+
+		// A gap means older changes were pruned
+		if seq != expected || seq-since > maxDeltaChanges {
+			return s.fullDelta(device, current)
+		}
+		expected++
+
+		if !tagId.Valid {
+			if mac == "" || mac == device.MACAddress {
+				return s.fullDelta(device, current)
+			}
+			continue
+		}
+
+		change := TagChange{TagId: uint64(tagId.Int64), IsMember: isMember}
+		if err := json.Unmarshal([]byte(after), &change.After); err != nil {
+			return CacheDelta{}, err
+		}
+
+		// Keep the first state seen and the last, so a tag that changed
+		// back and forth cancels out
+		if i, ok := index[change.TagId]; ok {
+			composed[i].IsMember, composed[i].After = change.IsMember, change.After
+			continue
+		}
+		change.WasMember = wasMember
+		if err := json.Unmarshal([]byte(before), &change.Before); err != nil {
+			return CacheDelta{}, err
+		}
+		index[change.TagId] = len(composed)
+		composed = append(composed, change)
+	}
+	if err := rows.Err(); err != nil {
+		return CacheDelta{}, err
+	}
+	if expected-1 < current {
+		return s.fullDelta(device, current)
+	}
+
+	add, remove, err := s.DeviceAccessDelta(device, composed)
+	if err != nil {
+		return CacheDelta{}, err
+	}
+
+	delta := CacheDelta{Sequence: expected - 1, Add: []uint64{}, Remove: []uint64{}}
+	delta.Add = append(delta.Add, add...)
+	delta.Remove = append(delta.Remove, remove...)
+	return delta, nil
+}
+
+func (s *DBService) fullDelta(device models.Device, seq int64) (CacheDelta, error) {
+	tagIds, err := s.GetDeviceCacheTags(device)
+	return CacheDelta{Full: true, Sequence: seq, TagIds: tagIds}, err
+}
+
+// recordTagChanges logs changes in tx and returns the sequence of the last
+// one, or the current sequence if there were none.
+func recordTagChanges(tx *sql.Tx, changes []TagChange) (int64, error) {
+	if len(changes) == 0 {
+		var seq int64
+		err := tx.QueryRow(GetAccessSequenceQuery).Scan(&seq)
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return seq, err
+	}
+
+	stmt, err := tx.Prepare(InsertAccessChangeQuery)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var seq int64
+	for _, change := range changes {
+		before, err := json.Marshal(labelsOrEmpty(change.Before))
+		if err != nil {
+			return 0, err
+		}
+		after, err := json.Marshal(labelsOrEmpty(change.After))
+		if err != nil {
+			return 0, err
+		}
+
+		res, err := stmt.Exec(change.TagId, change.WasMember, string(before), change.IsMember, string(after))
+		if err != nil {
+			return 0, err
+		}
+		if seq, err = res.LastInsertId(); err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.Exec(PruneAccessChangesQuery, accessChangeRetention)
+	return seq, err
+}
+
+// recordReset logs that device mac (or every device, if empty) must reload
+// its whole cache.
+func recordReset(db execer, mac string) (int64, error) {
+	res, err := db.Exec(InsertAccessResetQuery, mac)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func labelsOrEmpty(labels []string) []string {
+	if labels == nil {
+		return []string{}
+	}
+	return labels
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"testing"
+
+	"rfid-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheDeltaReplaysLoggedChanges(t *testing.T) {
+	db := setupTestDB(t)
+	dbService := NewDBService(db, mockConfig(), testLogger())
+
+	door := models.DeviceDetails{Name: "Front Door", Type: models.DeviceTypeDoor, Enabled: true}
+	require.NoError(t, dbService.CreateDevice("AA:AA:AA:AA:AA:AA", door))
+	_, err := dbService.ApproveDevice("AA:AA:AA:AA:AA:AA", door)
+	require.NoError(t, err)
+	device, err := dbService.GetDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+
+	change := func(stmts ...string) {
+		tx, err := db.Begin()
+		require.NoError(t, err)
+		_, err = dbService.trackAccessChanges(tx, func() error {
+			for _, stmt := range stmts {
+				if _, err := tx.Exec(stmt); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.NoError(t, tx.Commit())
+	}
+
+	change("INSERT INTO members (contact_id, tag_id, membership_level) VALUES (1, 111, 1)")
+	since, err := dbService.CurrentAccessSequence()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), since)
+
+	// Member 2 joins and leaves again, member 1 lapses, member 3 joins
+	change("INSERT INTO members (contact_id, tag_id, membership_level) VALUES (2, 222, 1)")
+	change("DELETE FROM members WHERE contact_id = 2", "DELETE FROM members WHERE contact_id = 1")
+	change("INSERT INTO members (contact_id, tag_id, membership_level) VALUES (3, 333, 1)")
+
+	delta, err := dbService.GetCacheDelta(*device, since)
+	require.NoError(t, err)
+	assert.False(t, delta.Full)
+	assert.Equal(t, int64(5), delta.Sequence)
+	assert.Equal(t, []uint64{333}, delta.Add)
+	assert.Equal(t, []uint64{111}, delta.Remove)
+
+	delta, err = dbService.GetCacheDelta(*device, 5)
+	require.NoError(t, err)
+	assert.False(t, delta.Full)
+	assert.Empty(t, delta.Add)
+	assert.Empty(t, delta.Remove)
+
+	// Resets only force a full download for the device they name
+	dbService.publishDeviceReset("BB:BB:BB:BB:BB:BB")
+	delta, err = dbService.GetCacheDelta(*device, 5)
+	require.NoError(t, err)
+	assert.False(t, delta.Full)
+	assert.Equal(t, int64(6), delta.Sequence)
+
+	dbService.publishDeviceReset("AA:AA:AA:AA:AA:AA")
+	delta, err = dbService.GetCacheDelta(*device, 5)
+	require.NoError(t, err)
+	assert.True(t, delta.Full)
+	assert.Equal(t, int64(7), delta.Sequence)
+	assert.Equal(t, []uint64{333}, delta.TagIds)
+
+	// A sequence from another database is not trusted
+	delta, err = dbService.GetCacheDelta(*device, 100)
+	require.NoError(t, err)
+	assert.True(t, delta.Full)
+
+	// Nor is one whose changes were pruned
+	_, err = db.Exec("DELETE FROM access_changes WHERE sequence <= 3")
+	require.NoError(t, err)
+	delta, err = dbService.GetCacheDelta(*device, 2)
+	require.NoError(t, err)
+	assert.True(t, delta.Full)
+}
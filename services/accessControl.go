@@ -0,0 +1,143 @@
+package services
+
+import (
+	"rfid-backend/models"
+	"time"
+)
+
+// AuthorizeTag decides whether a tag swiped at device may pass now.
+func (s *DBService) AuthorizeTag(device models.Device, rawTag string) (models.AccessDecision, error) {
+	return s.AuthorizeTagAt(device, rawTag, time.Now())
+}
+
+// AuthorizeTagAt decides whether a tag swiped at device at the given time
+// may pass. A door held unlocked by the space mode, an unlock window or its
+// unlock schedule opens for anyone. Otherwise overrides come first: a deny override refuses the tag outright
+// and an allow override admits it without checking membership, trainings or
+// the member's schedule. The device's own schedule always applies. Tags of
+// no member are checked against guest passes. A tag that would be let in
+// must then belong to an admin during a lockdown, belong to the
+// holder of any open reservation on a reservable machine, and satisfy the
+// device's two-person rule.
+func (s *DBService) AuthorizeTagAt(device models.Device, rawTag string, now time.Time) (models.AccessDecision, error) {
+	mode, err := s.GetSpaceMode()
+	if err != nil {
+		return models.Deny("space mode lookup failed"), err
+	}
+	if device.IsDoor() {
+		state, err := s.doorState(device, mode, now)
+		if err != nil {
+			return models.Deny("door state lookup failed"), err
+		}
+		if state.Unlocked {
+			return models.GrantUnlocked(), nil
+		}
+	}
+
+	decision, err := s.authorizeTag(device, rawTag, now)
+	if err != nil || !decision.Granted {
+		return decision, err
+	}
+
+	tagId, err := s.NormalizeTag(rawTag)
+	if err != nil {
+		return models.Deny("tag lookup failed"), err
+	}
+	if mode.Mode == models.SpaceModeLockdown {
+		if decision, err := s.lockdownDecision(tagId); !decision.Granted {
+			return decision, err
+		}
+	}
+	if decision, err := s.reservationDecision(device, tagId, now); !decision.Granted {
+		return decision, err
+	}
+	return s.twoPersonDecision(device, tagId, now)
+}
+
+func (s *DBService) authorizeTag(device models.Device, rawTag string, now time.Time) (models.AccessDecision, error) {
+	if decision := deviceDecision(device); !decision.Granted {
+		return decision, nil
+	}
+
+	tagId, err := s.NormalizeTag(rawTag)
+	if err != nil {
+		return models.Deny("unrecognized tag format"), err
+	}
+
+	effect, err := s.tagOverride(device, tagId, now)
+	if err != nil {
+		return models.Deny("override lookup failed"), err
+	}
+	if effect == models.OverrideDeny {
+		return models.Deny("denied by override"), nil
+	}
+
+	if decision, err := s.deviceScheduleDecision(device, now); !decision.Granted {
+		return decision, err
+	}
+	if effect == models.OverrideAllow {
+		return models.Grant(), nil
+	}
+
+	exists, err := s.TagExists(rawTag)
+	if err != nil {
+		return models.Deny("tag lookup failed"), err
+	}
+
+	if !exists {
+		guest, err := s.guestPassAt(device, tagId, now)
+		if err != nil {
+			return models.Deny("guest pass lookup failed"), err
+		}
+		if guest != nil {
+			return models.Grant(), nil
+		}
+	}
+
+	req, err := s.GetDeviceRequirement(device)
+	if err != nil {
+		return models.Deny("training lookup failed"), err
+	}
+
+	var held []string
+	if exists && len(req.Labels) > 0 {
+		if held, err = s.GetTagTrainingLabels(tagId); err != nil {
+			return models.Deny("training lookup failed"), err
+		}
+	}
+
+	if decision := memberDecision(device, req, exists, held); !decision.Granted {
+		if decision.Reason == "missing training" {
+			return s.missingTrainingDecision(req, tagId, held)
+		}
+		return decision, nil
+	}
+	return s.memberScheduleDecision(tagId, now)
+}
+
+// deviceDecision denies every tag at a device that is out of service.
+func deviceDecision(device models.Device) models.AccessDecision {
+	switch {
+	case !device.IsApproved():
+		return models.Deny("device not approved")
+	case !device.Enabled:
+		return models.Deny("device disabled")
+	case device.InMaintenance:
+		return models.Deny("device in maintenance")
+	}
+	return models.Grant()
+}
+
+// memberDecision decides whether a member holding the given trainings meets
+// the device's requirement. isMember is false for tags of no active member.
+func memberDecision(device models.Device, req models.TrainingRequirement, isMember bool, held []string) models.AccessDecision {
+	switch {
+	case !isMember:
+		return models.Deny("unknown tag")
+	case len(req.Labels) == 0 && device.Type == models.DeviceTypeMachine:
+		return models.Deny("no training assigned")
+	case !req.SatisfiedBy(held):
+		return models.Deny("missing training")
+	}
+	return models.Grant()
+}
@@ -0,0 +1,306 @@
+package services
+
+import (
+	"database/sql"
+	"maps"
+	"rfid-backend/models"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// AccessChange describes a committed change to who may badge in where.
+// Subscribers work out what it means for their own device.
+type AccessChange struct {
+	// Sequence is the change's position in the access_changes log, for
+	// readers resuming through the delta cache.
+	Sequence int64
+	// Reset tells readers to download their whole cache again, e.g. after
+	// a device's trainings or state changed. MACAddress limits it to one
+	// device; empty means every device.
+	Reset      bool
+	MACAddress string
+	Tags       []TagChange
+}
+
+// TagChange is one tag's membership and trainings before and after a change.
+type TagChange struct {
+	TagId     uint64
+	WasMember bool
+	Before    []string
+	IsMember  bool
+	After     []string
+}
+
+// AccessEvents fans access changes out to subscribers such as the readers'
+// push connections.
+type AccessEvents struct {
+	mu   sync.Mutex
+	subs map[*AccessSubscription]struct{}
+}
+
+// AccessSubscription receives access changes until it is closed. A
+// subscriber that falls behind misses changes instead of blocking
+// publishers; Missed reports that so it can resynchronize.
+type AccessSubscription struct {
+	C      <-chan AccessChange
+	ch     chan AccessChange
+	missed atomic.Bool
+	events *AccessEvents
+}
+
+func NewAccessEvents() *AccessEvents {
+	return &AccessEvents{subs: make(map[*AccessSubscription]struct{})}
+}
+
+func (e *AccessEvents) Subscribe() *AccessSubscription {
+	ch := make(chan AccessChange, 16)
+	sub := &AccessSubscription{C: ch, ch: ch, events: e}
+
+	e.mu.Lock()
+	e.subs[sub] = struct{}{}
+	e.mu.Unlock()
+	return sub
+}
+
+func (e *AccessEvents) Publish(change AccessChange) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for sub := range e.subs {
+		select {
+		case sub.ch <- change:
+		default:
+			sub.missed.Store(true)
+		}
+	}
+}
+
+// Missed reports whether changes were dropped since the last call.
+func (sub *AccessSubscription) Missed() bool {
+	return sub.missed.Swap(false)
+}
+
+func (sub *AccessSubscription) Close() {
+	sub.events.mu.Lock()
+	delete(sub.events.subs, sub)
+	sub.events.mu.Unlock()
+}
+
+// SubscribeAccessChanges returns a subscription to committed access changes.
+func (s *DBService) SubscribeAccessChanges() *AccessSubscription {
+	return s.events.Subscribe()
+}
+
+// AccessDelta works out which of the changed tags device should now admit
+// and which it should drop.
+func AccessDelta(device models.Device, req models.TrainingRequirement, changes []TagChange) (add, remove []uint64) {
+	// Devices out of service were sent a reset when they left service
+	if !deviceDecision(device).Granted {
+		return nil, nil
+	}
+
+	for _, change := range changes {
+		before := memberDecision(device, req, change.WasMember, change.Before).Granted
+		after := memberDecision(device, req, change.IsMember, change.After).Granted
+		switch {
+		case after && !before:
+			add = append(add, change.TagId)
+		case before && !after:
+			remove = append(remove, change.TagId)
+		}
+	}
+	return add, remove
+}
+
+// trackAccessChanges runs apply inside tx and works out how it changed each
+// member's access by snapshotting members and their trainings before and
+// after. The changes are logged in tx; publish them once it commits.
+func (s *DBService) trackAccessChanges(tx *sql.Tx, apply func() error) (AccessChange, error) {
+	before, err := accessSnapshot(tx)
+	if err != nil {
+		return AccessChange{}, err
+	}
+	levelsBefore, err := memberLevels(tx)
+	if err != nil {
+		return AccessChange{}, err
+	}
+	adminsBefore, err := adminTags(tx)
+	if err != nil {
+		return AccessChange{}, err
+	}
+
+	if err := apply(); err != nil {
+		return AccessChange{}, err
+	}
+
+	after, err := accessSnapshot(tx)
+	if err != nil {
+		return AccessChange{}, err
+	}
+
+	change := AccessChange{Tags: diffAccess(before, after)}
+	if change.Sequence, err = recordTagChanges(tx, change.Tags); err != nil {
+		return change, err
+	}
+
+	// Readers only learn member schedules from a full cache, so reload
+	// them when a member's level changed or a scheduled member was added
+	levelsAfter, err := memberLevels(tx)
+	if err != nil {
+		return change, err
+	}
+	reload, err := schedulesChanged(tx, levelsBefore, levelsAfter, change.Tags)
+	if err != nil {
+		return change, err
+	}
+	// Lockdown caches list only admins, so follow changes to who is one
+	if !reload {
+		adminsAfter, err := adminTags(tx)
+		if err != nil {
+			return change, err
+		}
+		reload = !maps.Equal(adminsBefore, adminsAfter)
+	}
+	if !reload {
+		return change, nil
+	}
+	change.Reset = true
+	change.Sequence, err = recordReset(tx, "")
+	return change, err
+}
+
+func schedulesChanged(tx *sql.Tx, levelsBefore, levelsAfter map[int]int, changes []TagChange) (bool, error) {
+	for contactId, level := range levelsAfter {
+		if before, ok := levelsBefore[contactId]; ok && before != level {
+			return true, nil
+		}
+	}
+
+	for _, change := range changes {
+		if !change.IsMember || change.WasMember {
+			continue
+		}
+		var scheduleId int64
+		if err := tx.QueryRow(GetTagScheduleQuery, change.TagId).Scan(&scheduleId); err != nil && err != sql.ErrNoRows {
+			return false, err
+		}
+		if scheduleId != 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// publishAccessChange announces a change after its transaction committed.
+func (s *DBService) publishAccessChange(change AccessChange) {
+	if len(change.Tags) == 0 && !change.Reset {
+		return
+	}
+	s.log.Infof("Access changed for %d tags (sequence %d)", len(change.Tags), change.Sequence)
+	s.events.Publish(change)
+}
+
+// publishDeviceReset asks one device to download its cache again.
+func (s *DBService) publishDeviceReset(mac string) {
+	seq, err := recordReset(s.db, mac)
+	if err != nil {
+		s.log.Errorf("Failed to log cache reset for device %s: %v", mac, err)
+	}
+	s.events.Publish(AccessChange{Sequence: seq, Reset: true, MACAddress: mac})
+}
+
+// memberLevels maps each member's contact id to their membership level.
+func memberLevels(tx *sql.Tx) (map[int]int, error) {
+	levels := make(map[int]int)
+
+	rows, err := tx.Query(GetMemberLevelsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var contactId, level int
+		if err := rows.Scan(&contactId, &level); err != nil {
+			return nil, err
+		}
+		levels[contactId] = level
+	}
+	return levels, rows.Err()
+}
+
+// accessSnapshot maps each member's tag to the trainings that count for it,
+// with prerequisites and implied trainings applied.
+func accessSnapshot(db querier) (map[uint64][]string, error) {
+	snapshot := make(map[uint64][]string)
+
+	rows, err := db.Query(GetAccessSnapshotQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			tagId uint64
+			label sql.NullString
+		)
+		if err := rows.Scan(&tagId, &label); err != nil {
+			return nil, err
+		}
+		labels := snapshot[tagId]
+		if label.Valid {
+			labels = append(labels, label.String)
+		}
+		snapshot[tagId] = labels
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	graph, err := trainingGraph(db)
+	if err != nil {
+		return nil, err
+	}
+	for tagId, labels := range snapshot {
+		snapshot[tagId] = graph.Effective(labels)
+	}
+	return snapshot, nil
+}
+
+func diffAccess(before, after map[uint64][]string) []TagChange {
+	var changes []TagChange
+
+	for tagId, labels := range before {
+		newLabels, isMember := after[tagId]
+		if !isMember || !sameLabels(labels, newLabels) {
+			changes = append(changes, TagChange{TagId: tagId, WasMember: true, Before: labels, IsMember: isMember, After: newLabels})
+		}
+	}
+	for tagId, labels := range after {
+		if _, wasMember := before[tagId]; !wasMember {
+			changes = append(changes, TagChange{TagId: tagId, IsMember: true, After: labels})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].TagId < changes[j].TagId })
+	return changes
+}
+
+func sameLabels(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[string]bool, len(a))
+	for _, label := range a {
+		seen[label] = true
+	}
+	for _, label := range b {
+		if !seen[label] {
+			return false
+		}
+	}
+	return true
+}
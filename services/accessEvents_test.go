@@ -0,0 +1,97 @@
+package services
+
+import (
+	"testing"
+
+	"rfid-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrackAccessChangesPublishesDeltas(t *testing.T) {
+	db := setupTestDB(t)
+	dbService := NewDBService(db, mockConfig(), testLogger())
+
+	_, err := db.Exec("INSERT INTO members (contact_id, tag_id, membership_level) VALUES (1, 111, 1), (2, 222, 1)")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO members_trainings_link (tag_id, label) VALUES (111, 'Laser'), (222, 'Laser')")
+	require.NoError(t, err)
+
+	sub := dbService.SubscribeAccessChanges()
+	defer sub.Close()
+
+	// Member 1 lapses, member 3 joins, member 2 picks up a training
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	published, err := dbService.trackAccessChanges(tx, func() error {
+		if _, err := tx.Exec("DELETE FROM members WHERE contact_id = 1"); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO members (contact_id, tag_id, membership_level) VALUES (3, 333, 1)"); err != nil {
+			return err
+		}
+		_, err := tx.Exec("INSERT INTO members_trainings_link (tag_id, label) VALUES (222, 'Lathe')")
+		return err
+	})
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+	dbService.publishAccessChange(published)
+
+	change := <-sub.C
+	require.Len(t, change.Tags, 3)
+	assert.Equal(t, int64(3), change.Sequence)
+	assert.False(t, sub.Missed())
+
+	door := models.Device{Status: models.DeviceStatusApproved, Enabled: true, Type: models.DeviceTypeDoor}
+	add, remove := AccessDelta(door, models.TrainingRequirement{Mode: models.TrainingModeAll}, change.Tags)
+	assert.Equal(t, []uint64{333}, add)
+	assert.Equal(t, []uint64{111}, remove)
+
+	lathe := models.Device{Status: models.DeviceStatusApproved, Enabled: true, Type: models.DeviceTypeMachine}
+	add, remove = AccessDelta(lathe, models.TrainingRequirement{Mode: models.TrainingModeAll, Labels: []string{"Lathe"}}, change.Tags)
+	assert.Equal(t, []uint64{222}, add)
+	assert.Empty(t, remove)
+
+	lathe.InMaintenance = true
+	add, remove = AccessDelta(lathe, models.TrainingRequirement{Mode: models.TrainingModeAll, Labels: []string{"Lathe"}}, change.Tags)
+	assert.Empty(t, add)
+	assert.Empty(t, remove)
+}
+
+func TestSlowSubscriberMissesChanges(t *testing.T) {
+	events := NewAccessEvents()
+	sub := events.Subscribe()
+	defer sub.Close()
+
+	for i := 0; i < cap(sub.ch)+1; i++ {
+		events.Publish(AccessChange{Reset: true})
+	}
+
+	assert.True(t, sub.Missed())
+	assert.False(t, sub.Missed())
+}
+
+func TestSyncRevocationReachesSubscribers(t *testing.T) {
+	db := setupTestDB(t)
+	dbService := NewDBService(db, mockConfig(), testLogger())
+
+	_, err := db.Exec("INSERT INTO members (contact_id, tag_id, membership_level) VALUES (1, 111, 1), (2, 222, 1)")
+	require.NoError(t, err)
+
+	sub := dbService.SubscribeAccessChanges()
+	defer sub.Close()
+
+	// Member 1 is no longer among the active contacts Wild Apricot returns
+	contacts := []models.Contact{{Id: 2, Status: "Active", FieldValues: []models.FieldValue{{FieldName: "RFID", Value: "222"}}}}
+	require.NoError(t, dbService.ProcessContactsData(contacts))
+
+	select {
+	case change := <-sub.C:
+		require.Len(t, change.Tags, 1)
+		assert.Equal(t, uint64(111), change.Tags[0].TagId)
+		assert.False(t, change.Tags[0].IsMember)
+	default:
+		t.Fatal("sync published no access change")
+	}
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"rfid-backend/models"
+	"time"
+)
+
+// ScreenAccess checks a swipe that AuthorizeTagAt granted at a door for
+// signs of a shared or passed back tag, using occupancy and the access log.
+// Grants at a door held unlocked are not screened. Each anomaly found is
+// recorded; if the configured action for one is deny, the returned decision
+// denies the swipe. So that a deny action cannot be bypassed, a swipe that
+// fails screening is also denied while either action is deny. Callers
+// should alert admins about the anomalies returned.
+func (s *DBService) ScreenAccess(device models.Device, rawTag string, decision models.AccessDecision, now time.Time) (models.AccessDecision, []models.AccessAnomaly, error) {
+	if !decision.Granted || !device.IsDoor() {
+		return decision, nil, nil
+	}
+	// Nobody is held at a door that is unlocked anyway
+	if decision.DoorUnlocked {
+		return decision, nil, nil
+	}
+
+	screened, found, err := s.screenAccess(device, rawTag, decision, now)
+	if err != nil && (s.anomalyAction(models.AnomalyPassback) == models.AnomalyActionDeny ||
+		s.anomalyAction(models.AnomalySharedTag) == models.AnomalyActionDeny) {
+		screened = models.Deny("anomaly screening failed")
+	}
+	return screened, found, err
+}
+
+func (s *DBService) screenAccess(device models.Device, rawTag string, decision models.AccessDecision, now time.Time) (models.AccessDecision, []models.AccessAnomaly, error) {
+	tagId, err := s.NormalizeTag(rawTag)
+	if err != nil {
+		return decision, nil, err
+	}
+
+	found, err := s.detectAnomalies(device, tagId, now)
+	if err != nil {
+		return decision, nil, err
+	}
+
+	for i := range found {
+		a := &found[i]
+		a.TagId, a.MACAddress, a.CreatedAt = tagId, device.MACAddress, now
+		a.Denied = s.anomalyAction(a.Kind) == models.AnomalyActionDeny
+
+		res, err := s.db.Exec(InsertAccessAnomalyQuery, a.Kind, a.TagId, a.TagId, a.MACAddress, a.Detail, a.Denied, now.UTC())
+		if err != nil {
+			return decision, found, err
+		}
+		if a.ID, err = res.LastInsertId(); err != nil {
+			return decision, found, err
+		}
+		if a.Denied {
+			decision = models.Deny("suspected " + anomalyLabel(a.Kind))
+		}
+	}
+	return decision, found, nil
+}
+
+// GetAccessAnomalies returns the latest anomalies, newest first.
+func (s *DBService) GetAccessAnomalies(limit int) ([]models.AccessAnomaly, error) {
+	if limit <= 0 || limit > maxAccessLogListed {
+		limit = maxAccessLogListed
+	}
+
+	rows, err := s.db.Query(GetAccessAnomaliesQuery, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	anomalies := []models.AccessAnomaly{}
+	for rows.Next() {
+		var (
+			a         models.AccessAnomaly
+			contactId sql.NullInt64
+		)
+		if err := rows.Scan(&a.ID, &a.Kind, &a.TagId, &contactId, &a.MACAddress, &a.Detail, &a.Denied, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		a.ContactId = int(contactId.Int64)
+		anomalies = append(anomalies, a)
+	}
+	return anomalies, rows.Err()
+}
+
+// detectAnomalies looks for an entry by a tag already recorded inside, and
+// for a tag granted at another door moments ago.
+func (s *DBService) detectAnomalies(device models.Device, tagId uint64, now time.Time) ([]models.AccessAnomaly, error) {
+	var found []models.AccessAnomaly
+
+	if s.anomalyAction(models.AnomalyPassback) != models.AnomalyActionOff && device.DoorDirection != models.DoorDirectionExit {
+		since := time.Time{}
+		if s.cfg.OccupancyExpiry > 0 {
+			since = now.Add(-s.cfg.OccupancyExpiry)
+		}
+		var (
+			mac, door string
+			enteredAt time.Time
+		)
+		err := s.db.QueryRow(GetOccupantEntryQuery, tagId, since.UTC()).Scan(&mac, &door, &enteredAt)
+		switch {
+		case err == nil:
+			found = append(found, models.AccessAnomaly{Kind: models.AnomalyPassback,
+				Detail: fmt.Sprintf("already inside since %s through %s", enteredAt.In(s.siteLocation()).Format("15:04"), orMAC(door, mac))})
+		case err != sql.ErrNoRows:
+			return nil, err
+		}
+	}
+
+	if s.anomalyAction(models.AnomalySharedTag) != models.AnomalyActionOff {
+		var (
+			mac, door string
+			swipedAt  time.Time
+		)
+		err := s.db.QueryRow(GetRecentDoorSwipeQuery, tagId, device.MACAddress, now.Add(-s.cfg.TagSharingWindow).UTC()).Scan(&mac, &door, &swipedAt)
+		switch {
+		case err == nil:
+			found = append(found, models.AccessAnomaly{Kind: models.AnomalySharedTag,
+				Detail: fmt.Sprintf("used at %s %s earlier", orMAC(door, mac), now.Sub(swipedAt).Round(time.Second))})
+		case err != sql.ErrNoRows:
+			return nil, err
+		}
+	}
+
+	return found, nil
+}
+
+func (s *DBService) anomalyAction(kind string) string {
+	action := s.cfg.TagSharingAction
+	if kind == models.AnomalyPassback {
+		action = s.cfg.AntiPassback
+	}
+	if action == "" {
+		return models.AnomalyActionOff
+	}
+	return action
+}
+
+func anomalyLabel(kind string) string {
+	if kind == models.AnomalyPassback {
+		return "passback"
+	}
+	return "shared tag"
+}
+
+func orMAC(name, mac string) string {
+	if name == "" {
+		return mac
+	}
+	return name
+}
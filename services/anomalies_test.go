@@ -0,0 +1,98 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"rfid-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScreenAccessFindsAnomalies(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := mockConfig()
+	cfg.OccupancyExpiry = 12 * time.Hour
+	cfg.AntiPassback = models.AnomalyActionDeny
+	cfg.TagSharingAction = models.AnomalyActionFlag
+	cfg.TagSharingWindow = 30 * time.Second
+	dbService := NewDBService(db, cfg, testLogger())
+
+	_, err := db.Exec("INSERT INTO members (contact_id, tag_id, membership_level) VALUES (1, 111, 1)")
+	require.NoError(t, err)
+
+	door := models.DeviceDetails{Type: models.DeviceTypeDoor, Enabled: true}
+	for _, mac := range []string{"AA:AA:AA:AA:AA:AA", "BB:BB:BB:BB:BB:BB", "CC:CC:CC:CC:CC:CC"} {
+		require.NoError(t, dbService.CreateDevice(mac, door))
+		_, err = dbService.ApproveDevice(mac, door)
+		require.NoError(t, err)
+	}
+	require.NoError(t, dbService.SetDoorDirection("CC:CC:CC:CC:CC:CC", models.DoorDirectionExit))
+	front, err := dbService.GetDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+	back, err := dbService.GetDevice("BB:BB:BB:BB:BB:BB")
+	require.NoError(t, err)
+	exit, err := dbService.GetDevice("CC:CC:CC:CC:CC:CC")
+	require.NoError(t, err)
+
+	swipe := func(device *models.Device, at time.Time) (models.AccessDecision, []models.AccessAnomaly) {
+		decision, err := dbService.AuthorizeTagAt(*device, "111", at)
+		require.NoError(t, err)
+		decision, anomalies, err := dbService.ScreenAccess(*device, "111", decision, at)
+		require.NoError(t, err)
+		require.NoError(t, dbService.RecordAccess(*device, "111", decision, at))
+		return decision, anomalies
+	}
+
+	now := time.Now()
+	decision, anomalies := swipe(front, now)
+	assert.True(t, decision.Granted)
+	assert.Empty(t, anomalies)
+
+	// Back door ten seconds later: passed back and shared
+	decision, anomalies = swipe(back, now.Add(10*time.Second))
+	assert.Equal(t, models.Deny("suspected passback"), decision)
+	require.Len(t, anomalies, 2)
+	assert.Equal(t, models.AnomalyPassback, anomalies[0].Kind)
+	assert.True(t, anomalies[0].Denied)
+	assert.Equal(t, models.AnomalySharedTag, anomalies[1].Kind)
+	assert.False(t, anomalies[1].Denied)
+	assert.Contains(t, anomalies[1].Detail, "10s earlier")
+
+	// Swiping out and back in later is fine
+	decision, anomalies = swipe(exit, now.Add(time.Hour))
+	assert.True(t, decision.Granted)
+	assert.Empty(t, anomalies)
+	decision, anomalies = swipe(back, now.Add(2*time.Hour))
+	assert.True(t, decision.Granted)
+	assert.Empty(t, anomalies)
+
+	recorded, err := dbService.GetAccessAnomalies(0)
+	require.NoError(t, err)
+	require.Len(t, recorded, 2)
+	assert.Equal(t, 1, recorded[0].ContactId)
+	assert.Equal(t, back.MACAddress, recorded[0].MACAddress)
+}
+
+func TestScreenAccessFailsClosedWhenDenying(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := mockConfig()
+	cfg.TagSharingAction = models.AnomalyActionFlag
+	dbService := NewDBService(db, cfg, testLogger())
+
+	door := models.DeviceDetails{Type: models.DeviceTypeDoor, Enabled: true}
+	require.NoError(t, dbService.CreateDevice("AA:AA:AA:AA:AA:AA", door))
+	front, err := dbService.GetDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+
+	// A tag that cannot be read cannot be screened; flagging lets it through
+	decision, _, err := dbService.ScreenAccess(*front, "not a tag", models.Grant(), time.Now())
+	assert.Error(t, err)
+	assert.True(t, decision.Granted)
+
+	cfg.AntiPassback = models.AnomalyActionDeny
+	decision, _, err = dbService.ScreenAccess(*front, "not a tag", models.Grant(), time.Now())
+	assert.Error(t, err)
+	assert.Equal(t, models.Deny("anomaly screening failed"), decision)
+}
@@ -6,33 +6,50 @@ import (
 	"fmt"
 	"rfid-backend/config"
 	"rfid-backend/models"
+	"rfid-backend/tagformat"
 	"rfid-backend/webhooks"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
 type DBService struct {
-	db  *sql.DB
-	cfg *config.Config
-	log *logrus.Logger
+	db     *sql.DB
+	cfg    *config.Config
+	log    *logrus.Logger
+	events *AccessEvents
+	tags   *tagformat.Parser
 }
 
 func NewDBService(db *sql.DB, cfg *config.Config, logger *logrus.Logger) *DBService {
-	return &DBService{db: db, cfg: cfg, log: logger}
+	tags, err := tagformat.NewParser(cfg.TagFormats)
+	if err != nil {
+		logger.Errorf("Ignoring tag_formats: %v", err)
+		tags, _ = tagformat.NewParser(nil)
+	}
+	return &DBService{db: db, cfg: cfg, log: logger, events: NewAccessEvents(), tags: tags}
+}
+
+// NormalizeTag turns a tag written in any of the configured formats into
+// the number members' tags are stored as.
+func (s *DBService) NormalizeTag(raw string) (uint64, error) {
+	return s.tags.Parse(raw)
 }
 
-func (s *DBService) GetTagIdsForTraining(machineName string) ([]uint32, error) {
-	return s.fetchTagIds(GetTagIdsForTrainingQuery, machineName)
+// GetTagIdsForTraining returns the tags for which label counts, held
+// directly or implied by another training.
+func (s *DBService) GetTagIdsForTraining(label string) ([]uint64, error) {
+	return s.GetEligibleTagIds(models.TrainingRequirement{Mode: models.TrainingModeAll, Labels: []string{label}})
 }
 
-func (s *DBService) GetAllTagIds() ([]uint32, error) {
+func (s *DBService) GetAllTagIds() ([]uint64, error) {
 	return s.fetchTagIds(GetAllTagIdsQuery)
 }
 
-func (s *DBService) fetchTagIds(query string, args ...interface{}) ([]uint32, error) {
-	var tagIds []uint32
+func (s *DBService) fetchTagIds(query string, args ...interface{}) ([]uint64, error) {
+	var tagIds []uint64
 
 	rows, err := s.db.Query(query, args...)
 	if err != nil {
@@ -41,7 +58,7 @@ func (s *DBService) fetchTagIds(query string, args ...interface{}) ([]uint32, er
 	defer rows.Close()
 
 	for rows.Next() {
-		var tagId uint32
+		var tagId uint64
 		if err := rows.Scan(&tagId); err != nil {
 			return nil, err
 		}
@@ -96,8 +113,8 @@ func (s *DBService) GetDevices() ([]models.Device, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		var d models.Device
-		if err := rows.Scan(&d.IPAddress, &d.MACAddress); err != nil {
+		d, err := scanDevice(rows)
+		if err != nil {
 			return nil, err
 		}
 		devices = append(devices, d)
@@ -106,6 +123,55 @@ func (s *DBService) GetDevices() ([]models.Device, error) {
 	return devices, nil
 }
 
+// GetDevice returns the device registered under mac, or nil if there is none.
+func (s *DBService) GetDevice(mac string) (*models.Device, error) {
+	d, err := scanDevice(s.db.QueryRow(GetDeviceQuery, mac))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (s *DBService) GetDeviceTrainingLabels(mac string) ([]string, error) {
+	var labels []string
+
+	rows, err := s.db.Query(GetDeviceTrainingLabelsQuery, mac)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var label string
+		if err := rows.Scan(&label); err != nil {
+			return nil, err
+		}
+		labels = append(labels, label)
+	}
+
+	return labels, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanDevice(row rowScanner) (models.Device, error) {
+	var (
+		d                       models.Device
+		lastSeen, lastHeartbeat sql.NullTime
+	)
+	err := row.Scan(&d.IPAddress, &d.MACAddress, &d.RequiresTraining, &d.SecretHash, &d.EnrollmentHash,
+		&d.Status, &d.Name, &d.Location, &d.Type, &d.Notes, &d.Enabled, &d.InMaintenance, &d.MaintenanceReason, &d.TrainingMode, &d.DoorDirection, &d.TwoPersonRule, &d.PartnerWindowSeconds, &d.Reservable, &d.FirstSeen, &lastSeen,
+		&d.FirmwareVersion, &d.UptimeSeconds, &d.CacheVersion, &d.Stats, &lastHeartbeat, &d.Online, &d.RegisteredFrom)
+	d.LastSeen = lastSeen.Time
+	d.LastHeartbeat = lastHeartbeat.Time
+	return d, err
+}
+
 func (s *DBService) GetDevicesTrainings() ([]models.DeviceTrainingLink, error) {
 	var result []models.DeviceTrainingLink
 
@@ -128,11 +194,14 @@ func (s *DBService) GetDevicesTrainings() ([]models.DeviceTrainingLink, error) {
 
 func (s *DBService) ProcessContactsData(contacts []models.Contact) error {
 	var allContacts []int
-	var allTagIds []uint32
-	trainingMap := make(map[string][]uint32)
+	var allTagIds []uint64
+	var allLevels []int
+	var allAdmins []bool
+	levels := make(map[int]string)
+	trainingMap := make(map[string][]uint64)
 
 	for _, contact := range contacts {
-		contactId, tagId, trainingLabels, err := contact.ExtractContactData(s.cfg)
+		contactId, tagId, trainingLabels, err := contact.ExtractContactData(s.cfg, s.tags)
 		if err != nil {
 			// output the error and save any data that was retrieved.
 			s.log.Error(err)
@@ -142,6 +211,11 @@ func (s *DBService) ProcessContactsData(contacts []models.Contact) error {
 			// Only
 			allContacts = append(allContacts, contactId)
 			allTagIds = append(allTagIds, tagId)
+			allLevels = append(allLevels, contact.LevelId())
+			allAdmins = append(allAdmins, contact.IsAccountAdministrator)
+			if contact.MembershipLevel != nil {
+				levels[contact.MembershipLevel.Id] = contact.MembershipLevel.Name
+			}
 			for _, label := range trainingLabels {
 				trainingMap[label] = append(trainingMap[label], tagId)
 			}
@@ -164,20 +238,31 @@ func (s *DBService) ProcessContactsData(contacts []models.Contact) error {
 		return err
 	}
 
-	if err := s.processDatabaseUpdatesAndDeletes(tx, allContacts, allTagIds, trainingMap); err != nil {
+	change, err := s.trackAccessChanges(tx, func() error {
+		if err := s.upsertMembershipLevels(tx, levels); err != nil {
+			return err
+		}
+		return s.processDatabaseUpdatesAndDeletes(tx, allContacts, allTagIds, allLevels, allAdmins, trainingMap)
+	})
+	if err != nil {
 		tx.Rollback()
 		return err
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.publishAccessChange(change)
+	s.warnPrerequisiteGaps()
+	return nil
 }
 
 // TagExists checks if a tag exists in the members table
 func (s *DBService) TagExists(raw_tag string) (bool, error) {
 	var exists bool
-	tag, err := strconv.Atoi(raw_tag)
+	tag, err := s.NormalizeTag(raw_tag)
 	if err != nil {
-		s.log.Errorf("tag value %s is not a number", raw_tag)
+		s.log.Errorf("tag value %s is not a recognized tag: %v", raw_tag, err)
 		return false, err
 	}
 
@@ -188,8 +273,8 @@ func (s *DBService) TagExists(raw_tag string) (bool, error) {
 	return exists, nil
 }
 
-func (s *DBService) processDatabaseUpdatesAndDeletes(tx *sql.Tx, allContacts []int, allTagIds []uint32, trainingMap map[string][]uint32) error {
-	if err := s.insertOrUpdateAllMembers(tx, allContacts, allTagIds); err != nil {
+func (s *DBService) processDatabaseUpdatesAndDeletes(tx *sql.Tx, allContacts []int, allTagIds []uint64, allLevels []int, allAdmins []bool, trainingMap map[string][]uint64) error {
+	if err := s.insertOrUpdateAllMembers(tx, allContacts, allTagIds, allLevels, allAdmins); err != nil {
 		return err
 	}
 
@@ -209,7 +294,7 @@ func (s *DBService) processDatabaseUpdatesAndDeletes(tx *sql.Tx, allContacts []i
 	return nil
 }
 
-func (s *DBService) insertOrUpdateAllMembers(tx *sql.Tx, allContacts []int, allTagIds []uint32) error {
+func (s *DBService) insertOrUpdateAllMembers(tx *sql.Tx, allContacts []int, allTagIds []uint64, allLevels []int, allAdmins []bool) error {
 	memberStmt, err := tx.Prepare(InsertOrUpdateMemberQuery)
 	if err != nil {
 		s.log.Errorf("Error preparing statement: %v", err)
@@ -221,8 +306,7 @@ func (s *DBService) insertOrUpdateAllMembers(tx *sql.Tx, allContacts []int, allT
 	s.log.Info("allTagIds length:", len(allTagIds))
 
 	for i := 0; i < len(allContacts); i++ {
-		membershipLevel := 1 // Placeholder for actual membership level
-		if _, err := memberStmt.Exec(allContacts[i], allTagIds[i], membershipLevel, allTagIds[i]); err != nil {
+		if _, err := memberStmt.Exec(allContacts[i], allTagIds[i], allLevels[i], allAdmins[i], allTagIds[i]); err != nil {
 			s.log.Errorf("Error executing insertOrUpdate for tagId %d: %v", allTagIds[i], err)
 			return err
 		}
@@ -232,7 +316,7 @@ func (s *DBService) insertOrUpdateAllMembers(tx *sql.Tx, allContacts []int, allT
 	return nil
 }
 
-func (s *DBService) insertActiveMember(tx *sql.Tx, contactId int, tagId uint32) error {
+func (s *DBService) insertActiveMember(tx *sql.Tx, contactId int, tagId uint64, membershipLevel int, isAdmin bool) error {
 	memberStmt, err := tx.Prepare(InsertOrUpdateMemberQuery)
 	if err != nil {
 		s.log.Errorf("Error preparing statement: %v", err)
@@ -240,16 +324,15 @@ func (s *DBService) insertActiveMember(tx *sql.Tx, contactId int, tagId uint32)
 	}
 	defer memberStmt.Close()
 
-	membershipLevel := 1 // Placeholder for actual membership level
 	s.log.Infof("contactId: %d, tagId: %d, ml: %d, tagId: %d", contactId, tagId, membershipLevel, tagId)
-	if _, err := memberStmt.Exec(contactId, tagId, membershipLevel, tagId); err != nil {
+	if _, err := memberStmt.Exec(contactId, tagId, membershipLevel, isAdmin, tagId); err != nil {
 		s.log.Errorf("Error executing insertOrUpdate for tagId %d: %v", tagId, err)
 		return err
 	}
 	return nil
 }
 
-func (s *DBService) insertTrainings(tx *sql.Tx, trainingMap map[string][]uint32) error {
+func (s *DBService) insertTrainings(tx *sql.Tx, trainingMap map[string][]uint64) error {
 	trainingStmt, err := tx.Prepare(InsertTrainingQuery)
 	if err != nil {
 		return err
@@ -263,58 +346,45 @@ func (s *DBService) insertTrainings(tx *sql.Tx, trainingMap map[string][]uint32)
 	return nil
 }
 
-func (s *DBService) InsertDevice(ip, mac string, requiresTraining int) error {
-	tx, err := s.db.Begin()
-	if err != nil {
-		return err
-	}
-	deviceStmt, err := tx.Prepare(InsertDeviceQuery)
+// upsertMembershipLevels records level names so schedules can be attached
+// to levels by name.
+func (s *DBService) upsertMembershipLevels(tx *sql.Tx, levels map[int]string) error {
+	stmt, err := tx.Prepare(UpsertMembershipLevelQuery)
 	if err != nil {
 		return err
 	}
-	defer deviceStmt.Close()
+	defer stmt.Close()
 
-	if _, err := deviceStmt.Exec(ip, mac, requiresTraining); err != nil {
-		return err
+	for id, name := range levels {
+		if _, err := stmt.Exec(id, name); err != nil {
+			return err
+		}
 	}
-	s.log.Info("Inserted device successfully")
-	return tx.Commit()
+	return nil
 }
 
-func (s *DBService) InsertDeviceTrainingLink(ip, trainingLabel string) error {
+func (s *DBService) InsertDevice(ip, mac string, requiresTraining int) error {
 	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
-
-	deleteStmt, err := tx.Prepare("DELETE FROM devices_trainings_link WHERE mac_address = ?")
-	if err != nil {
-		tx.Rollback()
-		return err
-	}
-	defer deleteStmt.Close()
-
-	if _, err := deleteStmt.Exec(ip); err != nil {
-		tx.Rollback()
-		return err
-	}
-
-	insertStmt, err := tx.Prepare("INSERT INTO devices_trainings_link (mac_address, label) VALUES (?, ?)")
+	deviceStmt, err := tx.Prepare(InsertDeviceQuery)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
-	defer insertStmt.Close()
+	defer deviceStmt.Close()
 
-	if _, err := insertStmt.Exec(ip, trainingLabel); err != nil {
-		tx.Rollback()
+	if _, err := deviceStmt.Exec(ip, mac, requiresTraining); err != nil {
 		return err
 	}
-
+	s.log.Info("Inserted device successfully")
 	return tx.Commit()
 }
 
-func (s *DBService) manageMemberTrainingLinks(tx *sql.Tx, trainingMap map[string][]uint32) error {
+// manageMemberTrainingLinks records new training grants. Wild Apricot keeps
+// no grant date, so a grant is dated when a sync first sees it; existing
+// grants keep their date, and ticking a training again does not recertify.
+func (s *DBService) manageMemberTrainingLinks(tx *sql.Tx, trainingMap map[string][]uint64) error {
 	linkStmt, err := tx.Prepare(InsertMemberTrainingLinkQuery)
 	if err != nil {
 		return err
@@ -323,7 +393,7 @@ func (s *DBService) manageMemberTrainingLinks(tx *sql.Tx, trainingMap map[string
 
 	for trainingLabel, tagIds := range trainingMap {
 		for _, tagId := range tagIds {
-			if _, err := linkStmt.Exec(tagId, trainingLabel); err != nil {
+			if _, err := linkStmt.Exec(tagId, trainingLabel, time.Now().UTC()); err != nil {
 				return err
 			}
 		}
@@ -361,14 +431,14 @@ func (s *DBService) DeleteDeviceTrainingLink(ip string) error {
 	return err
 }
 
-func (s *DBService) insertMemberTrainingLink(tx *sql.Tx, tagId uint32, trainings []string) error {
+func (s *DBService) insertMemberTrainingLink(tx *sql.Tx, tagId uint64, trainings []string) error {
 	linkStmt, err := tx.Prepare(InsertMemberTrainingLinkQuery)
 	if err != nil {
 		return err
 	}
 	defer linkStmt.Close()
 	for _, trainingLabel := range trainings {
-		if _, err := linkStmt.Exec(tagId, trainingLabel); err != nil {
+		if _, err := linkStmt.Exec(tagId, trainingLabel, time.Now().UTC()); err != nil {
 			return err
 		}
 	}
@@ -376,7 +446,7 @@ func (s *DBService) insertMemberTrainingLink(tx *sql.Tx, tagId uint32, trainings
 }
 
 func (s *DBService) ProcessContactWebhookTrainingData(params webhooks.ContactParameters, contact models.Contact) error {
-	contactId, tagId, trainingLabels, err := contact.ExtractContactData(s.cfg)
+	contactId, tagId, trainingLabels, err := contact.ExtractContactData(s.cfg, s.tags)
 	if err != nil {
 		return err
 	}
@@ -386,35 +456,39 @@ func (s *DBService) ProcessContactWebhookTrainingData(params webhooks.ContactPar
 		return err
 	}
 
-	// Handle tagId changes
-	// Delete from the members table if they do not have a valid tagId
-	if tagId <= 0 {
-		if err := s.deleteLapsedMember(tx, contactId); err != nil {
-			return err
+	change, err := s.trackAccessChanges(tx, func() error {
+		// Handle tagId changes
+		// Delete from the members table if they do not have a valid tagId
+		if tagId <= 0 {
+			return s.deleteLapsedMember(tx, contactId)
 		}
 
-		return tx.Commit()
-	}
-
-	// If and only if Status is active, attempt to insert the active member
-	if contact.Status == "Active" {
-		if err := s.insertActiveMember(tx, contactId, tagId); err != nil {
-			return err
+		// If and only if Status is active, attempt to insert the active member
+		if contact.Status == "Active" {
+			if err := s.insertActiveMember(tx, contactId, tagId, contact.LevelId(), contact.IsAccountAdministrator); err != nil {
+				return err
+			}
 		}
-	}
 
-	// Handle trainings changes
-	s.log.Infof("trainingLabels: %+v", trainingLabels)
-	if err := s.insertMemberTrainingLink(tx, tagId, trainingLabels); err != nil {
+		// Handle trainings changes
+		s.log.Infof("trainingLabels: %+v", trainingLabels)
+		return s.insertMemberTrainingLink(tx, tagId, trainingLabels)
+	})
+	if err != nil {
 		tx.Rollback()
 		return err
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.publishAccessChange(change)
+	s.warnPrerequisiteGaps(contactId)
+	return nil
 }
 
 func (s *DBService) ProcessMembershipWebhook(params webhooks.MembershipParameters, contact models.Contact) error {
-	contactId, tagId, _, err := contact.ExtractContactData(s.cfg)
+	contactId, tagId, _, err := contact.ExtractContactData(s.cfg, s.tags)
 	if err != nil {
 		return err
 	}
@@ -425,21 +499,29 @@ func (s *DBService) ProcessMembershipWebhook(params webhooks.MembershipParameter
 		return err
 	}
 
-	switch params.MembershipStatus {
-	case webhooks.StatusLapsed:
-		s.log.Infof("Lapsed membership detected")
-
-		if err := s.deleteLapsedMember(tx, contactId); err != nil {
-			tx.Rollback()
-			return err
-		}
-	case webhooks.StatusActive:
-		s.log.Infof("Active membership detected")
-		if err := s.insertActiveMember(tx, contactId, tagId); err != nil {
-			tx.Rollback()
-			return err
+	change, err := s.trackAccessChanges(tx, func() error {
+		switch params.MembershipStatus {
+		case webhooks.StatusLapsed:
+			s.log.Infof("Lapsed membership detected")
+			return s.deleteLapsedMember(tx, contactId)
+		case webhooks.StatusActive:
+			s.log.Infof("Active membership detected")
+			level := contact.LevelId()
+			if level == 0 {
+				level, _ = strconv.Atoi(params.MembershipLevelId)
+			}
+			return s.insertActiveMember(tx, contactId, tagId, level, contact.IsAccountAdministrator)
 		}
+		return nil
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.publishAccessChange(change)
+	return nil
 }
@@ -2,10 +2,17 @@ package services
 
 import (
 	"database/sql"
+	"fmt"
+	"io"
 	"rfid-backend/config"
+	"rfid-backend/db"
+	"rfid-backend/models"
+	"rfid-backend/tagformat"
 	"testing"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/sirupsen/logrus"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -16,93 +23,73 @@ func mockConfig() *config.Config {
 		CertFile:             "path/to/test/cert.pem",
 		KeyFile:              "path/to/test/key.pem",
 		DatabasePath:         "path/to/test/database.db",
-		RFIDFieldName:        "RFID",
+		TagIdFieldName:       "RFID",
 		TrainingFieldName:    "Training",
 		WildApricotAccountId: 12345,
 		ContactFilterQuery:   "status eq Active or status eq 'Pending - Renewal'",
 	}
 }
 
-func setupTestDB(t *testing.T) *sql.DB {
-	// Create an in-memory SQLite database
-	db, err := sql.Open("sqlite3", ":memory:")
-	require.NoError(t, err)
-
-	// Create Members table
-	_, err = db.Exec(`
-        CREATE TABLE IF NOT EXISTS members (
-            tag_id INTEGER PRIMARY KEY,
-            membership_level INTEGER NOT NULL
-        );`)
-	require.NoError(t, err)
-
-	// Create SafetyTrainings table
-	_, err = db.Exec(`
-        CREATE TABLE IF NOT EXISTS trainings (
-            label TEXT PRIMARY KEY
-        );`)
-	require.NoError(t, err)
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
 
-	// Create SafetyTrainingMembersLink table
-	_, err = db.Exec(`
-        CREATE TABLE IF NOT EXISTS members_trainings_link (
-            tag_id INTEGER NOT NULL,
-            label TEXT NOT NULL,
-            FOREIGN KEY (tag_id) REFERENCES members(tag_id),
-            FOREIGN KEY (label) REFERENCES trainings(label),
-            UNIQUE (tag_id, label)
-        );`)
+func setupTestDB(t *testing.T) *sql.DB {
+	// Create a named in-memory SQLite database with the real schema. The
+	// shared cache keeps every pooled connection on the same database.
+	database, err := db.InitDB(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name()))
 	require.NoError(t, err)
+	t.Cleanup(func() { database.Close() })
 
-	return db
+	return database
 }
 
-func TestGetAllRFIDs(t *testing.T) {
+func TestGetAllTagIds(t *testing.T) {
 	cfg := mockConfig()
 
 	db := setupTestDB(t)
-	defer db.Close()
 
 	// Insert test data into members table
-	_, err := db.Exec("INSERT INTO members (tag_id, membership_level) VALUES (11111, 1), (22222, 1)")
+	_, err := db.Exec("INSERT INTO members (contact_id, tag_id, membership_level) VALUES (1, 11111, 1), (2, 22222, 1)")
 	require.NoError(t, err)
 
-	dbService := NewDBService(db, cfg)
+	dbService := NewDBService(db, cfg, testLogger())
 
 	// Execute the test function
-	rfids, err := dbService.GetAllRFIDs()
+	tagIds, err := dbService.GetAllTagIds()
 
 	// Assertions
 	assert.NoError(t, err)
-	assert.Len(t, rfids, 2)
-	assert.Equal(t, uint32(11111), rfids[0])
-	assert.Equal(t, uint32(22222), rfids[1])
+	assert.Len(t, tagIds, 2)
+	assert.Equal(t, uint64(11111), tagIds[0])
+	assert.Equal(t, uint64(22222), tagIds[1])
 }
 
-func TestGetRFIDsForMachine(t *testing.T) {
+func TestGetTagIdsForTraining(t *testing.T) {
 	cfg := mockConfig()
 
 	db := setupTestDB(t)
-	defer db.Close()
 
 	// Insert test data into members table
-	_, err := db.Exec("INSERT INTO members (tag_id, membership_level) VALUES (12345, 1), (67890, 1)")
+	_, err := db.Exec("INSERT INTO members (contact_id, tag_id, membership_level) VALUES (1, 12345, 1), (2, 67890, 1)")
 	require.NoError(t, err)
 
 	// Insert test data into members_trainings_link table
 	_, err = db.Exec("INSERT INTO members_trainings_link (tag_id, label) VALUES (12345, 'MachineA'), (67890, 'MachineA')")
 	require.NoError(t, err)
 
-	dbService := NewDBService(db, cfg)
+	dbService := NewDBService(db, cfg, testLogger())
 
-	tags, err := dbService.GetRFIDsForMachine("MachineA")
+	tags, err := dbService.GetTagIdsForTraining("MachineA")
 	assert.NoError(t, err)
 	assert.Len(t, tags, 2)
-	assert.Equal(t, uint32(12345), tags[0])
-	assert.Equal(t, uint32(67890), tags[1])
+	assert.Equal(t, uint64(12345), tags[0])
+	assert.Equal(t, uint64(67890), tags[1])
 }
 
-func TestInsertOrUpdateMembers(t *testing.T) {
+func TestInsertOrUpdateAllMembers(t *testing.T) {
 	cfg := mockConfig()
 
 	db := setupTestDB(t)
@@ -111,10 +98,13 @@ func TestInsertOrUpdateMembers(t *testing.T) {
 	tx, err := db.Begin()
 	require.NoError(t, err)
 
-	dbService := NewDBService(db, cfg)
+	dbService := NewDBService(db, cfg, testLogger())
 
-	allRFIDs := []uint32{1234, 5678}
-	err = dbService.insertOrUpdateMembers(tx, allRFIDs)
+	allContacts := []int{1, 2}
+	allTagIds := []uint64{1234, 5678}
+	allLevels := []int{10, 20}
+	allAdmins := []bool{false, true}
+	err = dbService.insertOrUpdateAllMembers(tx, allContacts, allTagIds, allLevels, allAdmins)
 	assert.NoError(t, err)
 
 	// Commit the transaction
@@ -135,9 +125,9 @@ func TestInsertTrainings(t *testing.T) {
 	tx, err := db.Begin()
 	require.NoError(t, err)
 
-	dbService := NewDBService(db, cfg)
+	dbService := NewDBService(db, cfg, testLogger())
 
-	trainingMap := map[string][]uint32{
+	trainingMap := map[string][]uint64{
 		"Metal Lathe": {1234},
 		"CNC":         {5678},
 	}
@@ -163,9 +153,9 @@ func TestManageMemberTrainingLinks(t *testing.T) {
 	tx, err := db.Begin()
 	require.NoError(t, err)
 
-	dbService := NewDBService(db, cfg)
+	dbService := NewDBService(db, cfg, testLogger())
 
-	trainingMap := map[string][]uint32{
+	trainingMap := map[string][]uint64{
 		"Metal Lathe": {1234},
 		"CNC":         {5678},
 	}
@@ -179,27 +169,26 @@ func TestManageMemberTrainingLinks(t *testing.T) {
 	var count int
 	err = db.QueryRow("SELECT COUNT(*) FROM members_trainings_link").Scan(&count)
 	assert.NoError(t, err)
-	assert.Equal(t, 2, count) // Assuming each training has one RFID
+	assert.Equal(t, 2, count) // Assuming each training has one tag
 }
 
 func TestDeleteInactiveMembers(t *testing.T) {
 	cfg := mockConfig()
 
 	db := setupTestDB(t)
-	defer db.Close()
 
 	// Insert 2 test members into members table
-	_, err := db.Exec("INSERT INTO members (tag_id, membership_level) VALUES (1234, 1), (67890, 1)")
+	_, err := db.Exec("INSERT INTO members (contact_id, tag_id, membership_level) VALUES (1, 1234, 1), (2, 67890, 1)")
 	require.NoError(t, err)
 
 	// Start a transaction
 	tx, err := db.Begin()
 	require.NoError(t, err)
 
-	dbService := NewDBService(db, cfg)
+	dbService := NewDBService(db, cfg, testLogger())
 
-	allRFIDs := []uint32{1234} // only 1 active member, remove the inactive record
-	err = dbService.deleteInactiveMembers(tx, allRFIDs)
+	allContacts := []int{1} // only 1 active member, remove the inactive record
+	err = dbService.deleteInactiveMembers(tx, allContacts)
 	assert.NoError(t, err)
 
 	// Commit the transaction
@@ -212,3 +201,34 @@ func TestDeleteInactiveMembers(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, 1, count) // Expect only 1 active member in the table
 }
+
+func TestTagNotationsMatch(t *testing.T) {
+	db := setupTestDB(t)
+	dbService := NewDBService(db, mockConfig(), testLogger())
+
+	// A member enters their fob in Wild Apricot as facility and card number
+	contact := models.Contact{Id: 1, FieldValues: []models.FieldValue{{FieldName: "RFID", Value: "123:45678"}}}
+	contactId, tagId, _, err := contact.ExtractContactData(dbService.cfg, dbService.tags)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(8106606), tagId)
+	_, err = db.Exec("INSERT INTO members (contact_id, tag_id, membership_level) VALUES (?, ?, 1)", contactId, tagId)
+	require.NoError(t, err)
+
+	door := models.DeviceDetails{Name: "Front Door", Type: models.DeviceTypeDoor, Enabled: true}
+	require.NoError(t, dbService.CreateDevice("AA:AA:AA:AA:AA:AA", door))
+	_, err = dbService.ApproveDevice("AA:AA:AA:AA:AA:AA", door)
+	require.NoError(t, err)
+	device, err := dbService.GetDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+
+	// Readers send whatever they decoded
+	for _, raw := range []string{"8106606", "0b10111101110110010011011101", "123-45678"} {
+		decision, err := dbService.AuthorizeTagAt(*device, raw, time.Now())
+		require.NoError(t, err, raw)
+		assert.True(t, decision.Granted, raw)
+	}
+
+	decision, err := dbService.AuthorizeTagAt(*device, "0b10111101110110010011011100", time.Now())
+	assert.ErrorIs(t, err, tagformat.ErrInvalidTag)
+	assert.False(t, decision.Granted)
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"rfid-backend/models"
+	"strings"
+)
+
+var (
+	// ErrDeviceNotFound is returned when an operation targets an unregistered MAC.
+	ErrDeviceNotFound = errors.New("device not found")
+	// ErrDeviceNotApproved is returned when rotating the credential of a device
+	// that has not been approved.
+	ErrDeviceNotApproved = errors.New("device not approved")
+	// ErrInvalidEnrollmentCode is returned when a device presents the wrong
+	// enrollment code.
+	ErrInvalidEnrollmentCode = errors.New("invalid enrollment code")
+)
+
+// enrollmentCodeBytes is the randomness in an enrollment code, which an
+// admin may have to type into a reader by hand.
+const enrollmentCodeBytes = 10
+
+// IssueDeviceCredential gives an approved device a one-time enrollment
+// code, replacing any credential it had. The code is shown to the admin
+// once and only its hash is kept; the device presents it to
+// EnrollDevice to collect its credential.
+func (s *DBService) IssueDeviceCredential(mac string) (string, error) {
+	device, err := s.GetDevice(mac)
+	if err != nil {
+		return "", err
+	}
+	if device == nil {
+		return "", ErrDeviceNotFound
+	}
+	if !device.IsApproved() {
+		return "", ErrDeviceNotApproved
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", err
+	}
+
+	code, err := s.issueEnrollmentCode(tx, mac)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	return code, tx.Commit()
+}
+
+func (s *DBService) issueEnrollmentCode(tx *sql.Tx, mac string) (string, error) {
+	code, err := generateEnrollmentCode()
+	if err != nil {
+		return "", err
+	}
+
+	res, err := tx.Exec(SetEnrollmentCodeQuery, hashDeviceSecret(code), mac)
+	if err != nil {
+		return "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", ErrDeviceNotFound
+	}
+
+	s.log.Infof("Issued enrollment code for device %s", mac)
+	return code, nil
+}
+
+// RevokeDeviceCredential removes the device's credential and returns it to
+// pending, so its requests are rejected until an admin approves it again.
+func (s *DBService) RevokeDeviceCredential(mac string) error {
+	res, err := s.db.Exec(RevokeDeviceCredentialQuery, mac)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrDeviceNotFound
+	}
+
+	s.log.Infof("Revoked credential for device %s", mac)
+	s.publishDeviceReset(mac)
+	return nil
+}
+
+// EnrollDevice exchanges the device's enrollment code for its credential.
+// Each code works once. It returns an empty secret when no code is waiting
+// or another request used it first.
+func (s *DBService) EnrollDevice(device models.Device, code string) (string, error) {
+	if device.EnrollmentHash == "" {
+		return "", nil
+	}
+	if subtle.ConstantTimeCompare([]byte(hashDeviceSecret(normalizeEnrollmentCode(code))), []byte(device.EnrollmentHash)) != 1 {
+		return "", ErrInvalidEnrollmentCode
+	}
+
+	secret, err := generateDeviceSecret()
+	if err != nil {
+		return "", err
+	}
+	res, err := s.db.Exec(EnrollDeviceQuery, hashDeviceSecret(secret), device.MACAddress, device.EnrollmentHash)
+	if err != nil {
+		return "", err
+	}
+	// Another request used the code first
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", nil
+	}
+
+	s.log.Infof("Device %s collected its credential", device.MACAddress)
+	return secret, nil
+}
+
+// VerifyDeviceCredential returns the device if secret matches its issued
+// credential, or nil otherwise.
+func (s *DBService) VerifyDeviceCredential(mac, secret string) (*models.Device, error) {
+	device, err := s.GetDevice(mac)
+	if err != nil || device == nil {
+		return nil, err
+	}
+
+	if device.SecretHash == "" {
+		return nil, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashDeviceSecret(secret)), []byte(device.SecretHash)) != 1 {
+		return nil, nil
+	}
+	return device, nil
+}
+
+func generateDeviceSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// generateEnrollmentCode returns a code such as "ABCD-EFGH-IJKL-MNOP".
+func generateEnrollmentCode() (string, error) {
+	b := make([]byte, enrollmentCodeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return normalizeEnrollmentCode(base32.StdEncoding.EncodeToString(b)), nil
+}
+
+// normalizeEnrollmentCode accepts codes typed in any case, with or without
+// separators.
+func normalizeEnrollmentCode(code string) string {
+	code = strings.ToUpper(strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code))
+	var groups []string
+	for len(code) > 4 {
+		groups = append(groups, code[:4])
+		code = code[4:]
+	}
+	return strings.Join(append(groups, code), "-")
+}
+
+func hashDeviceSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
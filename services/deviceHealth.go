@@ -0,0 +1,50 @@
+package services
+
+import (
+	"encoding/json"
+	"rfid-backend/models"
+	"time"
+)
+
+// RecordHeartbeat stores the status a reader reported about itself.
+func (s *DBService) RecordHeartbeat(mac string, hb models.Heartbeat) error {
+	stats := []byte("{}")
+	if hb.Stats != nil {
+		var err error
+		if stats, err = json.Marshal(hb.Stats); err != nil {
+			return err
+		}
+	}
+
+	_, err := s.db.Exec(RecordHeartbeatQuery, hb.FirmwareVersion, hb.UptimeSeconds, hb.CacheVersion, string(stats), mac)
+	return err
+}
+
+// UpdateDeviceHealth marks approved devices online or offline based on when
+// they were last heard from, and returns the devices whose state changed.
+func (s *DBService) UpdateDeviceHealth(offlineAfter time.Duration) ([]models.Device, error) {
+	devices, err := s.GetDevices()
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []models.Device
+	for _, device := range devices {
+		if !device.IsApproved() {
+			continue
+		}
+
+		online := !device.LastSeen.IsZero() && time.Since(device.LastSeen) < offlineAfter
+		if online == device.Online {
+			continue
+		}
+
+		if _, err := s.db.Exec(SetDeviceOnlineQuery, online, device.MACAddress); err != nil {
+			return changed, err
+		}
+		device.Online = online
+		changed = append(changed, device)
+	}
+
+	return changed, nil
+}
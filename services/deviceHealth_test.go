@@ -0,0 +1,50 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"rfid-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateDeviceHealthTracksHeartbeats(t *testing.T) {
+	db := setupTestDB(t)
+	dbService := NewDBService(db, mockConfig(), testLogger())
+
+	require.NoError(t, dbService.InsertDevice("10.0.0.5", "AA:AA:AA:AA:AA:AA", 0))
+	_, err := dbService.ApproveDevice("AA:AA:AA:AA:AA:AA", models.DeviceDetails{Name: "Front Door", Location: "Lobby", Type: models.DeviceTypeDoor, Enabled: true})
+	require.NoError(t, err)
+
+	require.NoError(t, dbService.RecordHeartbeat("AA:AA:AA:AA:AA:AA", models.Heartbeat{
+		FirmwareVersion: "1.4.2",
+		UptimeSeconds:   600,
+		CacheVersion:    "42",
+		Stats:           map[string]interface{}{"reads": 7},
+	}))
+
+	changed, err := dbService.UpdateDeviceHealth(time.Minute)
+	require.NoError(t, err)
+	require.Len(t, changed, 1)
+	assert.True(t, changed[0].Online)
+
+	device, err := dbService.GetDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+	assert.True(t, device.Online)
+	assert.Equal(t, "1.4.2", device.FirmwareVersion)
+	assert.Equal(t, int64(600), device.UptimeSeconds)
+	assert.JSONEq(t, `{"reads": 7}`, device.Stats)
+
+	// No change means no transition to report
+	changed, err = dbService.UpdateDeviceHealth(time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+
+	// Anything heard from longer ago than the threshold is offline
+	changed, err = dbService.UpdateDeviceHealth(0)
+	require.NoError(t, err)
+	require.Len(t, changed, 1)
+	assert.False(t, changed[0].Online)
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"errors"
+	"rfid-backend/models"
+)
+
+// ErrNothingToRestore is returned when restoring a device that is neither in
+// maintenance nor decommissioned.
+var ErrNothingToRestore = errors.New("device is in service")
+
+// DecommissionDevice takes a device out of service for good. Its credential
+// is removed and further registrations are refused, but the record and its
+// audit trail are kept.
+func (s *DBService) DecommissionDevice(mac string) error {
+	res, err := s.db.Exec(DecommissionDeviceQuery, mac)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrDeviceNotFound
+	}
+
+	s.log.Infof("Decommissioned device %s", mac)
+	s.publishDeviceReset(mac)
+	return nil
+}
+
+// SetDeviceMaintenance locks an approved device out until it is restored.
+// Every swipe is denied and its cache is emptied.
+func (s *DBService) SetDeviceMaintenance(mac, reason string) error {
+	device, err := s.GetDevice(mac)
+	if err != nil {
+		return err
+	}
+	if device == nil {
+		return ErrDeviceNotFound
+	}
+	if !device.IsApproved() {
+		return ErrDeviceNotApproved
+	}
+
+	if _, err := s.db.Exec(SetDeviceMaintenanceQuery, true, reason, mac); err != nil {
+		return err
+	}
+	s.publishDeviceReset(mac)
+	return nil
+}
+
+// RestoreDevice ends maintenance, or returns a decommissioned device to
+// pending so it can be approved again. It reports what was restored.
+func (s *DBService) RestoreDevice(mac string) (string, error) {
+	device, err := s.GetDevice(mac)
+	if err != nil {
+		return "", err
+	}
+	if device == nil {
+		return "", ErrDeviceNotFound
+	}
+
+	switch {
+	case device.InMaintenance:
+		if _, err := s.db.Exec(SetDeviceMaintenanceQuery, false, "", mac); err != nil {
+			return "", err
+		}
+		s.publishDeviceReset(mac)
+		return "maintenance ended", nil
+	case device.Status == models.DeviceStatusDecommissioned:
+		_, err = s.db.Exec(SetDeviceStatusQuery, models.DeviceStatusPending, mac)
+		return "returned to pending approval", err
+	default:
+		return "", ErrNothingToRestore
+	}
+}
+
+// RecordDeviceAudit appends an admin action to the device audit trail.
+func (s *DBService) RecordDeviceAudit(mac, action, detail, actor string) error {
+	_, err := s.db.Exec(InsertDeviceAuditQuery, mac, action, detail, actor)
+	return err
+}
+
+func (s *DBService) GetDeviceAudit(mac string) ([]models.DeviceAuditEntry, error) {
+	return s.fetchDeviceAudit(GetDeviceAuditQuery, mac)
+}
+
+func (s *DBService) GetRecentDeviceAudit(limit int) ([]models.DeviceAuditEntry, error) {
+	return s.fetchDeviceAudit(GetRecentDeviceAuditQuery, limit)
+}
+
+func (s *DBService) fetchDeviceAudit(query string, args ...interface{}) ([]models.DeviceAuditEntry, error) {
+	var entries []models.DeviceAuditEntry
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.DeviceAuditEntry
+		if err := rows.Scan(&e.ID, &e.MACAddress, &e.Action, &e.Detail, &e.Actor, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"testing"
+
+	"rfid-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenanceDecommissionAndRestore(t *testing.T) {
+	db := setupTestDB(t)
+	dbService := NewDBService(db, mockConfig(), testLogger())
+
+	_, err := db.Exec("INSERT INTO members (contact_id, tag_id, membership_level) VALUES (1, 111, 1)")
+	require.NoError(t, err)
+
+	require.NoError(t, dbService.InsertDevice("10.0.0.5", "AA:AA:AA:AA:AA:AA", 0))
+	_, err = dbService.ApproveDevice("AA:AA:AA:AA:AA:AA", models.DeviceDetails{Name: "Front Door", Type: models.DeviceTypeDoor, Enabled: true})
+	require.NoError(t, err)
+
+	_, err = dbService.RestoreDevice("AA:AA:AA:AA:AA:AA")
+	assert.Equal(t, ErrNothingToRestore, err)
+
+	require.NoError(t, dbService.SetDeviceMaintenance("AA:AA:AA:AA:AA:AA", "lock replaced"))
+	device, err := dbService.GetDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+	assert.Equal(t, "lock replaced", device.MaintenanceReason)
+
+	decision, err := dbService.AuthorizeTag(*device, "111")
+	require.NoError(t, err)
+	assert.Equal(t, models.Deny("device in maintenance"), decision)
+
+	restored, err := dbService.RestoreDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+	assert.Equal(t, "maintenance ended", restored)
+
+	device, err = dbService.GetDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+	decision, err = dbService.AuthorizeTag(*device, "111")
+	require.NoError(t, err)
+	assert.True(t, decision.Granted)
+
+	require.NoError(t, dbService.DecommissionDevice("AA:AA:AA:AA:AA:AA"))
+	device, err = dbService.GetDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+	assert.Equal(t, models.DeviceStatusDecommissioned, device.Status)
+	assert.Equal(t, "none", device.CredentialStatus())
+	assert.Equal(t, ErrDeviceNotApproved, dbService.SetDeviceMaintenance("AA:AA:AA:AA:AA:AA", "again"))
+
+	restored, err = dbService.RestoreDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+	assert.Equal(t, "returned to pending approval", restored)
+
+	require.NoError(t, dbService.RecordDeviceAudit("AA:AA:AA:AA:AA:AA", models.DeviceActionDecommissioned, "", "admin"))
+	require.NoError(t, dbService.RecordDeviceAudit("AA:AA:AA:AA:AA:AA", models.DeviceActionRestored, restored, "admin"))
+
+	entries, err := dbService.GetDeviceAudit("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, models.DeviceActionRestored, entries[0].Action)
+	assert.Equal(t, "admin", entries[0].Actor)
+	assert.False(t, entries[0].CreatedAt.IsZero())
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"rfid-backend/models"
+)
+
+// RecordDeviceSeen stamps the device's last contact and moves it to ip. The
+// MAC address is the device's identity, so a new DHCP lease just updates the
+// row; a warning is logged if another device still claims the same address.
+func (s *DBService) RecordDeviceSeen(device models.Device, ip string) error {
+	if _, err := s.db.Exec(RecordDeviceSeenQuery, ip, device.MACAddress); err != nil {
+		return err
+	}
+
+	if device.IPAddress == ip {
+		return nil
+	}
+	s.log.Infof("Device %s moved from IP %s to %s", device.MACAddress, device.IPAddress, ip)
+
+	rows, err := s.db.Query(GetDevicesAtIPQuery, ip, device.MACAddress)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var other string
+		if err := rows.Scan(&other); err != nil {
+			return err
+		}
+		s.log.Warnf("IP conflict: devices %s and %s both report IP %s", device.MACAddress, other, ip)
+	}
+	return rows.Err()
+}
+
+// RecordRegistration notes the address an unauthenticated registration for
+// device came from. Anyone can send one, so it never moves the device's
+// recorded IP; a registration from elsewhere is only flagged.
+func (s *DBService) RecordRegistration(device models.Device, ip string) error {
+	if _, err := s.db.Exec(RecordRegistrationQuery, ip, device.MACAddress); err != nil {
+		return err
+	}
+	if device.IPAddress != ip {
+		s.log.Warnf("Device %s registered from %s but is recorded at %s", device.MACAddress, ip, device.IPAddress)
+	}
+	return nil
+}
+
+// GetIPConflicts maps each IP address claimed by more than one device to the
+// MAC addresses claiming it.
+func (s *DBService) GetIPConflicts() (map[string][]string, error) {
+	conflicts := make(map[string][]string)
+
+	rows, err := s.db.Query(GetIPConflictsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ip, mac string
+		if err := rows.Scan(&ip, &mac); err != nil {
+			return nil, err
+		}
+		conflicts[ip] = append(conflicts[ip], mac)
+	}
+
+	return conflicts, rows.Err()
+}
+
+// ApproveDevice moves a pending or rejected device into service with the
+// given details, links it to its trainings and returns the one-time
+// enrollment code the device presents to collect its credential.
+func (s *DBService) ApproveDevice(mac string, details models.DeviceDetails) (string, error) {
+	if err := validateDeviceDetails(details); err != nil {
+		return "", err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", err
+	}
+
+	res, err := tx.Exec(ApproveDeviceQuery, details.Name, details.Location, details.Type, details.Notes, details.Enabled, mac)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return "", ErrDeviceNotFound
+	}
+
+	if err := s.setDeviceTrainings(tx, mac, details.TrainingMode, details.TrainingLabels); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	code, err := s.issueEnrollmentCode(tx, mac)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	s.log.Infof("Approved %s %s as %q at %q", details.Type, mac, details.Name, details.Location)
+	return code, nil
+}
+
+// RejectDevice refuses a registration. Rejected devices stay on record so
+// repeated registrations from the same MAC are turned away.
+func (s *DBService) RejectDevice(mac string) error {
+	res, err := s.db.Exec(SetDeviceStatusQuery, models.DeviceStatusRejected, mac)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrDeviceNotFound
+	}
+
+	if _, err := s.db.Exec(SetEnrollmentCodeQuery, nil, mac); err != nil {
+		return err
+	}
+
+	s.log.Infof("Rejected device %s", mac)
+	return nil
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"rfid-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordDeviceSeenFollowsIPChanges(t *testing.T) {
+	db := setupTestDB(t)
+	dbService := NewDBService(db, mockConfig(), testLogger())
+
+	require.NoError(t, dbService.InsertDevice("10.0.0.5", "AA:AA:AA:AA:AA:AA", 0))
+	require.NoError(t, dbService.InsertDevice("10.0.0.6", "BB:BB:BB:BB:BB:BB", 0))
+
+	// Re-registering under a new lease updates the existing row
+	device, err := dbService.GetDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+	require.NoError(t, dbService.RecordDeviceSeen(*device, "10.0.0.7"))
+
+	device, err = dbService.GetDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.7", device.IPAddress)
+	assert.False(t, device.LastSeen.IsZero())
+
+	conflicts, err := dbService.GetIPConflicts()
+	require.NoError(t, err)
+	assert.Empty(t, conflicts)
+
+	// A lease handed to a device whose old row still holds the address is a conflict
+	require.NoError(t, dbService.RecordDeviceSeen(*device, "10.0.0.6"))
+
+	conflicts, err = dbService.GetIPConflicts()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"AA:AA:AA:AA:AA:AA", "BB:BB:BB:BB:BB:BB"}, conflicts["10.0.0.6"])
+}
+
+func TestEnrollDeviceWithOneTimeCode(t *testing.T) {
+	db := setupTestDB(t)
+	dbService := NewDBService(db, mockConfig(), testLogger())
+
+	require.NoError(t, dbService.InsertDevice("10.0.0.5", "AA:AA:AA:AA:AA:AA", 0))
+	code, err := dbService.ApproveDevice("AA:AA:AA:AA:AA:AA", models.DeviceDetails{Name: "Front Door", Type: models.DeviceTypeDoor, Enabled: true})
+	require.NoError(t, err)
+	assert.Regexp(t, `^[A-Z2-7]{4}-[A-Z2-7]{4}-[A-Z2-7]{4}-[A-Z2-7]{4}$`, code)
+
+	device, err := dbService.GetDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+	assert.Equal(t, "issued", device.CredentialStatus())
+	assert.NotContains(t, device.EnrollmentHash, code, "only the code's hash is stored")
+
+	_, err = dbService.EnrollDevice(*device, "AAAA-BBBB-CCCC-DDDD")
+	assert.Equal(t, ErrInvalidEnrollmentCode, err)
+
+	// Codes may be typed without separators and in any case
+	secret, err := dbService.EnrollDevice(*device, strings.ToLower(strings.ReplaceAll(code, "-", "")))
+	require.NoError(t, err)
+	require.NotEmpty(t, secret)
+	verified, err := dbService.VerifyDeviceCredential("AA:AA:AA:AA:AA:AA", secret)
+	require.NoError(t, err)
+	require.NotNil(t, verified)
+	assert.Equal(t, "active", verified.CredentialStatus())
+
+	// The code works once
+	again, err := dbService.EnrollDevice(*device, code)
+	require.NoError(t, err)
+	assert.Empty(t, again)
+}
+
+func TestRecordRegistrationKeepsRecordedIP(t *testing.T) {
+	db := setupTestDB(t)
+	dbService := NewDBService(db, mockConfig(), testLogger())
+
+	require.NoError(t, dbService.InsertDevice("10.0.0.5", "AA:AA:AA:AA:AA:AA", 0))
+	device, err := dbService.GetDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+
+	// Anyone can post a pending device's MAC; the sender is only noted
+	require.NoError(t, dbService.RecordRegistration(*device, "10.0.0.66"))
+	device, err = dbService.GetDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.5", device.IPAddress)
+	assert.Equal(t, "10.0.0.66", device.RegisteredFrom)
+}
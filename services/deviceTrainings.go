@@ -0,0 +1,128 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"rfid-backend/models"
+	"sort"
+)
+
+var ErrInvalidTrainingMode = errors.New("training mode must be \"all\" or \"any\"")
+
+// GetDeviceRequirement returns the trainings a member needs to use device.
+func (s *DBService) GetDeviceRequirement(device models.Device) (models.TrainingRequirement, error) {
+	req := models.TrainingRequirement{Mode: device.TrainingMode}
+
+	labels, err := s.GetDeviceTrainingLabels(device.MACAddress)
+	req.Labels = labels
+	return req, err
+}
+
+// SetDeviceTrainings replaces the trainings linked to a device and how they
+// combine.
+func (s *DBService) SetDeviceTrainings(mac, mode string, labels []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := s.setDeviceTrainings(tx, mac, mode, labels); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.publishDeviceReset(mac)
+	return nil
+}
+
+func (s *DBService) setDeviceTrainings(tx *sql.Tx, mac, mode string, labels []string) error {
+	if mode == "" {
+		mode = models.TrainingModeAll
+	}
+	if !models.ValidTrainingMode(mode) {
+		return ErrInvalidTrainingMode
+	}
+
+	if _, err := tx.Exec(SetDeviceTrainingModeQuery, mode, mac); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(DeleteDeviceTrainingLinkQuery, mac); err != nil {
+		return err
+	}
+
+	insertStmt, err := tx.Prepare(InsertDeviceTrainingLinkQuery)
+	if err != nil {
+		return err
+	}
+	defer insertStmt.Close()
+
+	for _, label := range labels {
+		if _, err := insertStmt.Exec(mac, label); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetEligibleTagIds returns the tags of every member who meets req, with
+// prerequisites and implied trainings applied.
+func (s *DBService) GetEligibleTagIds(req models.TrainingRequirement) ([]uint64, error) {
+	if len(req.Labels) == 0 {
+		return s.GetAllTagIds()
+	}
+
+	snapshot, err := accessSnapshot(s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	var tagIds []uint64
+	for tagId, labels := range snapshot {
+		if req.SatisfiedBy(labels) {
+			tagIds = append(tagIds, tagId)
+		}
+	}
+	sort.Slice(tagIds, func(i, j int) bool { return tagIds[i] < tagIds[j] })
+	return tagIds, nil
+}
+
+// GetTagTrainingLabels returns the trainings that count for a tag: those it
+// holds that have not expired and whose prerequisites it holds, plus the
+// trainings they imply.
+func (s *DBService) GetTagTrainingLabels(tagId uint64) ([]string, error) {
+	labels, err := s.tagLabels(GetTagTrainingLabelsQuery, tagId)
+	if err != nil {
+		return nil, err
+	}
+
+	graph, err := s.GetTrainingGraph()
+	if err != nil {
+		return nil, err
+	}
+	return graph.Effective(labels), nil
+}
+
+// tagLabels runs a query listing a tag's training labels.
+func (s *DBService) tagLabels(query string, tagId uint64) ([]string, error) {
+	var labels []string
+
+	rows, err := s.db.Query(query, tagId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var label string
+		if err := rows.Scan(&label); err != nil {
+			return nil, err
+		}
+		labels = append(labels, label)
+	}
+
+	return labels, rows.Err()
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"testing"
+
+	"rfid-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompoundTrainingRequirements(t *testing.T) {
+	db := setupTestDB(t)
+	dbService := NewDBService(db, mockConfig(), testLogger())
+
+	_, err := db.Exec("INSERT INTO members (contact_id, tag_id, membership_level) VALUES (1, 111, 1), (2, 222, 1), (3, 333, 1)")
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO members_trainings_link (tag_id, label) VALUES
+		(111, 'Lathe'), (111, 'Metal Shop'),
+		(222, 'Lathe'),
+		(333, 'Metal Shop')`)
+	require.NoError(t, err)
+
+	require.NoError(t, dbService.InsertDevice("10.0.0.5", "AA:AA:AA:AA:AA:AA", 0))
+	_, err = dbService.ApproveDevice("AA:AA:AA:AA:AA:AA", models.DeviceDetails{
+		Name:           "Lathe",
+		Location:       "Metal Shop",
+		Type:           models.DeviceTypeMachine,
+		Enabled:        true,
+		TrainingMode:   models.TrainingModeAll,
+		TrainingLabels: []string{"Lathe", "Metal Shop"},
+	})
+	require.NoError(t, err)
+
+	device, err := dbService.GetDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+	req, err := dbService.GetDeviceRequirement(*device)
+	require.NoError(t, err)
+
+	tags, err := dbService.GetEligibleTagIds(req)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{111}, tags)
+
+	decision, err := dbService.AuthorizeTag(*device, "111")
+	require.NoError(t, err)
+	assert.True(t, decision.Granted)
+
+	decision, err = dbService.AuthorizeTag(*device, "222")
+	require.NoError(t, err)
+	assert.Equal(t, models.Deny("missing training"), decision)
+
+	require.NoError(t, dbService.SetDeviceTrainings("AA:AA:AA:AA:AA:AA", models.TrainingModeAny, []string{"Lathe", "Metal Shop"}))
+
+	device, err = dbService.GetDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+	req, err = dbService.GetDeviceRequirement(*device)
+	require.NoError(t, err)
+
+	tags, err = dbService.GetEligibleTagIds(req)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []uint64{111, 222, 333}, tags)
+
+	decision, err = dbService.AuthorizeTag(*device, "222")
+	require.NoError(t, err)
+	assert.True(t, decision.Granted)
+
+	assert.Equal(t, ErrInvalidTrainingMode, dbService.SetDeviceTrainings("AA:AA:AA:AA:AA:AA", "most", nil))
+}
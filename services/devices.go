@@ -0,0 +1,129 @@
+package services
+
+import (
+	"errors"
+	"rfid-backend/models"
+)
+
+var (
+	ErrDeviceExists      = errors.New("device already exists")
+	ErrInvalidDeviceType = errors.New("device type must be door, machine or kiosk")
+)
+
+// CreateDevice records a device ahead of its first registration. It starts
+// out pending; once the reader registers from the network an admin approves
+// it like any other.
+func (s *DBService) CreateDevice(mac string, details models.DeviceDetails) error {
+	if err := validateDeviceDetails(details); err != nil {
+		return err
+	}
+
+	existing, err := s.GetDevice(mac)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return ErrDeviceExists
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(CreateDeviceQuery, mac, details.Name, details.Location, details.Type, details.Notes, details.Enabled); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := s.setDeviceTrainings(tx, mac, details.TrainingMode, details.TrainingLabels); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateDevice replaces a device's details and training requirement.
+func (s *DBService) UpdateDevice(mac string, details models.DeviceDetails) error {
+	if err := validateDeviceDetails(details); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(UpdateDeviceQuery, details.Name, details.Location, details.Type, details.Notes, details.Enabled, mac)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return ErrDeviceNotFound
+	}
+
+	if err := s.setDeviceTrainings(tx, mac, details.TrainingMode, details.TrainingLabels); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.publishDeviceReset(mac)
+	return nil
+}
+
+// DeleteDevice removes a device with its training links, schedules, unlock
+// window doors, device overrides and reservations, so none of them carry
+// over to a reader that later registers with the same MAC address. Its
+// credential goes with it, so the reader has to register and be approved
+// again.
+func (s *DBService) DeleteDevice(mac string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, query := range []string{
+		DeleteDeviceTrainingLinkQuery,
+		DeleteDeviceSchedulesQuery,
+		DeleteDeviceUnlockDoorsQuery,
+		DeleteDeviceOverridesQuery,
+		DeleteDeviceReservationsQuery,
+	} {
+		if _, err := tx.Exec(query, mac); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	res, err := tx.Exec(DeleteDeviceQuery, mac)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return ErrDeviceNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.publishDeviceReset(mac)
+	return nil
+}
+
+func validateDeviceDetails(details models.DeviceDetails) error {
+	if !models.ValidDeviceType(details.Type) {
+		return ErrInvalidDeviceType
+	}
+	if details.TrainingMode != "" && !models.ValidTrainingMode(details.TrainingMode) {
+		return ErrInvalidTrainingMode
+	}
+	return nil
+}
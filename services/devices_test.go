@@ -0,0 +1,90 @@
+package services
+
+import (
+	"testing"
+
+	"rfid-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceTypeAndEnabledFlag(t *testing.T) {
+	db := setupTestDB(t)
+	dbService := NewDBService(db, mockConfig(), testLogger())
+
+	_, err := db.Exec("INSERT INTO members (contact_id, tag_id, membership_level) VALUES (1, 111, 1)")
+	require.NoError(t, err)
+
+	door := models.DeviceDetails{Name: "Front Door", Location: "Lobby", Type: models.DeviceTypeDoor, Enabled: true}
+	require.NoError(t, dbService.CreateDevice("AA:AA:AA:AA:AA:AA", door))
+	assert.Equal(t, ErrDeviceExists, dbService.CreateDevice("AA:AA:AA:AA:AA:AA", door))
+
+	_, err = dbService.ApproveDevice("AA:AA:AA:AA:AA:AA", door)
+	require.NoError(t, err)
+
+	device, err := dbService.GetDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+	assert.True(t, device.IsDoor())
+
+	decision, err := dbService.AuthorizeTag(*device, "111")
+	require.NoError(t, err)
+	assert.True(t, decision.Granted)
+
+	// A machine without trainings admits nobody
+	machine := door
+	machine.Type = models.DeviceTypeMachine
+	require.NoError(t, dbService.UpdateDevice("AA:AA:AA:AA:AA:AA", machine))
+	device, err = dbService.GetDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+	decision, err = dbService.AuthorizeTag(*device, "111")
+	require.NoError(t, err)
+	assert.Equal(t, models.Deny("no training assigned"), decision)
+
+	door.Enabled = false
+	require.NoError(t, dbService.UpdateDevice("AA:AA:AA:AA:AA:AA", door))
+	device, err = dbService.GetDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+	decision, err = dbService.AuthorizeTag(*device, "111")
+	require.NoError(t, err)
+	assert.Equal(t, models.Deny("device disabled"), decision)
+
+	door.Type = "toaster"
+	assert.Equal(t, ErrInvalidDeviceType, dbService.UpdateDevice("AA:AA:AA:AA:AA:AA", door))
+
+	require.NoError(t, dbService.DeleteDevice("AA:AA:AA:AA:AA:AA"))
+	assert.Equal(t, ErrDeviceNotFound, dbService.DeleteDevice("AA:AA:AA:AA:AA:AA"))
+}
+
+func TestDeleteDeviceRemovesItsRecords(t *testing.T) {
+	db := setupTestDB(t)
+	dbService := NewDBService(db, mockConfig(), testLogger())
+
+	door := models.DeviceDetails{Name: "Front Door", Type: models.DeviceTypeDoor, Enabled: true}
+	require.NoError(t, dbService.CreateDevice("AA:AA:AA:AA:AA:AA", door))
+	require.NoError(t, dbService.CreateDevice("BB:BB:BB:BB:BB:BB", door))
+
+	_, err := db.Exec(`INSERT INTO schedules (id, name) VALUES (1, 'Weekdays');
+		INSERT INTO schedule_assignments (target_type, target, schedule_id) VALUES
+			('device', 'AA:AA:AA:AA:AA:AA', 1), ('unlock', 'AA:AA:AA:AA:AA:AA', 1), ('device', 'BB:BB:BB:BB:BB:BB', 1);
+		INSERT INTO unlock_windows (id, name, starts_at, ends_at) VALUES (1, 'Open house', '2030-01-01', '2030-01-02');
+		INSERT INTO unlock_window_doors (window_id, mac_address) VALUES (1, 'AA:AA:AA:AA:AA:AA'), (1, 'BB:BB:BB:BB:BB:BB');
+		INSERT INTO access_overrides (effect, tag_id, mac_address) VALUES ('allow', 111, 'AA:AA:AA:AA:AA:AA'), ('deny', 222, '');
+		INSERT INTO reservations (mac_address, contact_id, starts_at, ends_at) VALUES
+			('AA:AA:AA:AA:AA:AA', 1, '2030-01-01', '2030-01-02'), ('BB:BB:BB:BB:BB:BB', 1, '2030-01-01', '2030-01-02')`)
+	require.NoError(t, err)
+
+	require.NoError(t, dbService.DeleteDevice("AA:AA:AA:AA:AA:AA"))
+
+	// Nothing of the deleted device is left for a reader reusing its MAC
+	for table, remaining := range map[string]int{
+		"schedule_assignments": 1,
+		"unlock_window_doors":  1,
+		"access_overrides":     1,
+		"reservations":         1,
+	} {
+		var count int
+		require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM "+table).Scan(&count))
+		assert.Equal(t, remaining, count, table)
+	}
+}
@@ -0,0 +1,274 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"rfid-backend/models"
+	"time"
+)
+
+var (
+	ErrUnlockWindowNotFound = errors.New("unlock window not found")
+	ErrInvalidUnlockWindow  = errors.New("unlock window needs a name, at least one door and a window that ends after it starts")
+	ErrUnlockDoorInvalid    = errors.New("only approved doors can be unlocked")
+)
+
+// GetUnlockWindows returns every unlock window, latest start first.
+func (s *DBService) GetUnlockWindows() ([]models.UnlockWindow, error) {
+	doors := make(map[int64][]string)
+	doorRows, err := s.db.Query(GetUnlockWindowDoorsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer doorRows.Close()
+	for doorRows.Next() {
+		var (
+			id  int64
+			mac string
+		)
+		if err := doorRows.Scan(&id, &mac); err != nil {
+			return nil, err
+		}
+		doors[id] = append(doors[id], mac)
+	}
+	if err := doorRows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(GetUnlockWindowsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	windows := []models.UnlockWindow{}
+	for rows.Next() {
+		var w models.UnlockWindow
+		if err := rows.Scan(&w.ID, &w.Name, &w.StartsAt, &w.EndsAt, &w.EventId, &w.CreatedBy, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		w.Doors = doors[w.ID]
+		if w.Doors == nil {
+			w.Doors = []string{}
+		}
+		windows = append(windows, w)
+	}
+	return windows, rows.Err()
+}
+
+// CreateUnlockWindow saves a window holding approved doors unlocked.
+func (s *DBService) CreateUnlockWindow(w models.UnlockWindow) (int64, error) {
+	if w.Name == "" || len(w.Doors) == 0 || !w.EndsAt.After(w.StartsAt) {
+		return 0, ErrInvalidUnlockWindow
+	}
+	if err := s.checkUnlockDoors(w.Doors); err != nil {
+		return 0, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := insertUnlockWindow(tx, w)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// DeleteUnlockWindow removes an unlock window, ending it if it is open.
+func (s *DBService) DeleteUnlockWindow(id int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(DeleteUnlockWindowDoorsQuery, id); err != nil {
+		return err
+	}
+	res, err := tx.Exec(DeleteUnlockWindowQuery, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrUnlockWindowNotFound
+	}
+	return tx.Commit()
+}
+
+// DoorStateAt tells whether device should hold its door unlocked at the
+// given time. An unlocked space opens every door and a lockdown keeps them
+// all locked. Otherwise a door that is in service is unlocked by an open
+// unlock window covering it or by its unlock schedule.
+func (s *DBService) DoorStateAt(device models.Device, now time.Time) (models.DoorState, error) {
+	mode, err := s.GetSpaceMode()
+	if err != nil {
+		return models.DoorState{SpaceMode: models.SpaceModeNormal}, err
+	}
+	return s.doorState(device, mode, now)
+}
+
+// doorState is DoorStateAt for a space mode the caller already read.
+func (s *DBService) doorState(device models.Device, mode models.SpaceMode, now time.Time) (models.DoorState, error) {
+	state := models.DoorState{SpaceMode: mode.Mode}
+
+	if !device.IsDoor() {
+		return state, nil
+	}
+	switch mode.Mode {
+	case models.SpaceModeUnlocked:
+		state.Unlocked, state.Reason = true, "space unlocked"
+		return state, nil
+	case models.SpaceModeLockdown:
+		state.Reason = "space is in lockdown"
+		return state, nil
+	}
+	if decision := deviceDecision(device); !decision.Granted {
+		state.Reason = decision.Reason
+		return state, nil
+	}
+
+	windows, err := s.GetUnlockWindows()
+	if err != nil {
+		return state, err
+	}
+	for _, w := range windows {
+		if w.OpenAt(now) && w.Covers(device.MACAddress) && (state.Until == nil || w.EndsAt.After(*state.Until)) {
+			until := w.EndsAt
+			state.Unlocked, state.Reason, state.Until = true, w.Name, &until
+		}
+	}
+	if state.Unlocked {
+		return state, nil
+	}
+
+	scheduleId, err := s.targetSchedule(models.ScheduleTargetUnlock, device.MACAddress)
+	if err != nil || scheduleId == 0 {
+		return state, err
+	}
+	schedule, err := s.GetSchedule(scheduleId)
+	if err != nil || schedule == nil {
+		return state, err
+	}
+	if schedule.OpenAt(now, s.scheduleLocation(*schedule)) {
+		state.Unlocked, state.Reason = true, schedule.Name
+	}
+	return state, nil
+}
+
+// SyncEventUnlockWindows keeps an unlock window over the configured doors
+// for each upcoming public Wild Apricot event, opening event_unlock_lead
+// before it starts. Windows of events that were cancelled or made private
+// are removed unless they already ended. It returns how many events have a
+// window, and does nothing if no doors are configured.
+func (s *DBService) SyncEventUnlockWindows(events []models.Event, now time.Time) (int, error) {
+	if len(s.cfg.EventUnlockDoors) == 0 {
+		return 0, nil
+	}
+	if err := s.checkUnlockDoors(s.cfg.EventUnlockDoors); err != nil {
+		return 0, err
+	}
+
+	windows, err := s.GetUnlockWindows()
+	if err != nil {
+		return 0, err
+	}
+	existing := make(map[int]models.UnlockWindow)
+	for _, w := range windows {
+		if w.EventId != 0 {
+			existing[w.EventId] = w
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	synced := make(map[int]bool)
+	for _, event := range events {
+		if event.AccessLevel != models.EventAccessPublic || !event.EndDate.After(now) || !event.EndDate.After(event.StartDate) {
+			continue
+		}
+		w := models.UnlockWindow{
+			Name:      event.Name,
+			StartsAt:  event.StartDate.Add(-s.cfg.EventUnlockLead),
+			EndsAt:    event.EndDate,
+			Doors:     s.cfg.EventUnlockDoors,
+			EventId:   event.Id,
+			CreatedBy: "Wild Apricot",
+		}
+		synced[event.Id] = true
+
+		old, ok := existing[event.Id]
+		if !ok {
+			if _, err := insertUnlockWindow(tx, w); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if _, err := tx.Exec(UpdateEventUnlockWindowQuery, w.Name, w.StartsAt.UTC(), w.EndsAt.UTC(), old.ID); err != nil {
+			return 0, err
+		}
+		if err := replaceUnlockDoors(tx, old.ID, w.Doors); err != nil {
+			return 0, err
+		}
+	}
+
+	for eventId, w := range existing {
+		if synced[eventId] || !w.EndsAt.After(now) {
+			continue
+		}
+		if _, err := tx.Exec(DeleteUnlockWindowDoorsQuery, w.ID); err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec(DeleteUnlockWindowQuery, w.ID); err != nil {
+			return 0, err
+		}
+	}
+	return len(synced), tx.Commit()
+}
+
+func (s *DBService) checkUnlockDoors(macs []string) error {
+	for _, mac := range macs {
+		device, err := s.GetDevice(mac)
+		if err != nil {
+			return err
+		}
+		if device == nil || !device.IsDoor() || !device.IsApproved() {
+			return ErrUnlockDoorInvalid
+		}
+	}
+	return nil
+}
+
+func insertUnlockWindow(tx *sql.Tx, w models.UnlockWindow) (int64, error) {
+	res, err := tx.Exec(InsertUnlockWindowQuery, w.Name, w.StartsAt.UTC(), w.EndsAt.UTC(), nullableId(int64(w.EventId)),
+		w.CreatedBy, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return id, replaceUnlockDoors(tx, id, w.Doors)
+}
+
+func replaceUnlockDoors(tx *sql.Tx, id int64, doors []string) error {
+	if _, err := tx.Exec(DeleteUnlockWindowDoorsQuery, id); err != nil {
+		return err
+	}
+	for _, mac := range doors {
+		if _, err := tx.Exec(InsertUnlockWindowDoorQuery, id, mac); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"rfid-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDoorUnlocks(t *testing.T) {
+	db := setupTestDB(t)
+	dbService := NewDBService(db, mockConfig(), testLogger())
+
+	for mac, details := range map[string]models.DeviceDetails{
+		"AA:AA:AA:AA:AA:AA": {Name: "Front Door", Type: models.DeviceTypeDoor, Enabled: true},
+		"BB:BB:BB:BB:BB:BB": {Name: "Back Door", Type: models.DeviceTypeDoor, Enabled: true},
+		"CC:CC:CC:CC:CC:CC": {Name: "Laser", Type: models.DeviceTypeMachine, Enabled: true},
+	} {
+		require.NoError(t, dbService.CreateDevice(mac, details))
+		_, err := dbService.ApproveDevice(mac, details)
+		require.NoError(t, err)
+	}
+	front, err := dbService.GetDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+	back, err := dbService.GetDevice("BB:BB:BB:BB:BB:BB")
+	require.NoError(t, err)
+
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	mondayEvening := time.Date(2026, 10, 19, 19, 0, 0, 0, newYork)
+	mondayNight := time.Date(2026, 10, 19, 23, 0, 0, 0, newYork)
+
+	state := func(device *models.Device, at time.Time) models.DoorState {
+		state, err := dbService.DoorStateAt(*device, at)
+		require.NoError(t, err)
+		return state
+	}
+	assert.False(t, state(front, mondayEvening).Unlocked)
+
+	// Open hours on Monday evenings unlock the front door only
+	openHours := models.Schedule{
+		Name:     "Open hours",
+		Timezone: "America/New_York",
+		Windows:  []models.ScheduleWindow{{Weekday: 1, Start: "18:00", End: "21:00"}},
+	}
+	openHoursId, err := dbService.CreateSchedule(openHours)
+	require.NoError(t, err)
+	assert.Equal(t, ErrInvalidScheduleTarget, dbService.AssignSchedule(models.ScheduleTargetUnlock, "CC:CC:CC:CC:CC:CC", openHoursId))
+	require.NoError(t, dbService.AssignSchedule(models.ScheduleTargetUnlock, front.MACAddress, openHoursId))
+
+	assert.Equal(t, models.DoorState{Unlocked: true, Reason: "Open hours", SpaceMode: models.SpaceModeNormal}, state(front, mondayEvening))
+	assert.False(t, state(front, mondayNight).Unlocked)
+	assert.False(t, state(back, mondayEvening).Unlocked)
+
+	decision, err := dbService.AuthorizeTagAt(*front, "999", mondayEvening)
+	require.NoError(t, err)
+	assert.True(t, decision.Granted)
+	decision, err = dbService.AuthorizeTagAt(*front, "999", mondayNight)
+	require.NoError(t, err)
+	assert.False(t, decision.Granted)
+
+	// A window holds both doors open late and reports when it ends
+	_, err = dbService.CreateUnlockWindow(models.UnlockWindow{Name: "Bad", StartsAt: mondayNight, EndsAt: mondayEvening, Doors: []string{front.MACAddress}})
+	assert.Equal(t, ErrInvalidUnlockWindow, err)
+	_, err = dbService.CreateUnlockWindow(models.UnlockWindow{Name: "Bad", StartsAt: mondayEvening, EndsAt: mondayNight, Doors: []string{"CC:CC:CC:CC:CC:CC"}})
+	assert.Equal(t, ErrUnlockDoorInvalid, err)
+
+	late := models.UnlockWindow{
+		Name:      "Open house",
+		StartsAt:  mondayEvening,
+		EndsAt:    mondayNight.Add(time.Hour),
+		Doors:     []string{front.MACAddress, back.MACAddress},
+		CreatedBy: "Admin",
+	}
+	lateId, err := dbService.CreateUnlockWindow(late)
+	require.NoError(t, err)
+	backState := state(back, mondayNight)
+	assert.True(t, backState.Unlocked)
+	assert.Equal(t, "Open house", backState.Reason)
+	require.NotNil(t, backState.Until)
+	assert.True(t, late.EndsAt.Equal(*backState.Until))
+	assert.True(t, state(front, mondayNight).Unlocked)
+
+	// Lockdown keeps every door shut regardless
+	_, err = dbService.SetSpaceMode(models.SpaceModeLockdown, "", "Admin")
+	require.NoError(t, err)
+	assert.Equal(t, models.DoorState{Reason: "space is in lockdown", SpaceMode: models.SpaceModeLockdown}, state(back, mondayNight))
+	_, err = dbService.SetSpaceMode(models.SpaceModeNormal, "", "Admin")
+	require.NoError(t, err)
+
+	require.NoError(t, dbService.DeleteUnlockWindow(lateId))
+	assert.Equal(t, ErrUnlockWindowNotFound, dbService.DeleteUnlockWindow(lateId))
+	assert.False(t, state(back, mondayNight).Unlocked)
+}
+
+func TestSyncEventUnlockWindows(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := mockConfig()
+	dbService := NewDBService(db, cfg, testLogger())
+
+	door := models.DeviceDetails{Name: "Front Door", Type: models.DeviceTypeDoor, Enabled: true}
+	require.NoError(t, dbService.CreateDevice("AA:AA:AA:AA:AA:AA", door))
+	_, err := dbService.ApproveDevice("AA:AA:AA:AA:AA:AA", door)
+	require.NoError(t, err)
+	front, err := dbService.GetDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	workshop := models.Event{Id: 1, Name: "Intro to welding", StartDate: now.Add(2 * time.Hour), EndDate: now.Add(4 * time.Hour), AccessLevel: models.EventAccessPublic}
+	board := models.Event{Id: 2, Name: "Board meeting", StartDate: now.Add(2 * time.Hour), EndDate: now.Add(3 * time.Hour), AccessLevel: "Restricted"}
+
+	// Nothing happens until doors are configured
+	synced, err := dbService.SyncEventUnlockWindows([]models.Event{workshop, board}, now)
+	require.NoError(t, err)
+	assert.Zero(t, synced)
+
+	cfg.EventUnlockDoors = []string{front.MACAddress}
+	cfg.EventUnlockLead = 15 * time.Minute
+	synced, err = dbService.SyncEventUnlockWindows([]models.Event{workshop, board}, now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, synced)
+
+	windows, err := dbService.GetUnlockWindows()
+	require.NoError(t, err)
+	require.Len(t, windows, 1)
+	assert.Equal(t, "Intro to welding", windows[0].Name)
+	assert.Equal(t, 1, windows[0].EventId)
+	assert.Equal(t, []string{front.MACAddress}, windows[0].Doors)
+	assert.True(t, workshop.StartDate.Add(-15*time.Minute).Equal(windows[0].StartsAt))
+
+	opensAt := workshop.StartDate.Add(-10 * time.Minute)
+	doorState, err := dbService.DoorStateAt(*front, opensAt)
+	require.NoError(t, err)
+	assert.True(t, doorState.Unlocked)
+
+	// A rescheduled event moves its window rather than adding another
+	workshop.StartDate = workshop.StartDate.Add(time.Hour)
+	workshop.EndDate = workshop.EndDate.Add(time.Hour)
+	_, err = dbService.SyncEventUnlockWindows([]models.Event{workshop}, now)
+	require.NoError(t, err)
+	windows, err = dbService.GetUnlockWindows()
+	require.NoError(t, err)
+	require.Len(t, windows, 1)
+	assert.True(t, workshop.EndDate.Equal(windows[0].EndsAt))
+
+	// A cancelled event loses its window
+	_, err = dbService.SyncEventUnlockWindows(nil, now)
+	require.NoError(t, err)
+	windows, err = dbService.GetUnlockWindows()
+	require.NoError(t, err)
+	assert.Empty(t, windows)
+
+	cfg.EventUnlockDoors = []string{"ZZ:ZZ:ZZ:ZZ:ZZ:ZZ"}
+	_, err = dbService.SyncEventUnlockWindows([]models.Event{workshop}, now)
+	assert.Equal(t, ErrUnlockDoorInvalid, err)
+}
@@ -0,0 +1,242 @@
+package services
+
+import (
+	"errors"
+	"rfid-backend/models"
+	"time"
+)
+
+var (
+	ErrGuestPassNotFound = errors.New("guest pass not found")
+	ErrInvalidGuestPass  = errors.New("guest pass needs a name, tag, sponsor and a window that ends after it starts and has not passed")
+	ErrGuestTagInUse     = errors.New("tag belongs to a member or another guest pass")
+	ErrSponsorNotMember  = errors.New("sponsor is not a current member")
+	ErrGuestDoorInvalid  = errors.New("guest passes can only open approved doors")
+)
+
+// guestPass is a GuestPass with what the server knows beyond it: whether
+// readers were last told it is valid, and whether its sponsor is still a
+// member.
+type guestPass struct {
+	models.GuestPass
+	active        bool
+	sponsorActive bool
+}
+
+// validAt reports whether the pass admits its holder at t, which also needs
+// its sponsor to be a current member.
+func (g guestPass) validAt(t time.Time) bool {
+	return g.sponsorActive && g.ValidAt(t)
+}
+
+// GetGuestPasses returns every guest pass, latest start first, including
+// revoked and ended ones.
+func (s *DBService) GetGuestPasses() ([]models.GuestPass, error) {
+	passes, err := s.loadGuestPasses()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]models.GuestPass, 0, len(passes))
+	for _, g := range passes {
+		result = append(result, g.GuestPass)
+	}
+	return result, nil
+}
+
+// CreateGuestPass saves a guest pass. The sponsor must be a current member,
+// the tag must not be a member's or another unexpired pass's, and every
+// listed device must be an approved door. Readers learn of the pass when
+// SweepGuestPasses sees it start.
+func (s *DBService) CreateGuestPass(g models.GuestPass) (int64, error) {
+	if g.Name == "" || g.TagId == 0 || g.SponsorContactId == 0 || !g.EndsAt.After(g.StartsAt) || !g.EndsAt.After(time.Now()) {
+		return 0, ErrInvalidGuestPass
+	}
+
+	var sponsor bool
+	if err := s.db.QueryRow(MemberExistsQuery, g.SponsorContactId).Scan(&sponsor); err != nil {
+		return 0, err
+	}
+	if !sponsor {
+		return 0, ErrSponsorNotMember
+	}
+
+	var member bool
+	if err := s.db.QueryRow(TagExistsQuery, g.TagId).Scan(&member); err != nil {
+		return 0, err
+	}
+	if member {
+		return 0, ErrGuestTagInUse
+	}
+	passes, err := s.loadGuestPasses()
+	if err != nil {
+		return 0, err
+	}
+	for _, other := range passes {
+		if other.TagId == g.TagId && !other.Revoked && other.EndsAt.After(g.StartsAt) && g.EndsAt.After(other.StartsAt) {
+			return 0, ErrGuestTagInUse
+		}
+	}
+
+	for _, mac := range g.Doors {
+		device, err := s.GetDevice(mac)
+		if err != nil {
+			return 0, err
+		}
+		if device == nil || !device.IsDoor() || !device.IsApproved() {
+			return 0, ErrGuestDoorInvalid
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(InsertGuestPassQuery, g.Name, g.TagId, g.SponsorContactId, g.StartsAt.UTC(), g.EndsAt.UTC(), g.CreatedBy)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	for _, mac := range g.Doors {
+		if _, err := tx.Exec(InsertGuestPassDoorQuery, id, mac); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	// A pass that is already open should work straight away
+	if _, err := s.SweepGuestPasses(time.Now()); err != nil {
+		s.log.Errorf("Failed to publish guest pass %d: %v", id, err)
+	}
+	return id, nil
+}
+
+// RevokeGuestPass ends a guest pass early.
+func (s *DBService) RevokeGuestPass(id int64) error {
+	res, err := s.db.Exec(RevokeGuestPassQuery, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrGuestPassNotFound
+	}
+
+	_, err = s.SweepGuestPasses(time.Now())
+	return err
+}
+
+// SweepGuestPasses tells the doors a guest pass covers to reload their
+// caches when the pass starts, ends, is revoked or loses its sponsor. It
+// returns the passes whose state changed.
+func (s *DBService) SweepGuestPasses(now time.Time) ([]models.GuestPass, error) {
+	passes, err := s.loadGuestPasses()
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []models.GuestPass
+	for _, g := range passes {
+		valid := g.validAt(now)
+		if valid == g.active {
+			continue
+		}
+		if _, err := s.db.Exec(SetGuestPassActiveQuery, valid, g.ID); err != nil {
+			return changed, err
+		}
+		if len(g.Doors) == 0 {
+			s.publishDeviceReset("")
+		}
+		for _, mac := range g.Doors {
+			s.publishDeviceReset(mac)
+		}
+		changed = append(changed, g.GuestPass)
+	}
+	return changed, nil
+}
+
+// guestPassAt returns the guest pass admitting tagId at device at now, or
+// nil if there is none.
+func (s *DBService) guestPassAt(device models.Device, tagId uint64, now time.Time) (*models.GuestPass, error) {
+	passes, err := s.loadGuestPasses()
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range passes {
+		if g.TagId == tagId && g.validAt(now) && g.Admits(device) {
+			return &g.GuestPass, nil
+		}
+	}
+	return nil, nil
+}
+
+// guestTags returns the tags of guest passes admitting their holders at
+// device at now.
+func (s *DBService) guestTags(device models.Device, now time.Time) ([]uint64, error) {
+	if !device.IsDoor() {
+		return nil, nil
+	}
+	passes, err := s.loadGuestPasses()
+	if err != nil {
+		return nil, err
+	}
+
+	var tagIds []uint64
+	for _, g := range passes {
+		if g.validAt(now) && g.Admits(device) {
+			tagIds = append(tagIds, g.TagId)
+		}
+	}
+	return tagIds, nil
+}
+
+func (s *DBService) loadGuestPasses() ([]guestPass, error) {
+	doors := make(map[int64][]string)
+	doorRows, err := s.db.Query(GetGuestPassDoorsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer doorRows.Close()
+	for doorRows.Next() {
+		var (
+			id  int64
+			mac string
+		)
+		if err := doorRows.Scan(&id, &mac); err != nil {
+			return nil, err
+		}
+		doors[id] = append(doors[id], mac)
+	}
+	if err := doorRows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(GetGuestPassesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var passes []guestPass
+	for rows.Next() {
+		var g guestPass
+		if err := rows.Scan(&g.ID, &g.Name, &g.TagId, &g.SponsorContactId, &g.StartsAt, &g.EndsAt, &g.Revoked,
+			&g.active, &g.CreatedBy, &g.CreatedAt, &g.sponsorActive); err != nil {
+			return nil, err
+		}
+		g.Doors = doors[g.ID]
+		if g.Doors == nil {
+			g.Doors = []string{}
+		}
+		passes = append(passes, g)
+	}
+	return passes, rows.Err()
+}
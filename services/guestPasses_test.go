@@ -0,0 +1,84 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"rfid-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuestPasses(t *testing.T) {
+	db := setupTestDB(t)
+	dbService := NewDBService(db, mockConfig(), testLogger())
+
+	_, err := db.Exec("INSERT INTO members (contact_id, tag_id, membership_level) VALUES (1, 111, 1)")
+	require.NoError(t, err)
+
+	door := models.DeviceDetails{Name: "Front Door", Type: models.DeviceTypeDoor, Enabled: true}
+	for _, mac := range []string{"AA:AA:AA:AA:AA:AA", "BB:BB:BB:BB:BB:BB"} {
+		require.NoError(t, dbService.CreateDevice(mac, door))
+		_, err = dbService.ApproveDevice(mac, door)
+		require.NoError(t, err)
+	}
+	front, err := dbService.GetDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+	back, err := dbService.GetDevice("BB:BB:BB:BB:BB:BB")
+	require.NoError(t, err)
+
+	now := time.Now()
+	workshop := models.GuestPass{Name: "Workshop guest", TagId: 999, SponsorContactId: 1,
+		StartsAt: now.Add(-time.Hour), EndsAt: now.Add(3 * time.Hour), Doors: []string{front.MACAddress}, CreatedBy: "Admin"}
+
+	invalid := workshop
+	invalid.EndsAt = invalid.StartsAt
+	_, err = dbService.CreateGuestPass(invalid)
+	assert.Equal(t, ErrInvalidGuestPass, err)
+	invalid = workshop
+	invalid.SponsorContactId = 2
+	_, err = dbService.CreateGuestPass(invalid)
+	assert.Equal(t, ErrSponsorNotMember, err)
+	invalid = workshop
+	invalid.TagId = 111
+	_, err = dbService.CreateGuestPass(invalid)
+	assert.Equal(t, ErrGuestTagInUse, err)
+
+	id, err := dbService.CreateGuestPass(workshop)
+	require.NoError(t, err)
+	_, err = dbService.CreateGuestPass(workshop)
+	assert.Equal(t, ErrGuestTagInUse, err)
+
+	decide := func(device *models.Device, at time.Time) models.AccessDecision {
+		decision, err := dbService.AuthorizeTagAt(*device, "999", at)
+		require.NoError(t, err)
+		return decision
+	}
+	assert.True(t, decide(front, now).Granted)
+	assert.Equal(t, models.Deny("unknown tag"), decide(back, now))
+	assert.Equal(t, models.Deny("unknown tag"), decide(front, now.Add(4*time.Hour)))
+
+	tagIds, err := dbService.GetDeviceCacheTags(*front)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []uint64{111, 999}, tagIds)
+
+	// Syncs leave guests alone, but a lapsed sponsor takes the pass with them
+	cfg := mockConfig()
+	require.NoError(t, dbService.ProcessContactsData([]models.Contact{
+		{Id: 3, FieldValues: []models.FieldValue{{FieldName: cfg.TagIdFieldName, Value: "333"}}},
+	}))
+	passes, err := dbService.GetGuestPasses()
+	require.NoError(t, err)
+	require.Len(t, passes, 1)
+	assert.Equal(t, "Admin", passes[0].CreatedBy)
+	assert.Equal(t, models.Deny("unknown tag"), decide(front, now))
+
+	changed, err := dbService.SweepGuestPasses(now)
+	require.NoError(t, err)
+	require.Len(t, changed, 1)
+	assert.Equal(t, id, changed[0].ID)
+
+	require.NoError(t, dbService.RevokeGuestPass(id))
+	assert.Equal(t, ErrGuestPassNotFound, dbService.RevokeGuestPass(id+1))
+}
@@ -0,0 +1,247 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"rfid-backend/models"
+	"sort"
+	"time"
+)
+
+var (
+	ErrNotMachine         = errors.New("device is not a machine")
+	ErrMachineUnavailable = errors.New("machine is not approved, disabled or in maintenance")
+	ErrUnknownSessionTag  = errors.New("tag is not a member's or guest's and was not recently granted at the machine")
+	ErrNoOpenSession      = errors.New("machine has no running session")
+	ErrInvalidReport      = errors.New("usage report needs a range that ends after it starts")
+)
+
+const maxSessionsListed = 500
+
+// sessionGrantWindow is how long before a session starts a granted swipe at
+// the machine vouches for its tag.
+const sessionGrantWindow = 15 * time.Minute
+
+// StartMachineSession records a machine powering on for tagId at the given
+// time. The machine must be in service, and the tag must be a member's, a
+// guest's or granted at the machine shortly before. A session the controller
+// never reported as stopped, e.g. because it lost power, is closed at the new
+// start.
+func (s *DBService) StartMachineSession(device models.Device, tagId uint64, at time.Time) (int64, error) {
+	if device.Type != models.DeviceTypeMachine {
+		return 0, ErrNotMachine
+	}
+	if decision := deviceDecision(device); !decision.Granted {
+		return 0, ErrMachineUnavailable
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var known bool
+	err = tx.QueryRow(SessionTagKnownQuery, tagId, tagId, at.UTC(), at.UTC(),
+		device.MACAddress, tagId, at.Add(-sessionGrantWindow).UTC(), at.UTC()).Scan(&known)
+	if err != nil {
+		return 0, err
+	}
+	if !known {
+		return 0, ErrUnknownSessionTag
+	}
+
+	open, err := scanMachineSession(tx.QueryRow(GetOpenMachineSessionQuery, device.MACAddress))
+	switch {
+	case err == nil:
+		s.log.Warnf("Machine %s started for tag %d without stopping session %d; closing it", device.MACAddress, tagId, open.ID)
+		if err := endMachineSession(tx, open, at); err != nil {
+			return 0, err
+		}
+	case err != sql.ErrNoRows:
+		return 0, err
+	}
+
+	res, err := tx.Exec(InsertMachineSessionQuery, device.MACAddress, tagId, tagId, at.UTC())
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// StopMachineSession records a machine powering off at the given time and
+// returns the finished session.
+func (s *DBService) StopMachineSession(device models.Device, at time.Time) (models.MachineSession, error) {
+	if device.Type != models.DeviceTypeMachine {
+		return models.MachineSession{}, ErrNotMachine
+	}
+
+	session, err := scanMachineSession(s.db.QueryRow(GetOpenMachineSessionQuery, device.MACAddress))
+	if err == sql.ErrNoRows {
+		return models.MachineSession{}, ErrNoOpenSession
+	}
+	if err != nil {
+		return models.MachineSession{}, err
+	}
+
+	err = endMachineSession(s.db, session, at)
+	return *session, err
+}
+
+// GetMachineSessions returns the latest sessions, running ones included,
+// optionally for one device.
+func (s *DBService) GetMachineSessions(mac string, limit int) ([]models.MachineSession, error) {
+	if limit <= 0 || limit > maxSessionsListed {
+		limit = maxSessionsListed
+	}
+
+	rows, err := s.db.Query(GetMachineSessionsQuery, mac, mac, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.MachineSession{}
+	for rows.Next() {
+		session, err := scanMachineSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+// GetUsageReport totals the finished sessions that started in [from, to)
+// per machine, per member and per machine and month.
+func (s *DBService) GetUsageReport(from, to time.Time) (models.UsageReport, error) {
+	report := models.UsageReport{
+		From:     from,
+		To:       to,
+		Machines: []models.MachineUsage{},
+		Members:  []models.MemberUsage{},
+		Months:   []models.MonthUsage{},
+	}
+	if !to.After(from) {
+		return report, ErrInvalidReport
+	}
+
+	devices, err := s.GetDevices()
+	if err != nil {
+		return report, err
+	}
+	names := make(map[string]string, len(devices))
+	for _, device := range devices {
+		names[device.MACAddress] = device.Name
+	}
+
+	rows, err := s.db.Query(GetFinishedMachineSessionsQuery, from.UTC(), to.UTC())
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+
+	type memberKey struct {
+		contactId int
+		tagId     uint64
+	}
+	type monthKey struct {
+		month, mac string
+	}
+	machines := make(map[string]*models.MachineUsage)
+	members := make(map[memberKey]*models.MemberUsage)
+	months := make(map[monthKey]*models.MonthUsage)
+	loc := s.siteLocation()
+
+	for rows.Next() {
+		session, err := scanMachineSession(rows)
+		if err != nil {
+			return report, err
+		}
+		hours := (time.Duration(session.DurationSeconds) * time.Second).Hours()
+
+		machine := machines[session.MACAddress]
+		if machine == nil {
+			machine = &models.MachineUsage{MACAddress: session.MACAddress, Name: names[session.MACAddress]}
+			machines[session.MACAddress] = machine
+		}
+		machine.Sessions++
+		machine.Hours += hours
+
+		// Members are counted by contact so a replaced tag keeps their history
+		mk := memberKey{contactId: session.ContactId}
+		if session.ContactId == 0 {
+			mk.tagId = session.TagId
+		}
+		member := members[mk]
+		if member == nil {
+			member = &models.MemberUsage{ContactId: mk.contactId, TagId: mk.tagId}
+			members[mk] = member
+		}
+		member.Sessions++
+		member.Hours += hours
+
+		mok := monthKey{month: session.StartedAt.In(loc).Format("2006-01"), mac: session.MACAddress}
+		month := months[mok]
+		if month == nil {
+			month = &models.MonthUsage{Month: mok.month, MACAddress: session.MACAddress}
+			months[mok] = month
+		}
+		month.Sessions++
+		month.Hours += hours
+	}
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+
+	for _, machine := range machines {
+		report.Machines = append(report.Machines, *machine)
+	}
+	for _, member := range members {
+		report.Members = append(report.Members, *member)
+	}
+	for _, month := range months {
+		report.Months = append(report.Months, *month)
+	}
+	sort.Slice(report.Machines, func(i, j int) bool { return report.Machines[i].Hours > report.Machines[j].Hours })
+	sort.Slice(report.Members, func(i, j int) bool { return report.Members[i].Hours > report.Members[j].Hours })
+	sort.Slice(report.Months, func(i, j int) bool {
+		if report.Months[i].Month != report.Months[j].Month {
+			return report.Months[i].Month < report.Months[j].Month
+		}
+		return report.Months[i].MACAddress < report.Months[j].MACAddress
+	})
+	return report, nil
+}
+
+// endMachineSession closes session at the given time. Controllers with a
+// skewed clock cannot make a session end before it started.
+func endMachineSession(db execer, session *models.MachineSession, at time.Time) error {
+	if at.Before(session.StartedAt) {
+		at = session.StartedAt
+	}
+	session.EndedAt = at
+	session.DurationSeconds = int64(at.Sub(session.StartedAt) / time.Second)
+
+	_, err := db.Exec(EndMachineSessionQuery, at.UTC(), session.DurationSeconds, session.ID)
+	return err
+}
+
+func scanMachineSession(row rowScanner) (*models.MachineSession, error) {
+	var (
+		session   models.MachineSession
+		contactId sql.NullInt64
+		endedAt   sql.NullTime
+	)
+	if err := row.Scan(&session.ID, &session.MACAddress, &session.TagId, &contactId, &session.StartedAt,
+		&endedAt, &session.DurationSeconds); err != nil {
+		return nil, err
+	}
+	session.ContactId = int(contactId.Int64)
+	session.EndedAt = endedAt.Time
+	return &session, nil
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"rfid-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMachineSessionsAndUsage(t *testing.T) {
+	db := setupTestDB(t)
+	dbService := NewDBService(db, mockConfig(), testLogger())
+
+	_, err := db.Exec("INSERT INTO members (contact_id, tag_id, membership_level) VALUES (1, 111, 1), (2, 222, 1)")
+	require.NoError(t, err)
+
+	require.NoError(t, dbService.CreateDevice("AA:AA:AA:AA:AA:AA", models.DeviceDetails{Name: "Laser", Type: models.DeviceTypeMachine, Enabled: true}))
+	require.NoError(t, dbService.CreateDevice("BB:BB:BB:BB:BB:BB", models.DeviceDetails{Name: "Front Door", Type: models.DeviceTypeDoor, Enabled: true}))
+	laser, err := dbService.GetDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+	door, err := dbService.GetDevice("BB:BB:BB:BB:BB:BB")
+	require.NoError(t, err)
+
+	_, err = dbService.StartMachineSession(*door, 111, time.Now())
+	assert.Equal(t, ErrNotMachine, err)
+	_, err = dbService.StartMachineSession(*laser, 111, time.Now())
+	assert.Equal(t, ErrMachineUnavailable, err, "pending machines cannot start sessions")
+
+	_, err = dbService.ApproveDevice(laser.MACAddress, models.DeviceDetails{Name: "Laser", Type: models.DeviceTypeMachine, Enabled: true})
+	require.NoError(t, err)
+	laser, err = dbService.GetDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+	_, err = dbService.StopMachineSession(*laser, time.Now())
+	assert.Equal(t, ErrNoOpenSession, err)
+
+	jan := time.Date(2026, 1, 31, 22, 0, 0, 0, time.UTC)
+	_, err = dbService.StartMachineSession(*laser, 111, jan)
+	require.NoError(t, err)
+	session, err := dbService.StopMachineSession(*laser, jan.Add(90*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(90*60), session.DurationSeconds)
+	assert.Equal(t, 1, session.ContactId)
+
+	// A missed power-off is closed by the next power-on
+	feb := time.Date(2026, 2, 10, 12, 0, 0, 0, time.UTC)
+	_, err = dbService.StartMachineSession(*laser, 222, feb)
+	require.NoError(t, err)
+
+	// A tag of no member or guest needs a recent grant at the machine
+	_, err = dbService.StartMachineSession(*laser, 999, feb.Add(time.Hour))
+	assert.Equal(t, ErrUnknownSessionTag, err)
+	_, err = db.Exec("INSERT INTO access_log (mac_address, tag_id, granted, created_at) VALUES (?, 999, 1, ?)",
+		laser.MACAddress, feb.Add(55*time.Minute))
+	require.NoError(t, err)
+	_, err = dbService.StartMachineSession(*laser, 999, feb.Add(time.Hour))
+	require.NoError(t, err)
+
+	sessions, err := dbService.GetMachineSessions(laser.MACAddress, 0)
+	require.NoError(t, err)
+	require.Len(t, sessions, 3)
+	assert.True(t, sessions[0].Running())
+	assert.Equal(t, int64(3600), sessions[1].DurationSeconds)
+
+	report, err := dbService.GetUsageReport(jan.AddDate(0, -1, 0), feb.AddDate(0, 1, 0))
+	require.NoError(t, err)
+	require.Len(t, report.Machines, 1)
+	assert.Equal(t, models.MachineUsage{MACAddress: laser.MACAddress, Name: "Laser", Sessions: 2, Hours: 2.5}, report.Machines[0])
+	assert.Equal(t, []models.MemberUsage{{ContactId: 1, Sessions: 1, Hours: 1.5}, {ContactId: 2, Sessions: 1, Hours: 1}}, report.Members)
+	assert.Equal(t, []models.MonthUsage{
+		{Month: "2026-01", MACAddress: laser.MACAddress, Sessions: 1, Hours: 1.5},
+		{Month: "2026-02", MACAddress: laser.MACAddress, Sessions: 1, Hours: 1},
+	}, report.Months)
+
+	_, err = dbService.GetUsageReport(feb, jan)
+	assert.Equal(t, ErrInvalidReport, err)
+}
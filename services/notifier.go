@@ -0,0 +1,57 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"rfid-backend/config"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Notifier raises alerts for admins. Every alert is logged; if an
+// alert_webhook_url is configured it is also posted there as a chat message.
+type Notifier struct {
+	Client *http.Client
+	cfg    *config.Config
+	log    *logrus.Logger
+}
+
+func NewNotifier(cfg *config.Config, logger *logrus.Logger) *Notifier {
+	return &Notifier{
+		Client: &http.Client{Timeout: 10 * time.Second},
+		cfg:    cfg,
+		log:    logger,
+	}
+}
+
+// Notify sends an alert without blocking the caller.
+func (n *Notifier) Notify(subject, message string) {
+	n.log.WithFields(logrus.Fields{"alert": subject}).Warn(message)
+
+	if n.cfg.AlertWebhookURL == "" {
+		return
+	}
+
+	go func() {
+		text := "[DINGUS] " + subject + ": " + message
+		// Slack reads "text", Discord reads "content"; each ignores the other
+		body, err := json.Marshal(map[string]string{"text": text, "content": text})
+		if err != nil {
+			n.log.Errorf("Failed to encode alert: %v", err)
+			return
+		}
+
+		resp, err := n.Client.Post(n.cfg.AlertWebhookURL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			n.log.Errorf("Failed to post alert: %v", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode >= 300 {
+			n.log.Errorf("Alert webhook returned status %d", resp.StatusCode)
+		}
+	}()
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"rfid-backend/models"
+	"time"
+)
+
+var ErrInvalidDoorDirection = errors.New("only doors have a direction, and it must be entry or exit")
+
+const maxAccessLogListed = 500
+
+// RecordAccess logs the decision on a tag swiped at device and updates who
+// is in the space: a tag let in at an entry door is present until it swipes
+// at an exit reader. Exit swipes count whatever the decision, since people
+// leave either way.
+func (s *DBService) RecordAccess(device models.Device, rawTag string, decision models.AccessDecision, at time.Time) error {
+	tagId, err := s.NormalizeTag(rawTag)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	partner := nullableId(int64(decision.PartnerTagId))
+	if _, err := tx.Exec(InsertAccessLogQuery, device.MACAddress, tagId, tagId, decision.Granted, decision.Reason,
+		partner, partner, at.UTC()); err != nil {
+		return err
+	}
+
+	if device.IsDoor() {
+		switch {
+		case device.DoorDirection == models.DoorDirectionExit:
+			_, err = tx.Exec(RecordExitQuery, tagId)
+		case decision.Granted:
+			_, err = tx.Exec(RecordEntryQuery, tagId, tagId, device.MACAddress, at.UTC())
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if expiry := s.cfg.OccupancyExpiry; expiry > 0 {
+		if _, err := tx.Exec(PruneOccupancyQuery, at.Add(-expiry).UTC()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetOccupants returns who is believed to be in the space at now, earliest
+// arrival first. People who never swiped out drop off after the configured
+// occupancy expiry.
+func (s *DBService) GetOccupants(now time.Time) ([]models.Occupant, error) {
+	since := time.Time{}
+	if expiry := s.cfg.OccupancyExpiry; expiry > 0 {
+		since = now.Add(-expiry)
+	}
+
+	rows, err := s.db.Query(GetOccupantsQuery, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	occupants := []models.Occupant{}
+	for rows.Next() {
+		var (
+			o         models.Occupant
+			contactId sql.NullInt64
+		)
+		if err := rows.Scan(&o.TagId, &contactId, &o.MACAddress, &o.DoorName, &o.EnteredAt, &o.GuestName); err != nil {
+			return nil, err
+		}
+		o.ContactId = int(contactId.Int64)
+		occupants = append(occupants, o)
+	}
+	return occupants, rows.Err()
+}
+
+// GetAccessLog returns the latest swipes, optionally at one device.
+func (s *DBService) GetAccessLog(mac string, limit int) ([]models.AccessLogEntry, error) {
+	if limit <= 0 || limit > maxAccessLogListed {
+		limit = maxAccessLogListed
+	}
+
+	rows, err := s.db.Query(GetAccessLogQuery, mac, mac, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.AccessLogEntry{}
+	for rows.Next() {
+		var (
+			e                                       models.AccessLogEntry
+			contactId, partnerTag, partnerContactId sql.NullInt64
+		)
+		if err := rows.Scan(&e.ID, &e.MACAddress, &e.TagId, &contactId, &e.Granted, &e.Reason,
+			&partnerTag, &partnerContactId, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.ContactId = int(contactId.Int64)
+		e.PartnerTagId = uint64(partnerTag.Int64)
+		e.PartnerContactId = int(partnerContactId.Int64)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// SetDoorDirection marks a door as an entry or exit reader for occupancy
+// tracking.
+func (s *DBService) SetDoorDirection(mac, direction string) error {
+	device, err := s.GetDevice(mac)
+	if err != nil {
+		return err
+	}
+	if device == nil {
+		return ErrDeviceNotFound
+	}
+	if !device.IsDoor() || (direction != models.DoorDirectionEntry && direction != models.DoorDirectionExit) {
+		return ErrInvalidDoorDirection
+	}
+
+	_, err = s.db.Exec(SetDoorDirectionQuery, direction, mac)
+	return err
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"rfid-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOccupancyFollowsDoorSwipes(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := mockConfig()
+	cfg.OccupancyExpiry = 12 * time.Hour
+	dbService := NewDBService(db, cfg, testLogger())
+
+	_, err := db.Exec("INSERT INTO members (contact_id, tag_id, membership_level) VALUES (1, 111, 1), (2, 222, 1)")
+	require.NoError(t, err)
+
+	door := models.DeviceDetails{Name: "Front Door", Type: models.DeviceTypeDoor, Enabled: true}
+	require.NoError(t, dbService.CreateDevice("AA:AA:AA:AA:AA:AA", door))
+	door.Name = "Front Door Exit"
+	require.NoError(t, dbService.CreateDevice("BB:BB:BB:BB:BB:BB", door))
+	require.NoError(t, dbService.CreateDevice("CC:CC:CC:CC:CC:CC", models.DeviceDetails{Name: "Laser", Type: models.DeviceTypeMachine, Enabled: true}))
+
+	require.NoError(t, dbService.SetDoorDirection("BB:BB:BB:BB:BB:BB", models.DoorDirectionExit))
+	assert.Equal(t, ErrInvalidDoorDirection, dbService.SetDoorDirection("CC:CC:CC:CC:CC:CC", models.DoorDirectionExit))
+	assert.Equal(t, ErrInvalidDoorDirection, dbService.SetDoorDirection("AA:AA:AA:AA:AA:AA", "sideways"))
+	assert.Equal(t, ErrDeviceNotFound, dbService.SetDoorDirection("DD:DD:DD:DD:DD:DD", models.DoorDirectionExit))
+
+	entry, err := dbService.GetDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+	exit, err := dbService.GetDevice("BB:BB:BB:BB:BB:BB")
+	require.NoError(t, err)
+	laser, err := dbService.GetDevice("CC:CC:CC:CC:CC:CC")
+	require.NoError(t, err)
+	assert.Equal(t, models.DoorDirectionEntry, entry.DoorDirection)
+	assert.Equal(t, models.DoorDirectionExit, exit.DoorDirection)
+
+	now := time.Now()
+	require.NoError(t, dbService.RecordAccess(*entry, "111", models.Grant(), now.Add(-13*time.Hour)))
+	require.NoError(t, dbService.RecordAccess(*entry, "222", models.Grant(), now.Add(-time.Hour)))
+	require.NoError(t, dbService.RecordAccess(*entry, "999", models.Deny("unknown tag"), now.Add(-time.Hour)))
+	require.NoError(t, dbService.RecordAccess(*laser, "222", models.Grant(), now))
+
+	// Member 1 never swiped out and has expired
+	occupants, err := dbService.GetOccupants(now)
+	require.NoError(t, err)
+	require.Len(t, occupants, 1)
+	assert.Equal(t, 2, occupants[0].ContactId)
+	assert.Equal(t, "Front Door", occupants[0].DoorName)
+
+	require.NoError(t, dbService.RecordAccess(*exit, "222", models.Deny("device disabled"), now))
+	occupants, err = dbService.GetOccupants(now)
+	require.NoError(t, err)
+	assert.Empty(t, occupants)
+
+	log, err := dbService.GetAccessLog("", 0)
+	require.NoError(t, err)
+	require.Len(t, log, 5)
+	assert.Equal(t, exit.MACAddress, log[0].MACAddress)
+	assert.False(t, log[0].Granted)
+	assert.Equal(t, "unknown tag", log[2].Reason)
+	assert.Equal(t, 0, log[2].ContactId)
+
+	log, err = dbService.GetAccessLog(laser.MACAddress, 0)
+	require.NoError(t, err)
+	require.Len(t, log, 1)
+	assert.Equal(t, 2, log[0].ContactId)
+}
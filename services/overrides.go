@@ -0,0 +1,244 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"rfid-backend/models"
+	"time"
+)
+
+var (
+	ErrOverrideNotFound = errors.New("override not found")
+	ErrInvalidOverride  = errors.New("override needs an allow or deny effect, exactly one of a tag or contact, and an expiry in the future")
+)
+
+// override is an AccessOverride with the tag it currently applies to. For
+// contact overrides that is the contact's tag, or 0 if they are not a
+// current member.
+type override struct {
+	models.AccessOverride
+	tagId uint64
+}
+
+// GetOverrides returns every override, newest first, including expired ones.
+func (s *DBService) GetOverrides() ([]models.AccessOverride, error) {
+	overrides, err := s.loadOverrides()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]models.AccessOverride, 0, len(overrides))
+	for _, o := range overrides {
+		result = append(result, o.AccessOverride)
+	}
+	return result, nil
+}
+
+// CreateOverride saves an override and tells the readers it covers to
+// reload their caches.
+func (s *DBService) CreateOverride(o models.AccessOverride) (int64, error) {
+	if o.Effect != models.OverrideAllow && o.Effect != models.OverrideDeny {
+		return 0, ErrInvalidOverride
+	}
+	if (o.TagId == 0) == (o.ContactId == 0) {
+		return 0, ErrInvalidOverride
+	}
+	if !o.ExpiresAt.IsZero() && !o.ExpiresAt.After(time.Now()) {
+		return 0, ErrInvalidOverride
+	}
+
+	res, err := s.db.Exec(InsertAccessOverrideQuery, o.Effect, nullableId(int64(o.TagId)), nullableId(int64(o.ContactId)),
+		o.MACAddress, nullableTime(o.ExpiresAt), o.Reason, o.CreatedBy)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	s.publishDeviceReset(o.MACAddress)
+	return id, nil
+}
+
+// DeleteOverride removes an override, returning access to what Wild Apricot
+// says.
+func (s *DBService) DeleteOverride(id int64) error {
+	overrides, err := s.loadOverrides()
+	if err != nil {
+		return err
+	}
+
+	for _, o := range overrides {
+		if o.ID != id {
+			continue
+		}
+		if _, err := s.db.Exec(DeleteAccessOverrideQuery, id); err != nil {
+			return err
+		}
+		s.publishDeviceReset(o.MACAddress)
+		return nil
+	}
+	return ErrOverrideNotFound
+}
+
+// ExpireOverrides marks overrides whose expiry has passed and tells the
+// readers they covered to reload. It returns the overrides that lapsed.
+func (s *DBService) ExpireOverrides(now time.Time) ([]models.AccessOverride, error) {
+	overrides, err := s.loadOverrides()
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []models.AccessOverride
+	for _, o := range overrides {
+		if o.Expired || o.ActiveAt(now) {
+			continue
+		}
+		if _, err := s.db.Exec(SetAccessOverrideExpiredQuery, o.ID); err != nil {
+			return expired, err
+		}
+		s.publishDeviceReset(o.MACAddress)
+		expired = append(expired, o.AccessOverride)
+	}
+	return expired, nil
+}
+
+// tagOverride returns the effect of the overrides covering tagId at device,
+// or "" if there are none.
+func (s *DBService) tagOverride(device models.Device, tagId uint64, now time.Time) (string, error) {
+	allow, deny, err := s.activeOverrides(device, now)
+	switch {
+	case err != nil:
+		return "", err
+	case deny[tagId]:
+		return models.OverrideDeny, nil
+	case allow[tagId]:
+		return models.OverrideAllow, nil
+	}
+	return "", nil
+}
+
+// activeOverrides returns the tags allowed and denied at device by
+// overrides in force at now.
+func (s *DBService) activeOverrides(device models.Device, now time.Time) (allow, deny map[uint64]bool, err error) {
+	overrides, err := s.loadOverrides()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	allow, deny = make(map[uint64]bool), make(map[uint64]bool)
+	for _, o := range overrides {
+		if o.tagId == 0 || !o.ActiveAt(now) || !o.AppliesTo(device.MACAddress) {
+			continue
+		}
+		if o.Effect == models.OverrideDeny {
+			deny[o.tagId] = true
+		} else {
+			allow[o.tagId] = true
+		}
+	}
+	return allow, deny, nil
+}
+
+// applyOverrides adds the allowed tags to a cache list and drops the
+// denied ones.
+func (s *DBService) applyOverrides(device models.Device, tagIds []uint64, now time.Time) ([]uint64, error) {
+	allow, deny, err := s.activeOverrides(device, now)
+	if err != nil || (len(allow) == 0 && len(deny) == 0) {
+		return tagIds, err
+	}
+
+	result := make([]uint64, 0, len(tagIds)+len(allow))
+	for _, tagId := range tagIds {
+		if !deny[tagId] {
+			result = append(result, tagId)
+			delete(allow, tagId)
+		}
+	}
+	for tagId := range allow {
+		if !deny[tagId] {
+			result = append(result, tagId)
+		}
+	}
+	return result, nil
+}
+
+// DeviceAccessDelta is AccessDelta for a stored device, with its training
+// requirement looked up and overrides applied. Devices under a two-person
+// rule or taking reservations keep an empty cache, so they get no changes.
+// During a lockdown only admins are added.
+func (s *DBService) DeviceAccessDelta(device models.Device, changes []TagChange) (add, remove []uint64, err error) {
+	if device.OnlineOnly() {
+		return nil, nil, nil
+	}
+	req, err := s.GetDeviceRequirement(device)
+	if err != nil {
+		return nil, nil, err
+	}
+	allow, deny, err := s.activeOverrides(device, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	added, removed := AccessDelta(device, req, changes)
+	mode, err := s.GetSpaceMode()
+	if err != nil {
+		return nil, nil, err
+	}
+	if mode.Mode == models.SpaceModeLockdown {
+		if added, err = s.lockdownTags(added); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, tagId := range added {
+		if !deny[tagId] {
+			add = append(add, tagId)
+		}
+	}
+	for _, tagId := range removed {
+		if !allow[tagId] {
+			remove = append(remove, tagId)
+		}
+	}
+	return add, remove, nil
+}
+
+func (s *DBService) loadOverrides() ([]override, error) {
+	rows, err := s.db.Query(GetAccessOverridesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var overrides []override
+	for rows.Next() {
+		var (
+			o                           override
+			tagId, contactId, memberTag sql.NullInt64
+			expiresAt                   sql.NullTime
+		)
+		if err := rows.Scan(&o.ID, &o.Effect, &tagId, &contactId, &o.MACAddress, &expiresAt, &o.Expired,
+			&o.Reason, &o.CreatedBy, &o.CreatedAt, &memberTag); err != nil {
+			return nil, err
+		}
+
+		o.TagId = uint64(tagId.Int64)
+		o.ContactId = int(contactId.Int64)
+		o.ExpiresAt = expiresAt.Time
+		o.tagId = o.TagId
+		if contactId.Valid {
+			o.tagId = uint64(memberTag.Int64)
+		}
+		overrides = append(overrides, o)
+	}
+	return overrides, rows.Err()
+}
+
+func nullableId(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: id != 0}
+}
+
+func nullableTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
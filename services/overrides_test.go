@@ -0,0 +1,83 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"rfid-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverridesTakePrecedence(t *testing.T) {
+	db := setupTestDB(t)
+	dbService := NewDBService(db, mockConfig(), testLogger())
+
+	_, err := db.Exec("INSERT INTO members (contact_id, tag_id, membership_level) VALUES (1, 111, 1), (2, 222, 1)")
+	require.NoError(t, err)
+
+	door := models.DeviceDetails{Name: "Front Door", Type: models.DeviceTypeDoor, Enabled: true}
+	for _, mac := range []string{"AA:AA:AA:AA:AA:AA", "BB:BB:BB:BB:BB:BB"} {
+		require.NoError(t, dbService.CreateDevice(mac, door))
+		_, err = dbService.ApproveDevice(mac, door)
+		require.NoError(t, err)
+	}
+	front, err := dbService.GetDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+	back, err := dbService.GetDevice("BB:BB:BB:BB:BB:BB")
+	require.NoError(t, err)
+
+	// Member 1 is banned by contact; a contractor gets the front door for a day
+	_, err = dbService.CreateOverride(models.AccessOverride{Effect: models.OverrideDeny, ContactId: 1, Reason: "incident"})
+	require.NoError(t, err)
+	_, err = dbService.CreateOverride(models.AccessOverride{Effect: models.OverrideAllow, TagId: 999, MACAddress: front.MACAddress,
+		ExpiresAt: time.Now().Add(24 * time.Hour), Reason: "contractor", CreatedBy: "Admin"})
+	require.NoError(t, err)
+
+	_, err = dbService.CreateOverride(models.AccessOverride{Effect: models.OverrideAllow, TagId: 1, ContactId: 1})
+	assert.Equal(t, ErrInvalidOverride, err)
+	_, err = dbService.CreateOverride(models.AccessOverride{Effect: "maybe", TagId: 1})
+	assert.Equal(t, ErrInvalidOverride, err)
+
+	decide := func(device *models.Device, tag string, at time.Time) models.AccessDecision {
+		decision, err := dbService.AuthorizeTagAt(*device, tag, at)
+		require.NoError(t, err)
+		return decision
+	}
+
+	now := time.Now()
+	assert.Equal(t, models.Deny("denied by override"), decide(front, "111", now))
+	assert.True(t, decide(front, "222", now).Granted)
+	assert.True(t, decide(front, "999", now).Granted)
+	assert.Equal(t, models.Deny("unknown tag"), decide(back, "999", now))
+	assert.Equal(t, models.Deny("unknown tag"), decide(front, "999", now.Add(48*time.Hour)))
+
+	tagIds, err := dbService.GetDeviceCacheTags(*front)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []uint64{222, 999}, tagIds)
+
+	// A ban follows the contact to a new tag, and survives a full sync
+	cfg := mockConfig()
+	contacts := []models.Contact{
+		{Id: 1, FieldValues: []models.FieldValue{{FieldName: cfg.TagIdFieldName, Value: "333"}}},
+		{Id: 2, FieldValues: []models.FieldValue{{FieldName: cfg.TagIdFieldName, Value: "222"}}},
+	}
+	require.NoError(t, dbService.ProcessContactsData(contacts))
+	assert.Equal(t, models.Deny("denied by override"), decide(front, "333", now))
+
+	overrides, err := dbService.GetOverrides()
+	require.NoError(t, err)
+	require.Len(t, overrides, 2)
+	assert.Equal(t, "Admin", overrides[0].CreatedBy)
+
+	expired, err := dbService.ExpireOverrides(now.Add(48 * time.Hour))
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+	assert.Equal(t, uint64(999), expired[0].TagId)
+	assert.Equal(t, models.Deny("unknown tag"), decide(front, "999", now))
+
+	require.NoError(t, dbService.DeleteOverride(overrides[1].ID))
+	assert.True(t, decide(front, "333", now).Granted)
+	assert.Equal(t, ErrOverrideNotFound, dbService.DeleteOverride(overrides[1].ID))
+}
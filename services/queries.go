@@ -1,15 +1,488 @@
 package services
 
+// deviceColumns is the column list scanDevice expects.
+const deviceColumns = `
+	ip_address, mac_address, requires_training,
+	COALESCE(secret_hash, ''), COALESCE(enrollment_hash, ''),
+	status, name, location, device_type, notes, enabled, in_maintenance, maintenance_reason, training_mode, door_direction, two_person_rule, partner_window_seconds, reservable, first_seen, last_seen,
+	firmware_version, uptime_seconds, cache_version, stats, last_heartbeat, online, registered_from
+`
+
 const (
 	TagExistsQuery = `
 		SELECT EXISTS(SELECT 1 FROM members WHERE tag_id = ?)
 	`
 
-	GetTagIdsForTrainingQuery = `
-        SELECT tag_id
-        FROM members_trainings_link
-        WHERE label = ?;
-    `
+	GetAccessSnapshotQuery = `
+		SELECT m.tag_id, l.label
+		FROM members m
+		LEFT JOIN members_trainings_link l ON l.tag_id = m.tag_id AND l.expired = 0;
+	`
+
+	GetMemberLevelsQuery = `
+		SELECT contact_id, membership_level FROM members;
+	`
+
+	GetAdminTagIdsQuery = `
+		SELECT tag_id FROM members WHERE is_admin = 1 ORDER BY tag_id;
+	`
+
+	IsAdminTagQuery = `
+		SELECT EXISTS(SELECT 1 FROM members WHERE tag_id = ? AND is_admin = 1)
+	`
+
+	UpsertMembershipLevelQuery = `
+		INSERT INTO membership_levels (id, name)
+		VALUES (?, ?)
+		ON CONFLICT(id) DO UPDATE SET name = EXCLUDED.name;
+	`
+
+	GetMembershipLevelsQuery = `
+		SELECT id, name FROM membership_levels ORDER BY name;
+	`
+
+	GetSchedulesQuery = `
+		SELECT id, name, timezone FROM schedules ORDER BY name;
+	`
+
+	GetScheduleWindowsQuery = `
+		SELECT schedule_id, weekday, start_time, end_time
+		FROM schedule_windows
+		ORDER BY schedule_id, weekday, start_time;
+	`
+
+	GetScheduleHolidaysQuery = `
+		SELECT schedule_id, date, name
+		FROM schedule_holidays
+		ORDER BY schedule_id, date;
+	`
+
+	InsertScheduleQuery = `
+		INSERT INTO schedules (name, timezone) VALUES (?, ?);
+	`
+
+	UpdateScheduleQuery = `
+		UPDATE schedules SET name = ?, timezone = ? WHERE id = ?;
+	`
+
+	DeleteScheduleQuery = `
+		DELETE FROM schedules WHERE id = ?;
+	`
+
+	InsertScheduleWindowQuery = `
+		INSERT INTO schedule_windows (schedule_id, weekday, start_time, end_time)
+		VALUES (?, ?, ?, ?);
+	`
+
+	DeleteScheduleWindowsQuery = `
+		DELETE FROM schedule_windows WHERE schedule_id = ?;
+	`
+
+	InsertScheduleHolidayQuery = `
+		INSERT INTO schedule_holidays (schedule_id, date, name)
+		VALUES (?, ?, ?);
+	`
+
+	DeleteScheduleHolidaysQuery = `
+		DELETE FROM schedule_holidays WHERE schedule_id = ?;
+	`
+
+	GetScheduleAssignmentsQuery = `
+		SELECT target_type, target, schedule_id
+		FROM schedule_assignments
+		ORDER BY target_type, target;
+	`
+
+	UpsertScheduleAssignmentQuery = `
+		INSERT INTO schedule_assignments (target_type, target, schedule_id)
+		VALUES (?, ?, ?)
+		ON CONFLICT(target_type, target) DO UPDATE SET schedule_id = EXCLUDED.schedule_id;
+	`
+
+	DeleteScheduleAssignmentQuery = `
+		DELETE FROM schedule_assignments WHERE target_type = ? AND target = ?;
+	`
+
+	DeleteScheduleAssignmentsQuery = `
+		DELETE FROM schedule_assignments WHERE schedule_id = ?;
+	`
+
+	GetScheduledMembersQuery = `
+		SELECT m.tag_id, COALESCE(own.schedule_id, lvl.schedule_id)
+		FROM members m
+		LEFT JOIN schedule_assignments own
+			ON own.target_type = 'member' AND own.target = CAST(m.contact_id AS TEXT)
+		LEFT JOIN schedule_assignments lvl
+			ON lvl.target_type = 'level' AND lvl.target = CAST(m.membership_level AS TEXT)
+		WHERE own.schedule_id IS NOT NULL OR lvl.schedule_id IS NOT NULL;
+	`
+
+	GetTagScheduleQuery = `
+		SELECT COALESCE(own.schedule_id, lvl.schedule_id, 0)
+		FROM members m
+		LEFT JOIN schedule_assignments own
+			ON own.target_type = 'member' AND own.target = CAST(m.contact_id AS TEXT)
+		LEFT JOIN schedule_assignments lvl
+			ON lvl.target_type = 'level' AND lvl.target = CAST(m.membership_level AS TEXT)
+		WHERE m.tag_id = ?
+		LIMIT 1;
+	`
+
+	GetAccessOverridesQuery = `
+		SELECT o.id, o.effect, o.tag_id, o.contact_id, o.mac_address, o.expires_at, o.expired,
+			o.reason, o.created_by, o.created_at, m.tag_id
+		FROM access_overrides o
+		LEFT JOIN members m ON m.contact_id = o.contact_id
+		ORDER BY o.id DESC;
+	`
+
+	InsertAccessOverrideQuery = `
+		INSERT INTO access_overrides (effect, tag_id, contact_id, mac_address, expires_at, reason, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?);
+	`
+
+	DeleteAccessOverrideQuery = `
+		DELETE FROM access_overrides WHERE id = ?;
+	`
+
+	SetAccessOverrideExpiredQuery = `
+		UPDATE access_overrides SET expired = 1 WHERE id = ?;
+	`
+
+	GetGuestPassesQuery = `
+		SELECT g.id, g.name, g.tag_id, g.sponsor_contact_id, g.starts_at, g.ends_at, g.revoked,
+			g.active, g.created_by, g.created_at,
+			EXISTS (SELECT 1 FROM members m WHERE m.contact_id = g.sponsor_contact_id)
+		FROM guest_passes g
+		ORDER BY g.starts_at DESC;
+	`
+
+	GetGuestPassDoorsQuery = `
+		SELECT guest_pass_id, mac_address FROM guest_pass_doors;
+	`
+
+	InsertGuestPassQuery = `
+		INSERT INTO guest_passes (name, tag_id, sponsor_contact_id, starts_at, ends_at, created_by)
+		VALUES (?, ?, ?, ?, ?, ?);
+	`
+
+	InsertGuestPassDoorQuery = `
+		INSERT INTO guest_pass_doors (guest_pass_id, mac_address) VALUES (?, ?);
+	`
+
+	RevokeGuestPassQuery = `
+		UPDATE guest_passes SET revoked = 1 WHERE id = ?;
+	`
+
+	SetGuestPassActiveQuery = `
+		UPDATE guest_passes SET active = ? WHERE id = ?;
+	`
+
+	MemberExistsQuery = `
+		SELECT EXISTS (SELECT 1 FROM members WHERE contact_id = ?);
+	`
+
+	GetOpenMachineSessionQuery = `
+		SELECT id, mac_address, tag_id, contact_id, started_at, ended_at, duration_seconds
+		FROM machine_sessions
+		WHERE mac_address = ? AND ended_at IS NULL
+		ORDER BY started_at DESC
+		LIMIT 1;
+	`
+
+	GetMachineSessionsQuery = `
+		SELECT id, mac_address, tag_id, contact_id, started_at, ended_at, duration_seconds
+		FROM machine_sessions
+		WHERE (? = '' OR mac_address = ?)
+		ORDER BY started_at DESC
+		LIMIT ?;
+	`
+
+	GetFinishedMachineSessionsQuery = `
+		SELECT id, mac_address, tag_id, contact_id, started_at, ended_at, duration_seconds
+		FROM machine_sessions
+		WHERE ended_at IS NOT NULL AND started_at >= ? AND started_at < ?
+		ORDER BY started_at;
+	`
+
+	SessionTagKnownQuery = `
+		SELECT EXISTS(SELECT 1 FROM members WHERE tag_id = ?)
+			OR EXISTS(SELECT 1 FROM guest_passes WHERE tag_id = ? AND revoked = 0 AND starts_at <= ? AND ends_at > ?)
+			OR EXISTS(SELECT 1 FROM access_log
+				WHERE mac_address = ? AND tag_id = ? AND granted = 1 AND created_at > ? AND created_at <= ?);
+	`
+
+	InsertMachineSessionQuery = `
+		INSERT INTO machine_sessions (mac_address, tag_id, contact_id, started_at)
+		VALUES (?, ?, (SELECT contact_id FROM members WHERE tag_id = ?), ?);
+	`
+
+	EndMachineSessionQuery = `
+		UPDATE machine_sessions SET ended_at = ?, duration_seconds = ? WHERE id = ?;
+	`
+
+	InsertAccessLogQuery = `
+		INSERT INTO access_log (mac_address, tag_id, contact_id, granted, reason, partner_tag_id, partner_contact_id, created_at)
+		VALUES (?, ?, (SELECT contact_id FROM members WHERE tag_id = ?), ?, ?,
+			?, (SELECT contact_id FROM members WHERE tag_id = ?), ?);
+	`
+
+	GetAccessLogQuery = `
+		SELECT id, mac_address, tag_id, contact_id, granted, reason, partner_tag_id, partner_contact_id, created_at
+		FROM access_log
+		WHERE (? = '' OR mac_address = ?)
+		ORDER BY id DESC
+		LIMIT ?;
+	`
+
+	GetWaitingPartnerQuery = `
+		SELECT l.tag_id
+		FROM access_log l
+		WHERE l.mac_address = ? AND l.reason = ? AND l.tag_id != ? AND l.created_at >= ?
+			AND NOT EXISTS (SELECT 1 FROM access_log paired
+				WHERE paired.mac_address = l.mac_address AND paired.id > l.id AND paired.partner_tag_id = l.tag_id)
+		ORDER BY l.id DESC
+		LIMIT 1;
+	`
+
+	GetPresentOthersQuery = `
+		SELECT tag_id
+		FROM occupancy
+		WHERE tag_id != ? AND entered_at >= ?
+		ORDER BY entered_at;
+	`
+
+	GetOccupantEntryQuery = `
+		SELECT o.mac_address, COALESCE(d.name, ''), o.entered_at
+		FROM occupancy o
+		LEFT JOIN devices d ON d.mac_address = o.mac_address
+		WHERE o.tag_id = ? AND o.entered_at >= ?;
+	`
+
+	GetRecentDoorSwipeQuery = `
+		SELECT l.mac_address, COALESCE(d.name, ''), l.created_at
+		FROM access_log l
+		JOIN devices d ON d.mac_address = l.mac_address
+		WHERE l.tag_id = ? AND l.granted = 1 AND l.mac_address != ? AND d.device_type = 'door' AND l.created_at >= ?
+		ORDER BY l.id DESC
+		LIMIT 1;
+	`
+
+	InsertAccessAnomalyQuery = `
+		INSERT INTO access_anomalies (kind, tag_id, contact_id, mac_address, detail, denied, created_at)
+		VALUES (?, ?, (SELECT contact_id FROM members WHERE tag_id = ?), ?, ?, ?, ?);
+	`
+
+	GetAccessAnomaliesQuery = `
+		SELECT id, kind, tag_id, contact_id, mac_address, detail, denied, created_at
+		FROM access_anomalies
+		ORDER BY id DESC
+		LIMIT ?;
+	`
+
+	GetSpaceModeChangesQuery = `
+		SELECT id, mode, reason, changed_by, changed_at
+		FROM space_mode_changes
+		ORDER BY id DESC
+		LIMIT ?;
+	`
+
+	InsertSpaceModeChangeQuery = `
+		INSERT INTO space_mode_changes (mode, reason, changed_by, changed_at)
+		VALUES (?, ?, ?, ?);
+	`
+
+	GetUnlockWindowsQuery = `
+		SELECT id, name, starts_at, ends_at, COALESCE(event_id, 0), created_by, created_at
+		FROM unlock_windows
+		ORDER BY starts_at DESC;
+	`
+
+	GetUnlockWindowDoorsQuery = `
+		SELECT window_id, mac_address FROM unlock_window_doors ORDER BY mac_address;
+	`
+
+	InsertUnlockWindowQuery = `
+		INSERT INTO unlock_windows (name, starts_at, ends_at, event_id, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?);
+	`
+
+	UpdateEventUnlockWindowQuery = `
+		UPDATE unlock_windows SET name = ?, starts_at = ?, ends_at = ? WHERE id = ?;
+	`
+
+	InsertUnlockWindowDoorQuery = `
+		INSERT INTO unlock_window_doors (window_id, mac_address) VALUES (?, ?);
+	`
+
+	DeleteUnlockWindowDoorsQuery = `
+		DELETE FROM unlock_window_doors WHERE window_id = ?;
+	`
+
+	DeleteUnlockWindowQuery = `
+		DELETE FROM unlock_windows WHERE id = ?;
+	`
+
+	GetReservationsQuery = `
+		SELECT id, mac_address, contact_id, starts_at, ends_at, note, cancelled, cancelled_by, created_by, created_at
+		FROM reservations
+		WHERE cancelled = 0 AND (? = '' OR mac_address = ?) AND ends_at > ? AND starts_at < ?
+		ORDER BY starts_at;
+	`
+
+	GetReservationQuery = `
+		SELECT id, mac_address, contact_id, starts_at, ends_at, note, cancelled, cancelled_by, created_by, created_at
+		FROM reservations
+		WHERE id = ?;
+	`
+
+	GetMemberBookingsQuery = `
+		SELECT starts_at, ends_at
+		FROM reservations
+		WHERE cancelled = 0 AND contact_id = ? AND ends_at > ?;
+	`
+
+	GetOpenReservationHolderQuery = `
+		SELECT contact_id
+		FROM reservations
+		WHERE cancelled = 0 AND mac_address = ? AND starts_at <= ? AND ends_at > ?
+		LIMIT 1;
+	`
+
+	// Inserts nothing if the booking overlaps another on the machine
+	InsertReservationQuery = `
+		INSERT INTO reservations (mac_address, contact_id, starts_at, ends_at, note, created_by, created_at)
+		SELECT ?, ?, ?, ?, ?, ?, ?
+		WHERE NOT EXISTS (
+			SELECT 1 FROM reservations
+			WHERE cancelled = 0 AND mac_address = ? AND ends_at > ? AND starts_at < ?
+		);
+	`
+
+	CancelReservationQuery = `
+		UPDATE reservations SET cancelled = 1, cancelled_by = ? WHERE id = ?;
+	`
+
+	EndReservationQuery = `
+		UPDATE reservations SET ends_at = ? WHERE id = ?;
+	`
+
+	GetMemberTagQuery = `
+		SELECT tag_id FROM members WHERE contact_id = ?;
+	`
+
+	GetTagContactQuery = `
+		SELECT contact_id FROM members WHERE tag_id = ?;
+	`
+
+	RecordEntryQuery = `
+		INSERT INTO occupancy (tag_id, contact_id, mac_address, entered_at)
+		VALUES (?, (SELECT contact_id FROM members WHERE tag_id = ?), ?, ?)
+		ON CONFLICT(tag_id) DO UPDATE SET
+			contact_id = excluded.contact_id, mac_address = excluded.mac_address, entered_at = excluded.entered_at;
+	`
+
+	RecordExitQuery = `
+		DELETE FROM occupancy WHERE tag_id = ?;
+	`
+
+	PruneOccupancyQuery = `
+		DELETE FROM occupancy WHERE entered_at < ?;
+	`
+
+	GetOccupantsQuery = `
+		SELECT o.tag_id, o.contact_id, o.mac_address, COALESCE(d.name, ''), o.entered_at,
+			COALESCE((SELECT g.name FROM guest_passes g
+				WHERE g.tag_id = o.tag_id AND g.revoked = 0 AND g.starts_at <= o.entered_at AND g.ends_at > o.entered_at
+				LIMIT 1), '')
+		FROM occupancy o
+		LEFT JOIN devices d ON d.mac_address = o.mac_address
+		WHERE o.entered_at >= ?
+		ORDER BY o.entered_at;
+	`
+
+	GetAccessSequenceQuery = `
+		SELECT seq FROM sqlite_sequence WHERE name = 'access_changes';
+	`
+
+	GetAccessChangesSinceQuery = `
+		SELECT sequence, tag_id, mac_address, was_member, before_labels, is_member, after_labels
+		FROM access_changes
+		WHERE sequence > ?
+		ORDER BY sequence
+		LIMIT ?;
+	`
+
+	InsertAccessChangeQuery = `
+		INSERT INTO access_changes (tag_id, was_member, before_labels, is_member, after_labels)
+		VALUES (?, ?, ?, ?, ?);
+	`
+
+	InsertAccessResetQuery = `
+		INSERT INTO access_changes (mac_address)
+		VALUES (?);
+	`
+
+	PruneAccessChangesQuery = `
+		DELETE FROM access_changes
+		WHERE sequence <= (SELECT MAX(sequence) FROM access_changes) - ?;
+	`
+
+	GetTagTrainingLabelsQuery = `
+		SELECT label
+		FROM members_trainings_link
+		WHERE tag_id = ? AND expired = 0;
+	`
+
+	GetTagExpiredTrainingLabelsQuery = `
+		SELECT label
+		FROM members_trainings_link
+		WHERE tag_id = ? AND expired = 1;
+	`
+
+	GetTrainingsQuery = `
+		SELECT label, validity_days
+		FROM trainings
+		ORDER BY label;
+	`
+
+	SetTrainingValidityQuery = `
+		UPDATE trainings SET validity_days = ? WHERE label = ?;
+	`
+
+	GetMemberTrainingsQuery = `
+		SELECT m.contact_id, l.tag_id, l.label, l.granted_at, l.expired, l.reminded_at, t.validity_days
+		FROM members_trainings_link l
+		JOIN members m ON m.tag_id = l.tag_id
+		JOIN trainings t ON t.label = l.label
+		ORDER BY m.contact_id, l.label;
+	`
+
+	GetTrainingRelationsQuery = `
+		SELECT label, related, relation
+		FROM training_relations
+		ORDER BY label, related;
+	`
+
+	DeleteTrainingRelationsQuery = `
+		DELETE FROM training_relations WHERE label = ?;
+	`
+
+	InsertTrainingRelationQuery = `
+		INSERT OR IGNORE INTO training_relations (label, related, relation) VALUES (?, ?, ?);
+	`
+
+	SetTrainingExpiredQuery = `
+		UPDATE members_trainings_link SET expired = ? WHERE tag_id = ? AND label = ?;
+	`
+
+	SetTrainingRemindedQuery = `
+		UPDATE members_trainings_link SET reminded_at = ? WHERE tag_id = ? AND label = ?;
+	`
+
+	RecertifyTrainingQuery = `
+		UPDATE members_trainings_link SET granted_at = ?, expired = 0, reminded_at = NULL WHERE tag_id = ? AND label = ?;
+	`
 
 	GetTrainingQuery = `
 		SELECT label
@@ -23,10 +496,118 @@ const (
 	`
 
 	GetAllDevicesQuery = `
-		SELECT ip_address, mac_address
+		SELECT ` + deviceColumns + `
 		FROM devices;
 	`
 
+	GetDeviceQuery = `
+		SELECT ` + deviceColumns + `
+		FROM devices
+		WHERE mac_address = ?;
+	`
+
+	ApproveDeviceQuery = `
+		UPDATE devices
+		SET status = 'approved', name = ?, location = ?, device_type = ?, notes = ?, enabled = ?
+		WHERE mac_address = ?;
+	`
+
+	CreateDeviceQuery = `
+		INSERT INTO devices (ip_address, mac_address, requires_training, name, location, device_type, notes, enabled)
+		VALUES ('', ?, 0, ?, ?, ?, ?, ?);
+	`
+
+	UpdateDeviceQuery = `
+		UPDATE devices
+		SET name = ?, location = ?, device_type = ?, notes = ?, enabled = ?
+		WHERE mac_address = ?;
+	`
+
+	DecommissionDeviceQuery = `
+		UPDATE devices
+		SET status = 'decommissioned', secret_hash = NULL, enrollment_hash = NULL,
+			in_maintenance = 0, maintenance_reason = '', online = 0
+		WHERE mac_address = ?;
+	`
+
+	SetTwoPersonRuleQuery = `
+		UPDATE devices SET two_person_rule = ?, partner_window_seconds = ? WHERE mac_address = ?;
+	`
+
+	SetReservableQuery = `
+		UPDATE devices SET reservable = ? WHERE mac_address = ?;
+	`
+
+	SetDoorDirectionQuery = `
+		UPDATE devices SET door_direction = ? WHERE mac_address = ?;
+	`
+
+	SetDeviceMaintenanceQuery = `
+		UPDATE devices
+		SET in_maintenance = ?, maintenance_reason = ?
+		WHERE mac_address = ?;
+	`
+
+	InsertDeviceAuditQuery = `
+		INSERT INTO device_audit_log (mac_address, action, detail, actor)
+		VALUES (?, ?, ?, ?);
+	`
+
+	GetDeviceAuditQuery = `
+		SELECT id, mac_address, action, detail, actor, created_at
+		FROM device_audit_log
+		WHERE mac_address = ?
+		ORDER BY id DESC;
+	`
+
+	GetRecentDeviceAuditQuery = `
+		SELECT id, mac_address, action, detail, actor, created_at
+		FROM device_audit_log
+		ORDER BY id DESC
+		LIMIT ?;
+	`
+
+	DeleteDeviceQuery = `
+		DELETE FROM devices
+		WHERE mac_address = ?;
+	`
+
+	SetDeviceStatusQuery = `
+		UPDATE devices
+		SET status = ?
+		WHERE mac_address = ?;
+	`
+
+	SetDeviceTrainingModeQuery = `
+		UPDATE devices
+		SET training_mode = ?
+		WHERE mac_address = ?;
+	`
+
+	GetDeviceTrainingLabelsQuery = `
+		SELECT label
+		FROM devices_trainings_link
+		WHERE mac_address = ?;
+	`
+
+	SetEnrollmentCodeQuery = `
+		UPDATE devices
+		SET secret_hash = NULL, enrollment_hash = ?
+		WHERE mac_address = ?;
+	`
+
+	RevokeDeviceCredentialQuery = `
+		UPDATE devices
+		SET secret_hash = NULL, enrollment_hash = NULL, status = 'pending'
+		WHERE mac_address = ?;
+	`
+
+	EnrollDeviceQuery = `
+		UPDATE devices
+		SET secret_hash = ?, enrollment_hash = NULL
+		WHERE mac_address = ? AND enrollment_hash = ?;
+	`
+
 	GetAllTagIdsQuery = `
         SELECT tag_id
         FROM members;
@@ -38,9 +619,10 @@ const (
 	`
 
 	InsertOrUpdateMemberQuery = `
-		INSERT OR IGNORE INTO members (contact_id, tag_id, membership_level)
-		VALUES (?, ?, ?)
-		ON CONFLICT(contact_id) DO UPDATE SET tag_id = ?, membership_level = EXCLUDED.membership_level;
+		INSERT OR IGNORE INTO members (contact_id, tag_id, membership_level, is_admin)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(contact_id) DO UPDATE SET tag_id = ?, membership_level = EXCLUDED.membership_level,
+			is_admin = EXCLUDED.is_admin;
 	`
 
 	InsertTrainingQuery = `
@@ -49,15 +631,55 @@ const (
     `
 
 	InsertMemberTrainingLinkQuery = `
-        INSERT OR IGNORE INTO members_trainings_link (tag_id, label)
-        VALUES (?, ?);
+        INSERT OR IGNORE INTO members_trainings_link (tag_id, label, granted_at)
+        VALUES (?, ?, ?);
     `
 
 	InsertDeviceQuery = `
-        INSERT OR IGNORE INTO devices (ip_address, mac_address, requires_training)
-        VALUES (?, ?, ?);
+        INSERT OR IGNORE INTO devices (ip_address, mac_address, requires_training, last_seen)
+        VALUES (?, ?, ?, CURRENT_TIMESTAMP);
     `
 
+	RecordRegistrationQuery = `
+		UPDATE devices
+		SET registered_from = ?
+		WHERE mac_address = ?;
+	`
+
+	RecordDeviceSeenQuery = `
+		UPDATE devices
+		SET ip_address = ?, last_seen = CURRENT_TIMESTAMP
+		WHERE mac_address = ?;
+	`
+
+	RecordHeartbeatQuery = `
+		UPDATE devices
+		SET firmware_version = ?, uptime_seconds = ?, cache_version = ?, stats = ?,
+			last_heartbeat = CURRENT_TIMESTAMP, last_seen = CURRENT_TIMESTAMP
+		WHERE mac_address = ?;
+	`
+
+	SetDeviceOnlineQuery = `
+		UPDATE devices
+		SET online = ?
+		WHERE mac_address = ?;
+	`
+
+	GetDevicesAtIPQuery = `
+		SELECT mac_address
+		FROM devices
+		WHERE ip_address = ? AND mac_address != ?;
+	`
+
+	GetIPConflictsQuery = `
+		SELECT ip_address, mac_address
+		FROM devices
+		WHERE ip_address IN (
+			SELECT ip_address FROM devices WHERE ip_address != '' GROUP BY ip_address HAVING COUNT(*) > 1
+		)
+		ORDER BY ip_address;
+	`
+
 	InsertDeviceTrainingLinkQuery = `
 		INSERT INTO devices_trainings_link (mac_address, label)
 		VALUES (?, ?)
@@ -77,4 +699,24 @@ const (
 		DELETE FROM devices_trainings_link
 		WHERE mac_address = ?;
 	`
+
+	DeleteDeviceSchedulesQuery = `
+		DELETE FROM schedule_assignments
+		WHERE target_type IN ('device', 'unlock') AND target = ?;
+	`
+
+	DeleteDeviceUnlockDoorsQuery = `
+		DELETE FROM unlock_window_doors
+		WHERE mac_address = ?;
+	`
+
+	DeleteDeviceOverridesQuery = `
+		DELETE FROM access_overrides
+		WHERE mac_address = ?;
+	`
+
+	DeleteDeviceReservationsQuery = `
+		DELETE FROM reservations
+		WHERE mac_address = ?;
+	`
 )
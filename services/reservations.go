@@ -0,0 +1,240 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"rfid-backend/models"
+	"time"
+)
+
+var (
+	ErrReservationNotFound    = errors.New("reservation not found")
+	ErrInvalidReservation     = errors.New("reservation must end after it starts and must not have ended")
+	ErrNotReservable          = errors.New("only approved machines that take reservations can be booked")
+	ErrReservableNotMachine   = errors.New("only machines can take reservations")
+	ErrReservationConflict    = errors.New("machine is already reserved for part of that time")
+	ErrReservationNotEligible = errors.New("member must be current and hold the machine's trainings to book it")
+	ErrReservationTooLong     = errors.New("reservation is longer than a single booking may be")
+	ErrReservationTooFar      = errors.New("reservation starts further ahead than machines can be booked")
+	ErrReservationLimit       = errors.New("member has already booked as much machine time as allowed")
+	ErrReservationEnded       = errors.New("reservation has already ended or been cancelled")
+)
+
+// SetReservable makes a machine take reservations, or go back to first come,
+// first served. The machine's cache is emptied while it takes reservations,
+// since a reader cannot check them offline.
+func (s *DBService) SetReservable(mac string, reservable bool) error {
+	device, err := s.GetDevice(mac)
+	if err != nil {
+		return err
+	}
+	if device == nil {
+		return ErrDeviceNotFound
+	}
+	if device.Type != models.DeviceTypeMachine {
+		return ErrReservableNotMachine
+	}
+
+	if _, err := s.db.Exec(SetReservableQuery, reservable, mac); err != nil {
+		return err
+	}
+	s.publishDeviceReset(mac)
+	return nil
+}
+
+// GetReservations returns the bookings that are not cancelled and overlap
+// from to to, earliest first. An empty mac lists every machine's.
+func (s *DBService) GetReservations(mac string, from, to time.Time) ([]models.Reservation, error) {
+	rows, err := s.db.Query(GetReservationsQuery, mac, mac, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reservations := []models.Reservation{}
+	for rows.Next() {
+		r, err := scanReservation(rows)
+		if err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, r)
+	}
+	return reservations, rows.Err()
+}
+
+// GetReservation returns a reservation by id, or nil if there is none.
+func (s *DBService) GetReservation(id int64) (*models.Reservation, error) {
+	r, err := scanReservation(s.db.QueryRow(GetReservationQuery, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// CreateReservation books a reservable machine for a current member who
+// holds its trainings. The booking must not overlap another one on the
+// machine and must keep within the booking limits: reservation_max_length
+// per booking, reservation_horizon ahead of now, and reservation_max_booked
+// of upcoming time per member across machines.
+func (s *DBService) CreateReservation(r models.Reservation, now time.Time) (int64, error) {
+	if r.ContactId == 0 || !r.EndsAt.After(r.StartsAt) || !r.EndsAt.After(now) {
+		return 0, ErrInvalidReservation
+	}
+	length := r.EndsAt.Sub(r.StartsAt)
+	if length > s.cfg.ReservationMaxLength {
+		return 0, ErrReservationTooLong
+	}
+	if r.StartsAt.After(now.Add(s.cfg.ReservationHorizon)) {
+		return 0, ErrReservationTooFar
+	}
+
+	device, err := s.GetDevice(r.MACAddress)
+	if err != nil {
+		return 0, err
+	}
+	if device == nil || !device.Reservable || !device.IsApproved() {
+		return 0, ErrNotReservable
+	}
+	if eligible, err := s.canBook(*device, r.ContactId); err != nil || !eligible {
+		if err == nil {
+			err = ErrReservationNotEligible
+		}
+		return 0, err
+	}
+
+	// The limit check and the insert share a transaction, and the insert
+	// itself refuses an overlap, so concurrent bookings cannot both succeed
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	booked, err := bookedTime(tx, r.ContactId, now)
+	if err != nil {
+		return 0, err
+	}
+	if booked+length > s.cfg.ReservationMaxBooked {
+		return 0, ErrReservationLimit
+	}
+
+	startsAt, endsAt := r.StartsAt.UTC(), r.EndsAt.UTC()
+	res, err := tx.Exec(InsertReservationQuery, r.MACAddress, r.ContactId, startsAt, endsAt, r.Note, r.CreatedBy, now.UTC(),
+		r.MACAddress, startsAt, endsAt)
+	if err != nil {
+		return 0, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return 0, err
+	} else if n == 0 {
+		return 0, ErrReservationConflict
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// CancelReservation frees a booked machine. A reservation that has started
+// is ended at now instead, so the time it was held stays on record.
+func (s *DBService) CancelReservation(id int64, cancelledBy string, now time.Time) error {
+	r, err := s.GetReservation(id)
+	if err != nil {
+		return err
+	}
+	if r == nil {
+		return ErrReservationNotFound
+	}
+	if r.Cancelled || !r.EndsAt.After(now) {
+		return ErrReservationEnded
+	}
+
+	if r.StartsAt.After(now) {
+		_, err = s.db.Exec(CancelReservationQuery, cancelledBy, id)
+	} else {
+		_, err = s.db.Exec(EndReservationQuery, now.UTC(), id)
+	}
+	return err
+}
+
+// reservationDecision lets a tag that would otherwise be granted use a
+// reservable machine only if no one else holds an open reservation on it.
+func (s *DBService) reservationDecision(device models.Device, tagId uint64, now time.Time) (models.AccessDecision, error) {
+	if !device.Reservable {
+		return models.Grant(), nil
+	}
+
+	var holder int
+	err := s.db.QueryRow(GetOpenReservationHolderQuery, device.MACAddress, now.UTC(), now.UTC()).Scan(&holder)
+	if err == sql.ErrNoRows {
+		return models.Grant(), nil
+	}
+	if err != nil {
+		return models.Deny("reservation lookup failed"), err
+	}
+
+	var contactId int
+	if err := s.db.QueryRow(GetTagContactQuery, tagId).Scan(&contactId); err != nil && err != sql.ErrNoRows {
+		return models.Deny("reservation lookup failed"), err
+	}
+	if contactId != holder {
+		return models.Deny("reserved by another member"), nil
+	}
+	return models.Grant(), nil
+}
+
+// canBook reports whether contactId is a current member meeting device's
+// training requirement.
+func (s *DBService) canBook(device models.Device, contactId int) (bool, error) {
+	var tagId uint64
+	err := s.db.QueryRow(GetMemberTagQuery, contactId).Scan(&tagId)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	req, err := s.GetDeviceRequirement(device)
+	if err != nil {
+		return false, err
+	}
+	held, err := s.GetTagTrainingLabels(tagId)
+	if err != nil {
+		return false, err
+	}
+	return memberDecision(device, req, true, held).Granted, nil
+}
+
+// bookedTime totals the machine time contactId still has booked after now.
+func bookedTime(db querier, contactId int, now time.Time) (time.Duration, error) {
+	rows, err := db.Query(GetMemberBookingsQuery, contactId, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var booked time.Duration
+	for rows.Next() {
+		var startsAt, endsAt time.Time
+		if err := rows.Scan(&startsAt, &endsAt); err != nil {
+			return 0, err
+		}
+		if startsAt.Before(now) {
+			startsAt = now
+		}
+		booked += endsAt.Sub(startsAt)
+	}
+	return booked, rows.Err()
+}
+
+func scanReservation(row rowScanner) (models.Reservation, error) {
+	var r models.Reservation
+	err := row.Scan(&r.ID, &r.MACAddress, &r.ContactId, &r.StartsAt, &r.EndsAt, &r.Note, &r.Cancelled, &r.CancelledBy,
+		&r.CreatedBy, &r.CreatedAt)
+	return r, err
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"rfid-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReservations(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := mockConfig()
+	cfg.ReservationMaxLength = 4 * time.Hour
+	cfg.ReservationMaxBooked = 5 * time.Hour
+	cfg.ReservationHorizon = 14 * 24 * time.Hour
+	dbService := NewDBService(db, cfg, testLogger())
+
+	_, err := db.Exec(`INSERT INTO members (contact_id, tag_id, membership_level) VALUES (1, 111, 1), (2, 222, 1), (3, 333, 1);
+		INSERT INTO trainings (label) VALUES ('Laser');
+		INSERT INTO members_trainings_link (tag_id, label) VALUES (111, 'Laser'), (222, 'Laser')`)
+	require.NoError(t, err)
+
+	laser := models.DeviceDetails{Name: "Laser", Type: models.DeviceTypeMachine, Enabled: true, TrainingLabels: []string{"Laser"}}
+	require.NoError(t, dbService.CreateDevice("BB:BB:BB:BB:BB:BB", laser))
+	_, err = dbService.ApproveDevice("BB:BB:BB:BB:BB:BB", laser)
+	require.NoError(t, err)
+	door := models.DeviceDetails{Name: "Front Door", Type: models.DeviceTypeDoor, Enabled: true}
+	require.NoError(t, dbService.CreateDevice("AA:AA:AA:AA:AA:AA", door))
+	_, err = dbService.ApproveDevice("AA:AA:AA:AA:AA:AA", door)
+	require.NoError(t, err)
+
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	book := func(contactId int, from, to time.Duration) (int64, error) {
+		return dbService.CreateReservation(models.Reservation{
+			MACAddress: "BB:BB:BB:BB:BB:BB",
+			ContactId:  contactId,
+			StartsAt:   now.Add(from),
+			EndsAt:     now.Add(to),
+			CreatedBy:  "1",
+		}, now)
+	}
+
+	// Machines only take bookings once made reservable
+	_, err = book(1, time.Hour, 2*time.Hour)
+	assert.Equal(t, ErrNotReservable, err)
+	assert.Equal(t, ErrReservableNotMachine, dbService.SetReservable("AA:AA:AA:AA:AA:AA", true))
+	require.NoError(t, dbService.SetReservable("BB:BB:BB:BB:BB:BB", true))
+	cutter, err := dbService.GetDevice("BB:BB:BB:BB:BB:BB")
+	require.NoError(t, err)
+	assert.True(t, cutter.Reservable)
+
+	tagIds, err := dbService.GetDeviceCacheTags(*cutter)
+	require.NoError(t, err)
+	assert.Empty(t, tagIds)
+
+	_, err = book(1, 2*time.Hour, time.Hour)
+	assert.Equal(t, ErrInvalidReservation, err)
+	_, err = book(1, time.Hour, 6*time.Hour)
+	assert.Equal(t, ErrReservationTooLong, err)
+	_, err = book(1, 15*24*time.Hour, 15*24*time.Hour+time.Hour)
+	assert.Equal(t, ErrReservationTooFar, err)
+	_, err = book(3, time.Hour, 2*time.Hour)
+	assert.Equal(t, ErrReservationNotEligible, err)
+	_, err = book(9, time.Hour, 2*time.Hour)
+	assert.Equal(t, ErrReservationNotEligible, err)
+
+	morning, err := book(1, -time.Hour, 2*time.Hour)
+	require.NoError(t, err)
+	_, err = book(2, time.Hour, 3*time.Hour)
+	assert.Equal(t, ErrReservationConflict, err)
+	_, err = book(1, 3*time.Hour, 7*time.Hour)
+	assert.Equal(t, ErrReservationLimit, err, "two hours left plus four exceeds five booked")
+	tomorrow, err := book(1, 24*time.Hour, 27*time.Hour)
+	require.NoError(t, err)
+
+	reservations, err := dbService.GetReservations("BB:BB:BB:BB:BB:BB", now, now.Add(48*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, reservations, 2)
+	assert.Equal(t, morning, reservations[0].ID)
+
+	// Only the holder may use the machine while the booking is open
+	decide := func(tag string, at time.Time) models.AccessDecision {
+		decision, err := dbService.AuthorizeTagAt(*cutter, tag, at)
+		require.NoError(t, err)
+		return decision
+	}
+	assert.True(t, decide("111", now).Granted)
+	assert.Equal(t, models.Deny("reserved by another member"), decide("222", now))
+	assert.True(t, decide("222", now.Add(3*time.Hour)).Granted, "first come when unreserved")
+	assert.Equal(t, models.Deny("missing training"), decide("333", now.Add(3*time.Hour)))
+
+	// Cancelling a started booking ends it; a future one is dropped
+	require.NoError(t, dbService.CancelReservation(morning, "1", now))
+	assert.Equal(t, ErrReservationEnded, dbService.CancelReservation(morning, "1", now.Add(time.Minute)))
+	assert.True(t, decide("222", now.Add(time.Minute)).Granted)
+	ended, err := dbService.GetReservation(morning)
+	require.NoError(t, err)
+	assert.False(t, ended.Cancelled)
+	assert.True(t, now.Equal(ended.EndsAt))
+
+	require.NoError(t, dbService.CancelReservation(tomorrow, "admin", now))
+	cancelled, err := dbService.GetReservation(tomorrow)
+	require.NoError(t, err)
+	assert.True(t, cancelled.Cancelled)
+	assert.Equal(t, "admin", cancelled.CancelledBy)
+	reservations, err = dbService.GetReservations("", now, now.Add(48*time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, reservations)
+
+	assert.Equal(t, ErrReservationNotFound, dbService.CancelReservation(999, "1", now))
+	missing, err := dbService.GetReservation(999)
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+}
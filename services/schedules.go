@@ -0,0 +1,439 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"rfid-backend/models"
+	"strings"
+	"time"
+)
+
+var (
+	ErrScheduleNotFound      = errors.New("schedule not found")
+	ErrScheduleExists        = errors.New("a schedule with that name already exists")
+	ErrInvalidSchedule       = errors.New("schedule needs a name and well formed windows and holidays")
+	ErrInvalidTimezone       = errors.New("unknown timezone")
+	ErrInvalidScheduleTarget = errors.New("schedule target type must be level, member, device or unlock, and unlock targets must be approved doors")
+)
+
+// GetSchedules returns every schedule with its windows and holidays.
+func (s *DBService) GetSchedules() ([]models.Schedule, error) {
+	rows, err := s.db.Query(GetSchedulesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []models.Schedule
+	index := make(map[int64]int)
+	for rows.Next() {
+		schedule := models.Schedule{Windows: []models.ScheduleWindow{}, Holidays: []models.Holiday{}}
+		if err := rows.Scan(&schedule.ID, &schedule.Name, &schedule.Timezone); err != nil {
+			return nil, err
+		}
+		index[schedule.ID] = len(schedules)
+		schedules = append(schedules, schedule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	windows, err := s.db.Query(GetScheduleWindowsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.Close()
+
+	for windows.Next() {
+		var (
+			id     int64
+			window models.ScheduleWindow
+		)
+		if err := windows.Scan(&id, &window.Weekday, &window.Start, &window.End); err != nil {
+			return nil, err
+		}
+		if i, ok := index[id]; ok {
+			schedules[i].Windows = append(schedules[i].Windows, window)
+		}
+	}
+	if err := windows.Err(); err != nil {
+		return nil, err
+	}
+
+	holidays, err := s.db.Query(GetScheduleHolidaysQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer holidays.Close()
+
+	for holidays.Next() {
+		var (
+			id      int64
+			holiday models.Holiday
+		)
+		if err := holidays.Scan(&id, &holiday.Date, &holiday.Name); err != nil {
+			return nil, err
+		}
+		if i, ok := index[id]; ok {
+			schedules[i].Holidays = append(schedules[i].Holidays, holiday)
+		}
+	}
+
+	return schedules, holidays.Err()
+}
+
+// GetSchedule returns one schedule, or nil if there is no such schedule.
+func (s *DBService) GetSchedule(id int64) (*models.Schedule, error) {
+	schedules, err := s.GetSchedules()
+	if err != nil {
+		return nil, err
+	}
+	for _, schedule := range schedules {
+		if schedule.ID == id {
+			return &schedule, nil
+		}
+	}
+	return nil, nil
+}
+
+// CreateSchedule saves a new schedule and returns its id.
+func (s *DBService) CreateSchedule(schedule models.Schedule) (int64, error) {
+	if err := s.validateSchedule(schedule); err != nil {
+		return 0, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := tx.Exec(InsertScheduleQuery, schedule.Name, schedule.Timezone)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err := replaceScheduleRules(tx, id, schedule); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// UpdateSchedule replaces a schedule's name, zone, windows and holidays.
+// Readers reload their caches since any of them may enforce it.
+func (s *DBService) UpdateSchedule(schedule models.Schedule) error {
+	if err := s.validateSchedule(schedule); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(UpdateScheduleQuery, schedule.Name, schedule.Timezone, schedule.ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return ErrScheduleNotFound
+	}
+
+	if err := replaceScheduleRules(tx, schedule.ID, schedule); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.publishDeviceReset("")
+	return nil
+}
+
+// DeleteSchedule removes a schedule and detaches it from everything it was
+// attached to, which are unrestricted from then on.
+func (s *DBService) DeleteSchedule(id int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, query := range []string{DeleteScheduleAssignmentsQuery, DeleteScheduleWindowsQuery, DeleteScheduleHolidaysQuery} {
+		if _, err := tx.Exec(query, id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	res, err := tx.Exec(DeleteScheduleQuery, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return ErrScheduleNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.publishDeviceReset("")
+	return nil
+}
+
+// GetScheduleAssignments lists which schedules are attached to what.
+func (s *DBService) GetScheduleAssignments() ([]models.ScheduleAssignment, error) {
+	rows, err := s.db.Query(GetScheduleAssignmentsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assignments := []models.ScheduleAssignment{}
+	for rows.Next() {
+		var assignment models.ScheduleAssignment
+		if err := rows.Scan(&assignment.TargetType, &assignment.Target, &assignment.ScheduleID); err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, assignment)
+	}
+	return assignments, rows.Err()
+}
+
+// AssignSchedule attaches a schedule to a membership level, member or
+// device, or makes it a door's unlock schedule, replacing any schedule the
+// target had. A zero scheduleId detaches it.
+func (s *DBService) AssignSchedule(targetType, target string, scheduleId int64) error {
+	if !models.ValidScheduleTarget(targetType) {
+		return ErrInvalidScheduleTarget
+	}
+	if targetType == models.ScheduleTargetUnlock && scheduleId != 0 {
+		if err := s.checkUnlockDoors([]string{target}); err == ErrUnlockDoorInvalid {
+			return ErrInvalidScheduleTarget
+		} else if err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if scheduleId == 0 {
+		_, err = s.db.Exec(DeleteScheduleAssignmentQuery, targetType, target)
+	} else {
+		var schedule *models.Schedule
+		if schedule, err = s.GetSchedule(scheduleId); err != nil {
+			return err
+		}
+		if schedule == nil {
+			return ErrScheduleNotFound
+		}
+		_, err = s.db.Exec(UpsertScheduleAssignmentQuery, targetType, target, scheduleId)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch targetType {
+	case models.ScheduleTargetDevice:
+		s.publishDeviceReset(target)
+	case models.ScheduleTargetUnlock:
+		// Readers poll their door state; their caches are unaffected
+	default:
+		s.publishDeviceReset("")
+	}
+	return nil
+}
+
+// GetMembershipLevels returns the membership levels seen during sync.
+func (s *DBService) GetMembershipLevels() ([]models.Level, error) {
+	rows, err := s.db.Query(GetMembershipLevelsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	levels := []models.Level{}
+	for rows.Next() {
+		var level models.Level
+		if err := rows.Scan(&level.Id, &level.Name); err != nil {
+			return nil, err
+		}
+		levels = append(levels, level)
+	}
+	return levels, rows.Err()
+}
+
+// GetCacheSchedules returns the schedule rules a reader enforces offline:
+// its own schedule and those of every member with one. Each schedule's
+// timezone is resolved so readers need no server configuration.
+func (s *DBService) GetCacheSchedules(device models.Device) (models.CacheSchedules, error) {
+	rules := models.CacheSchedules{TagSchedules: map[uint64]int64{}, Schedules: map[int64]models.Schedule{}}
+
+	schedules, err := s.GetSchedules()
+	if err != nil || len(schedules) == 0 {
+		return rules, err
+	}
+	byId := make(map[int64]models.Schedule, len(schedules))
+	for _, schedule := range schedules {
+		schedule.Timezone = s.scheduleLocation(schedule).String()
+		byId[schedule.ID] = schedule
+	}
+
+	if rules.DeviceSchedule, err = s.targetSchedule(models.ScheduleTargetDevice, device.MACAddress); err != nil {
+		return rules, err
+	}
+	if rules.DeviceSchedule != 0 {
+		rules.Schedules[rules.DeviceSchedule] = byId[rules.DeviceSchedule]
+	}
+
+	rows, err := s.db.Query(GetScheduledMembersQuery)
+	if err != nil {
+		return rules, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			tagId      uint64
+			scheduleId int64
+		)
+		if err := rows.Scan(&tagId, &scheduleId); err != nil {
+			return rules, err
+		}
+		rules.TagSchedules[tagId] = scheduleId
+		rules.Schedules[scheduleId] = byId[scheduleId]
+	}
+	return rules, rows.Err()
+}
+
+// deviceScheduleDecision denies access when the schedule attached to the
+// device is closed at now.
+func (s *DBService) deviceScheduleDecision(device models.Device, now time.Time) (models.AccessDecision, error) {
+	scheduleId, err := s.targetSchedule(models.ScheduleTargetDevice, device.MACAddress)
+	if err != nil {
+		return models.Deny("schedule lookup failed"), err
+	}
+	return s.checkSchedule(scheduleId, now, "device closed by schedule")
+}
+
+// memberScheduleDecision denies access when the schedule of the member
+// holding tagId, their own or their level's, is closed at now.
+func (s *DBService) memberScheduleDecision(tagId uint64, now time.Time) (models.AccessDecision, error) {
+	var scheduleId int64
+	if err := s.db.QueryRow(GetTagScheduleQuery, tagId).Scan(&scheduleId); err != nil && err != sql.ErrNoRows {
+		return models.Deny("schedule lookup failed"), err
+	}
+	return s.checkSchedule(scheduleId, now, "outside member's schedule")
+}
+
+func (s *DBService) checkSchedule(scheduleId int64, now time.Time, reason string) (models.AccessDecision, error) {
+	if scheduleId == 0 {
+		return models.Grant(), nil
+	}
+
+	schedule, err := s.GetSchedule(scheduleId)
+	if err != nil {
+		return models.Deny("schedule lookup failed"), err
+	}
+	if schedule != nil && !schedule.OpenAt(now, s.scheduleLocation(*schedule)) {
+		return models.Deny(reason), nil
+	}
+	return models.Grant(), nil
+}
+
+func (s *DBService) targetSchedule(targetType, target string) (int64, error) {
+	assignments, err := s.GetScheduleAssignments()
+	if err != nil {
+		return 0, err
+	}
+	for _, assignment := range assignments {
+		if assignment.TargetType == targetType && assignment.Target == target {
+			return assignment.ScheduleID, nil
+		}
+	}
+	return 0, nil
+}
+
+// scheduleLocation is the zone a schedule's times are in: its own, else
+// the configured timezone. A zone that fails to load falls back to UTC.
+func (s *DBService) scheduleLocation(schedule models.Schedule) *time.Location {
+	if schedule.Timezone == "" {
+		return s.siteLocation()
+	}
+	loc, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		s.log.Errorf("Unknown timezone %q for schedule %s, using UTC: %v", schedule.Timezone, schedule.Name, err)
+		return time.UTC
+	}
+	return loc
+}
+
+// siteLocation is the configured timezone of the space.
+func (s *DBService) siteLocation() *time.Location {
+	loc, err := time.LoadLocation(s.cfg.Timezone)
+	if err != nil {
+		s.log.Errorf("Unknown timezone %q, using UTC: %v", s.cfg.Timezone, err)
+		return time.UTC
+	}
+	return loc
+}
+
+func replaceScheduleRules(tx *sql.Tx, id int64, schedule models.Schedule) error {
+	if _, err := tx.Exec(DeleteScheduleWindowsQuery, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(DeleteScheduleHolidaysQuery, id); err != nil {
+		return err
+	}
+
+	for _, window := range schedule.Windows {
+		if _, err := tx.Exec(InsertScheduleWindowQuery, id, window.Weekday, window.Start, window.End); err != nil {
+			return err
+		}
+	}
+	for _, holiday := range schedule.Holidays {
+		if _, err := tx.Exec(InsertScheduleHolidayQuery, id, holiday.Date, holiday.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *DBService) validateSchedule(schedule models.Schedule) error {
+	if strings.TrimSpace(schedule.Name) == "" {
+		return ErrInvalidSchedule
+	}
+	if _, err := time.LoadLocation(schedule.Timezone); err != nil {
+		return ErrInvalidTimezone
+	}
+	for _, window := range schedule.Windows {
+		if !window.Valid() {
+			return ErrInvalidSchedule
+		}
+	}
+	for _, holiday := range schedule.Holidays {
+		if !holiday.Valid() {
+			return ErrInvalidSchedule
+		}
+	}
+
+	existing, err := s.GetSchedules()
+	if err != nil {
+		return err
+	}
+	for _, other := range existing {
+		if other.Name == schedule.Name && other.ID != schedule.ID {
+			return ErrScheduleExists
+		}
+	}
+	return nil
+}
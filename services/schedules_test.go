@@ -0,0 +1,110 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"rfid-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedulesRestrictAccess(t *testing.T) {
+	db := setupTestDB(t)
+	dbService := NewDBService(db, mockConfig(), testLogger())
+
+	_, err := db.Exec("INSERT INTO members (contact_id, tag_id, membership_level) VALUES (1, 111, 10), (2, 222, 20), (3, 333, 10)")
+	require.NoError(t, err)
+
+	door := models.DeviceDetails{Name: "Front Door", Type: models.DeviceTypeDoor, Enabled: true}
+	require.NoError(t, dbService.CreateDevice("AA:AA:AA:AA:AA:AA", door))
+	_, err = dbService.ApproveDevice("AA:AA:AA:AA:AA:AA", door)
+	require.NoError(t, err)
+	device, err := dbService.GetDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+
+	// Associates (level 10) get 9am-10pm on Mondays, except on a holiday
+	associate := models.Schedule{
+		Name:     "Associate hours",
+		Timezone: "America/New_York",
+		Windows:  []models.ScheduleWindow{{Weekday: 1, Start: "09:00", End: "22:00"}},
+		Holidays: []models.Holiday{{Date: "2026-12-28", Name: "Winter break"}},
+	}
+	associateId, err := dbService.CreateSchedule(associate)
+	require.NoError(t, err)
+	require.NoError(t, dbService.AssignSchedule(models.ScheduleTargetLevel, "10", associateId))
+
+	_, err = dbService.CreateSchedule(associate)
+	assert.Equal(t, ErrScheduleExists, err)
+	_, err = dbService.CreateSchedule(models.Schedule{Name: "Bad", Windows: []models.ScheduleWindow{{Weekday: 1, Start: "22:00", End: "09:00"}}})
+	assert.Equal(t, ErrInvalidSchedule, err)
+	_, err = dbService.CreateSchedule(models.Schedule{Name: "Bad", Timezone: "Mars/Olympus_Mons"})
+	assert.Equal(t, ErrInvalidTimezone, err)
+
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	mondayEvening := time.Date(2026, 10, 19, 21, 30, 0, 0, newYork)
+	mondayNight := time.Date(2026, 10, 19, 22, 30, 0, 0, newYork)
+	holiday := time.Date(2026, 12, 28, 12, 0, 0, 0, newYork)
+
+	decide := func(tag string, at time.Time) models.AccessDecision {
+		decision, err := dbService.AuthorizeTagAt(*device, tag, at)
+		require.NoError(t, err)
+		return decision
+	}
+
+	assert.True(t, decide("111", mondayEvening).Granted)
+	assert.Equal(t, models.Deny("outside member's schedule"), decide("111", mondayNight))
+	assert.Equal(t, models.Deny("outside member's schedule"), decide("111", holiday))
+	assert.True(t, decide("222", mondayNight).Granted)
+
+	// A member's own schedule replaces their level's
+	always := models.Schedule{Name: "Keyholder", Windows: []models.ScheduleWindow{}}
+	for day := 0; day < 7; day++ {
+		always.Windows = append(always.Windows, models.ScheduleWindow{Weekday: day, Start: "00:00", End: "24:00"})
+	}
+	alwaysId, err := dbService.CreateSchedule(always)
+	require.NoError(t, err)
+	require.NoError(t, dbService.AssignSchedule(models.ScheduleTargetMember, "3", alwaysId))
+	assert.True(t, decide("333", mondayNight).Granted)
+
+	// The shop closes Mondays for cleaning
+	cleaning := models.Schedule{Name: "Shop hours", Timezone: "America/New_York", Windows: []models.ScheduleWindow{{Weekday: 2, Start: "00:00", End: "24:00"}}}
+	cleaningId, err := dbService.CreateSchedule(cleaning)
+	require.NoError(t, err)
+	require.NoError(t, dbService.AssignSchedule(models.ScheduleTargetDevice, device.MACAddress, cleaningId))
+	assert.Equal(t, models.Deny("device closed by schedule"), decide("222", mondayNight))
+
+	rules, err := dbService.GetCacheSchedules(*device)
+	require.NoError(t, err)
+	assert.Equal(t, cleaningId, rules.DeviceSchedule)
+	assert.Equal(t, map[uint64]int64{111: associateId, 333: alwaysId}, rules.TagSchedules)
+	assert.Len(t, rules.Schedules, 3)
+	assert.Equal(t, "UTC", rules.Schedules[alwaysId].Timezone)
+
+	require.NoError(t, dbService.DeleteSchedule(cleaningId))
+	assert.True(t, decide("222", mondayNight).Granted)
+	assert.Equal(t, ErrScheduleNotFound, dbService.DeleteSchedule(cleaningId))
+	assert.Equal(t, ErrInvalidScheduleTarget, dbService.AssignSchedule("room", "1", alwaysId))
+}
+
+func TestLevelChangeResetsReaders(t *testing.T) {
+	db := setupTestDB(t)
+	dbService := NewDBService(db, mockConfig(), testLogger())
+
+	_, err := db.Exec("INSERT INTO members (contact_id, tag_id, membership_level) VALUES (1, 111, 10)")
+	require.NoError(t, err)
+
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	change, err := dbService.trackAccessChanges(tx, func() error {
+		return dbService.insertActiveMember(tx, 1, 111, 20, false)
+	})
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+
+	assert.True(t, change.Reset)
+	assert.Empty(t, change.Tags)
+	assert.Empty(t, change.MACAddress)
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"errors"
+	"rfid-backend/models"
+	"time"
+)
+
+var ErrInvalidSpaceMode = errors.New("space mode must be normal, unlocked or lockdown")
+
+const maxSpaceModeChangesListed = 100
+
+// GetSpaceMode returns the space-wide mode in effect.
+func (s *DBService) GetSpaceMode() (models.SpaceMode, error) {
+	changes, err := s.GetSpaceModeChanges(1)
+	if err != nil || len(changes) == 0 {
+		return models.SpaceMode{Mode: models.SpaceModeNormal}, err
+	}
+	return changes[0], nil
+}
+
+// SetSpaceMode switches every reader to mode and records who did it. All
+// readers are reset so their caches follow the new mode.
+func (s *DBService) SetSpaceMode(mode, reason, changedBy string) (models.SpaceMode, error) {
+	switch mode {
+	case models.SpaceModeNormal, models.SpaceModeUnlocked, models.SpaceModeLockdown:
+	default:
+		return models.SpaceMode{}, ErrInvalidSpaceMode
+	}
+
+	change := models.SpaceMode{Mode: mode, Reason: reason, ChangedBy: changedBy, ChangedAt: time.Now().UTC()}
+	res, err := s.db.Exec(InsertSpaceModeChangeQuery, change.Mode, change.Reason, change.ChangedBy, change.ChangedAt)
+	if err != nil {
+		return change, err
+	}
+	if change.ID, err = res.LastInsertId(); err != nil {
+		return change, err
+	}
+
+	s.publishDeviceReset("")
+	return change, nil
+}
+
+// GetSpaceModeChanges returns the latest mode changes, newest first.
+func (s *DBService) GetSpaceModeChanges(limit int) ([]models.SpaceMode, error) {
+	if limit <= 0 || limit > maxSpaceModeChangesListed {
+		limit = maxSpaceModeChangesListed
+	}
+
+	rows, err := s.db.Query(GetSpaceModeChangesQuery, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []models.SpaceMode{}
+	for rows.Next() {
+		var change models.SpaceMode
+		if err := rows.Scan(&change.ID, &change.Mode, &change.Reason, &change.ChangedBy, &change.ChangedAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+// lockdownDecision lets a tag that would otherwise pass through a lockdown
+// only if it belongs to a Wild Apricot account administrator.
+func (s *DBService) lockdownDecision(tagId uint64) (models.AccessDecision, error) {
+	var admin bool
+	if err := s.db.QueryRow(IsAdminTagQuery, tagId).Scan(&admin); err != nil {
+		return models.Deny("admin lookup failed"), err
+	}
+	if !admin {
+		return models.Deny("space is in lockdown"), nil
+	}
+	return models.Grant(), nil
+}
+
+// lockdownTags narrows tagIds to those of admins.
+func (s *DBService) lockdownTags(tagIds []uint64) ([]uint64, error) {
+	admins, err := adminTags(s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []uint64{}
+	for _, tagId := range tagIds {
+		if admins[tagId] {
+			result = append(result, tagId)
+		}
+	}
+	return result, nil
+}
+
+// adminTags is the set of tags belonging to admins.
+func adminTags(db querier) (map[uint64]bool, error) {
+	rows, err := db.Query(GetAdminTagIdsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	admins := make(map[uint64]bool)
+	for rows.Next() {
+		var tagId uint64
+		if err := rows.Scan(&tagId); err != nil {
+			return nil, err
+		}
+		admins[tagId] = true
+	}
+	return admins, rows.Err()
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"rfid-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpaceMode(t *testing.T) {
+	db := setupTestDB(t)
+	dbService := NewDBService(db, mockConfig(), testLogger())
+
+	_, err := db.Exec(`INSERT INTO members (contact_id, tag_id, membership_level, is_admin) VALUES (1, 111, 1, 1), (2, 222, 1, 0);
+		INSERT INTO trainings (label) VALUES ('Laser'), ('Keyholder');
+		INSERT INTO members_trainings_link (tag_id, label) VALUES (111, 'Laser'), (222, 'Laser'), (222, 'Keyholder')`)
+	require.NoError(t, err)
+
+	door := models.DeviceDetails{Name: "Front Door", Type: models.DeviceTypeDoor, Enabled: true}
+	require.NoError(t, dbService.CreateDevice("AA:AA:AA:AA:AA:AA", door))
+	_, err = dbService.ApproveDevice("AA:AA:AA:AA:AA:AA", door)
+	require.NoError(t, err)
+	laser := models.DeviceDetails{Name: "Laser", Type: models.DeviceTypeMachine, Enabled: true, TrainingLabels: []string{"Laser"}}
+	require.NoError(t, dbService.CreateDevice("BB:BB:BB:BB:BB:BB", laser))
+	_, err = dbService.ApproveDevice("BB:BB:BB:BB:BB:BB", laser)
+	require.NoError(t, err)
+	front, err := dbService.GetDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+	cutter, err := dbService.GetDevice("BB:BB:BB:BB:BB:BB")
+	require.NoError(t, err)
+
+	mode, err := dbService.GetSpaceMode()
+	require.NoError(t, err)
+	assert.Equal(t, models.SpaceModeNormal, mode.Mode)
+
+	_, err = dbService.SetSpaceMode("party", "", "Admin")
+	assert.Equal(t, ErrInvalidSpaceMode, err)
+
+	decide := func(device *models.Device, tag string) models.AccessDecision {
+		decision, err := dbService.AuthorizeTagAt(*device, tag, time.Now())
+		require.NoError(t, err)
+		return decision
+	}
+	assert.False(t, decide(front, "999").Granted)
+
+	// Unlocked opens doors for anyone, but not machines
+	_, err = dbService.SetSpaceMode(models.SpaceModeUnlocked, "fire alarm", "Admin")
+	require.NoError(t, err)
+	assert.True(t, decide(front, "999").Granted)
+	assert.False(t, decide(cutter, "999").Granted)
+	decision, anomalies, err := dbService.ScreenAccess(*front, "999", decide(front, "999"), time.Now())
+	require.NoError(t, err)
+	assert.True(t, decision.Granted)
+	assert.Empty(t, anomalies)
+
+	// Lockdown lets only admins through, keyholders or not, on their usual rules
+	_, err = dbService.SetSpaceMode(models.SpaceModeLockdown, "police request", "Admin")
+	require.NoError(t, err)
+	assert.True(t, decide(front, "111").Granted)
+	assert.True(t, decide(cutter, "111").Granted)
+	denied := decide(front, "222")
+	assert.False(t, denied.Granted)
+	assert.Equal(t, "space is in lockdown", denied.Reason)
+	assert.False(t, decide(front, "999").Granted)
+
+	tagIds, err := dbService.GetDeviceCacheTags(*front)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{111}, tagIds)
+	add, _, err := dbService.DeviceAccessDelta(*cutter, []TagChange{{TagId: 222, IsMember: true, After: []string{"Laser"}}})
+	require.NoError(t, err)
+	assert.Empty(t, add)
+
+	_, err = dbService.SetSpaceMode(models.SpaceModeNormal, "", "Admin")
+	require.NoError(t, err)
+	assert.True(t, decide(front, "222").Granted)
+
+	changes, err := dbService.GetSpaceModeChanges(0)
+	require.NoError(t, err)
+	require.Len(t, changes, 3)
+	assert.Equal(t, models.SpaceModeNormal, changes[0].Mode)
+	assert.Equal(t, "police request", changes[1].Reason)
+	assert.Equal(t, "Admin", changes[2].ChangedBy)
+}
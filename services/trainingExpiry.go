@@ -0,0 +1,247 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"rfid-backend/models"
+	"sort"
+	"time"
+)
+
+var (
+	ErrTrainingNotFound        = errors.New("training not found")
+	ErrInvalidTrainingValidity = errors.New("validity must be zero (never lapses) or a positive number of days")
+	ErrMemberTrainingNotFound  = errors.New("member does not hold that training")
+)
+
+// GetTrainings returns every training label with its validity period and
+// the trainings it requires and implies.
+func (s *DBService) GetTrainings() ([]models.Training, error) {
+	graph, err := s.GetTrainingGraph()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(GetTrainingsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trainings := []models.Training{}
+	for rows.Next() {
+		var t models.Training
+		if err := rows.Scan(&t.Label, &t.ValidityDays); err != nil {
+			return nil, err
+		}
+		t.Requires = append([]string{}, graph.Requires[t.Label]...)
+		t.Implies = append([]string{}, graph.Implies[t.Label]...)
+		trainings = append(trainings, t)
+	}
+	return trainings, rows.Err()
+}
+
+// SetTrainingValidity sets how many days a grant of label stays valid, 0
+// for never, and expires or restores members' grants to match.
+func (s *DBService) SetTrainingValidity(label string, days int, now time.Time) error {
+	if days < 0 {
+		return ErrInvalidTrainingValidity
+	}
+	res, err := s.db.Exec(SetTrainingValidityQuery, days, label)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrTrainingNotFound
+	}
+
+	_, err = s.SweepTrainingExpiry(now)
+	return err
+}
+
+// GetMemberTrainings returns the trainings current members hold, with when
+// each was granted and expires.
+func (s *DBService) GetMemberTrainings() ([]models.MemberTraining, error) {
+	return memberTrainings(s.db)
+}
+
+// GetTrainingsDue returns the grants that have expired or expire within the
+// given time of now, soonest first, for members to recertify.
+func (s *DBService) GetTrainingsDue(now time.Time, within time.Duration) ([]models.MemberTraining, error) {
+	trainings, err := s.GetMemberTrainings()
+	if err != nil {
+		return nil, err
+	}
+
+	due := []models.MemberTraining{}
+	for _, t := range trainings {
+		if t.Expired || t.ExpiredAt(now.Add(within)) {
+			due = append(due, t)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].ExpiresAt.Before(due[j].ExpiresAt) })
+	return due, nil
+}
+
+// Recertify renews a member's training from now, restoring it if it had
+// expired. Readers pick the change up like any other training change.
+func (s *DBService) Recertify(contactId int, label string, now time.Time) error {
+	var tagId uint64
+	err := s.db.QueryRow(GetMemberTagQuery, contactId).Scan(&tagId)
+	if err == sql.ErrNoRows {
+		return ErrMemberTrainingNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	change, err := s.trackAccessChanges(tx, func() error {
+		res, err := tx.Exec(RecertifyTrainingQuery, now.UTC(), tagId, label)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrMemberTrainingNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.publishAccessChange(change)
+	return nil
+}
+
+// SweepTrainingExpiry marks grants expired once their validity runs out,
+// and restores ones a longer validity brought back, recording the access
+// changes for readers. It returns the grants that expired.
+func (s *DBService) SweepTrainingExpiry(now time.Time) ([]models.MemberTraining, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var expired []models.MemberTraining
+	change, err := s.trackAccessChanges(tx, func() error {
+		trainings, err := memberTrainings(tx)
+		if err != nil {
+			return err
+		}
+		for _, t := range trainings {
+			lapsed := t.ExpiredAt(now)
+			if lapsed == t.Expired {
+				continue
+			}
+			if _, err := tx.Exec(SetTrainingExpiredQuery, lapsed, t.TagId, t.Label); err != nil {
+				return err
+			}
+			if lapsed {
+				t.Expired = true
+				expired = append(expired, t)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	s.publishAccessChange(change)
+	return expired, nil
+}
+
+// TrainingReminders returns the grants expiring within
+// training_reminder_lead that no reminder was sent for yet, and marks them
+// reminded.
+func (s *DBService) TrainingReminders(now time.Time) ([]models.MemberTraining, error) {
+	trainings, err := s.GetMemberTrainings()
+	if err != nil {
+		return nil, err
+	}
+
+	var due []models.MemberTraining
+	for _, t := range trainings {
+		if t.Expired || !t.RemindedAt.IsZero() || !t.ExpiredAt(now.Add(s.cfg.TrainingReminderLead)) {
+			continue
+		}
+		if _, err := s.db.Exec(SetTrainingRemindedQuery, now.UTC(), t.TagId, t.Label); err != nil {
+			return due, err
+		}
+		due = append(due, t)
+	}
+	return due, nil
+}
+
+// missingTrainingDecision explains a missing-training denial: if the
+// member's expired trainings would have met the requirement, they need to
+// recertify rather than train, and if trainings they were granted would
+// have met it, they are still missing a prerequisite.
+func (s *DBService) missingTrainingDecision(req models.TrainingRequirement, tagId uint64, held []string) (models.AccessDecision, error) {
+	lapsed, err := s.tagLabels(GetTagExpiredTrainingLabelsQuery, tagId)
+	if err != nil {
+		return models.Deny("training lookup failed"), err
+	}
+	graph, err := s.GetTrainingGraph()
+	if err != nil {
+		return models.Deny("training lookup failed"), err
+	}
+	if len(lapsed) > 0 && req.SatisfiedBy(graph.Effective(append(held, lapsed...))) {
+		return models.Deny("training expired"), nil
+	}
+
+	granted, err := s.tagLabels(GetTagTrainingLabelsQuery, tagId)
+	if err != nil {
+		return models.Deny("training lookup failed"), err
+	}
+	if req.SatisfiedBy(models.TrainingGraph{Implies: graph.Implies}.Effective(granted)) {
+		return models.Deny("missing prerequisite training"), nil
+	}
+	return models.Deny("missing training"), nil
+}
+
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func memberTrainings(db querier) ([]models.MemberTraining, error) {
+	rows, err := db.Query(GetMemberTrainingsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trainings := []models.MemberTraining{}
+	for rows.Next() {
+		var (
+			t                     models.MemberTraining
+			grantedAt, remindedAt sql.NullTime
+			validityDays          int
+		)
+		if err := rows.Scan(&t.ContactId, &t.TagId, &t.Label, &grantedAt, &t.Expired, &remindedAt, &validityDays); err != nil {
+			return nil, err
+		}
+		t.GrantedAt = grantedAt.Time
+		t.RemindedAt = remindedAt.Time
+		if validityDays > 0 && grantedAt.Valid {
+			t.ExpiresAt = t.GrantedAt.AddDate(0, 0, validityDays)
+		}
+		trainings = append(trainings, t)
+	}
+	return trainings, rows.Err()
+}
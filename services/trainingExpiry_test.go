@@ -0,0 +1,104 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"rfid-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrainingExpiry(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := mockConfig()
+	cfg.TrainingReminderLead = 30 * 24 * time.Hour
+	dbService := NewDBService(db, cfg, testLogger())
+
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	_, err := db.Exec(`INSERT INTO members (contact_id, tag_id, membership_level) VALUES (1, 111, 1), (2, 222, 1), (3, 333, 1);
+		INSERT INTO trainings (label) VALUES ('Laser'), ('Shop Basics')`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO members_trainings_link (tag_id, label, granted_at) VALUES (111, 'Laser', ?), (222, 'Laser', ?),
+		(333, 'Laser', ?), (111, 'Shop Basics', ?)`,
+		now.AddDate(0, 0, -400), now.AddDate(0, 0, -350), now.AddDate(0, 0, -10), now.AddDate(0, 0, -400))
+	require.NoError(t, err)
+
+	laser := models.DeviceDetails{Name: "Laser", Type: models.DeviceTypeMachine, Enabled: true, TrainingLabels: []string{"Laser"}}
+	require.NoError(t, dbService.CreateDevice("BB:BB:BB:BB:BB:BB", laser))
+	_, err = dbService.ApproveDevice("BB:BB:BB:BB:BB:BB", laser)
+	require.NoError(t, err)
+	cutter, err := dbService.GetDevice("BB:BB:BB:BB:BB:BB")
+	require.NoError(t, err)
+
+	seq, err := dbService.CurrentAccessSequence()
+	require.NoError(t, err)
+
+	assert.Equal(t, ErrInvalidTrainingValidity, dbService.SetTrainingValidity("Laser", -1, now))
+	assert.Equal(t, ErrTrainingNotFound, dbService.SetTrainingValidity("Welding", 365, now))
+
+	// An annual refresher lapses the grant from 400 days ago only
+	require.NoError(t, dbService.SetTrainingValidity("Laser", 365, now))
+	trainings, err := dbService.GetTrainings()
+	require.NoError(t, err)
+	require.Len(t, trainings, 2)
+	assert.Equal(t, "Laser", trainings[0].Label)
+	assert.Equal(t, 365, trainings[0].ValidityDays)
+	assert.Equal(t, 0, trainings[1].ValidityDays)
+
+	decide := func(tag string) models.AccessDecision {
+		decision, err := dbService.AuthorizeTagAt(*cutter, tag, now)
+		require.NoError(t, err)
+		return decision
+	}
+	assert.Equal(t, models.Deny("training expired"), decide("111"))
+	assert.True(t, decide("222").Granted)
+
+	tagIds, err := dbService.GetDeviceCacheTags(*cutter)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []uint64{222, 333}, tagIds)
+	delta, err := dbService.GetCacheDelta(*cutter, seq)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{111}, delta.Remove)
+
+	// The lapsed grant and the one expiring within a month are due
+	due, err := dbService.GetTrainingsDue(now, 30*24*time.Hour)
+	require.NoError(t, err)
+	require.Len(t, due, 2)
+	assert.Equal(t, uint64(111), due[0].TagId)
+	assert.True(t, due[0].Expired)
+	assert.Equal(t, uint64(222), due[1].TagId)
+	assert.True(t, now.AddDate(0, 0, 15).Equal(due[1].ExpiresAt))
+
+	reminders, err := dbService.TrainingReminders(now)
+	require.NoError(t, err)
+	require.Len(t, reminders, 1)
+	assert.Equal(t, 2, reminders[0].ContactId)
+	reminders, err = dbService.TrainingReminders(now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, reminders, "each grant is reminded once")
+
+	// The sweep lapses grants as time passes
+	expired, err := dbService.SweepTrainingExpiry(now.AddDate(0, 0, 16))
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+	assert.Equal(t, uint64(222), expired[0].TagId)
+
+	// Recertifying renews the grant from now
+	assert.Equal(t, ErrMemberTrainingNotFound, dbService.Recertify(1, "Welding", now))
+	assert.Equal(t, ErrMemberTrainingNotFound, dbService.Recertify(9, "Laser", now))
+	require.NoError(t, dbService.Recertify(1, "Laser", now))
+	assert.True(t, decide("111").Granted)
+	expired, err = dbService.SweepTrainingExpiry(now.AddDate(0, 0, 364))
+	require.NoError(t, err)
+	require.Len(t, expired, 1, "only the grant from ten days ago lapses")
+	assert.Equal(t, uint64(333), expired[0].TagId)
+
+	// Making the training permanent restores every lapsed grant
+	require.NoError(t, dbService.SetTrainingValidity("Laser", 0, now.AddDate(0, 0, 16)))
+	assert.True(t, decide("222").Granted)
+	due, err = dbService.GetTrainingsDue(now, 30*24*time.Hour)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+}
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"rfid-backend/models"
+	"sort"
+)
+
+var (
+	ErrInvalidTrainingRelations = errors.New("a training cannot require or imply itself, or both require and imply the same training")
+	ErrUnknownRelatedTraining   = errors.New("required and implied trainings must be known trainings")
+	ErrTrainingCycle            = errors.New("trainings cannot require or imply one another in a cycle")
+	ErrMemberNotFound           = errors.New("member not found")
+)
+
+// GetTrainingGraph returns how trainings require and imply one another.
+func (s *DBService) GetTrainingGraph() (models.TrainingGraph, error) {
+	return trainingGraph(s.db)
+}
+
+// SetTrainingRelations replaces the trainings label requires and implies.
+// Members' access changes at once: a training stops counting for members
+// missing a new prerequisite, and implied trainings count for its holders.
+func (s *DBService) SetTrainingRelations(label string, requires, implies []string) error {
+	requires, implies = uniqueLabels(requires), uniqueLabels(implies)
+	trainings, err := s.GetTrainings()
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(trainings))
+	for _, t := range trainings {
+		known[t.Label] = true
+	}
+	if !known[label] {
+		return ErrTrainingNotFound
+	}
+	required := make(map[string]bool, len(requires))
+	for _, related := range requires {
+		required[related] = true
+	}
+	for _, related := range append(requires, implies...) {
+		if !known[related] {
+			return ErrUnknownRelatedTraining
+		}
+	}
+	for _, related := range implies {
+		if related == label || required[related] {
+			return ErrInvalidTrainingRelations
+		}
+	}
+	if required[label] {
+		return ErrInvalidTrainingRelations
+	}
+
+	graph, err := s.GetTrainingGraph()
+	if err != nil {
+		return err
+	}
+	graph.Requires[label], graph.Implies[label] = requires, implies
+	if models.Cycle(graph.Requires) != nil || models.Cycle(graph.Implies) != nil {
+		return ErrTrainingCycle
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	change, err := s.trackAccessChanges(tx, func() error {
+		if _, err := tx.Exec(DeleteTrainingRelationsQuery, label); err != nil {
+			return err
+		}
+		for relation, related := range map[string][]string{
+			models.TrainingRelationRequires: requires,
+			models.TrainingRelationImplies:  implies,
+		} {
+			for _, r := range related {
+				if _, err := tx.Exec(InsertTrainingRelationQuery, label, r, relation); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.publishAccessChange(change)
+	return nil
+}
+
+// GetTrainingProgress returns where a member stands with every training:
+// which count, which wait on prerequisites and what they still need.
+func (s *DBService) GetTrainingProgress(contactId int) ([]models.TrainingProgress, error) {
+	var tagId uint64
+	err := s.db.QueryRow(GetMemberTagQuery, contactId).Scan(&tagId)
+	if err == sql.ErrNoRows {
+		return nil, ErrMemberNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	trainings, err := s.GetTrainings()
+	if err != nil {
+		return nil, err
+	}
+	labels := make([]string, 0, len(trainings))
+	for _, t := range trainings {
+		labels = append(labels, t.Label)
+	}
+
+	var granted, lapsed []string
+	held, err := s.GetMemberTrainings()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range held {
+		switch {
+		case t.ContactId != contactId:
+		case t.Expired:
+			lapsed = append(lapsed, t.Label)
+		default:
+			granted = append(granted, t.Label)
+		}
+	}
+
+	graph, err := s.GetTrainingGraph()
+	if err != nil {
+		return nil, err
+	}
+	return graph.Progress(labels, granted, lapsed), nil
+}
+
+// GetPrerequisiteGaps returns the trainings members were granted that do
+// not count yet because they lack prerequisites.
+func (s *DBService) GetPrerequisiteGaps() ([]models.PrerequisiteGap, error) {
+	trainings, err := s.GetMemberTrainings()
+	if err != nil {
+		return nil, err
+	}
+	graph, err := s.GetTrainingGraph()
+	if err != nil {
+		return nil, err
+	}
+
+	granted := make(map[int][]string)
+	var contactIds []int
+	tagIds := make(map[int]uint64)
+	for _, t := range trainings {
+		if t.Expired {
+			continue
+		}
+		if _, seen := tagIds[t.ContactId]; !seen {
+			contactIds = append(contactIds, t.ContactId)
+			tagIds[t.ContactId] = t.TagId
+		}
+		granted[t.ContactId] = append(granted[t.ContactId], t.Label)
+	}
+
+	gaps := []models.PrerequisiteGap{}
+	for _, contactId := range contactIds {
+		effective := graph.Effective(granted[contactId])
+		counts := make(map[string]bool, len(effective))
+		for _, label := range effective {
+			counts[label] = true
+		}
+		for _, label := range granted[contactId] {
+			if !counts[label] {
+				gaps = append(gaps, models.PrerequisiteGap{
+					ContactId: contactId,
+					TagId:     tagIds[contactId],
+					Label:     label,
+					Missing:   graph.Missing(label, effective),
+				})
+			}
+		}
+	}
+	return gaps, nil
+}
+
+// warnPrerequisiteGaps logs the synced trainings that will not count until
+// the member holds their prerequisites, for the given contacts or, with
+// none given, every member.
+func (s *DBService) warnPrerequisiteGaps(contactIds ...int) {
+	gaps, err := s.GetPrerequisiteGaps()
+	if err != nil {
+		s.log.Errorf("Failed to check training prerequisites: %v", err)
+		return
+	}
+
+	only := make(map[int]bool, len(contactIds))
+	for _, contactId := range contactIds {
+		only[contactId] = true
+	}
+	for _, gap := range gaps {
+		if len(only) > 0 && !only[gap.ContactId] {
+			continue
+		}
+		s.log.Warnf("Contact %d holds training %s without its prerequisites %v; it will not count until they are trained",
+			gap.ContactId, gap.Label, gap.Missing)
+	}
+}
+
+func trainingGraph(db querier) (models.TrainingGraph, error) {
+	graph := models.TrainingGraph{
+		Requires: make(map[string][]string),
+		Implies:  make(map[string][]string),
+	}
+
+	rows, err := db.Query(GetTrainingRelationsQuery)
+	if err != nil {
+		return graph, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var label, related, relation string
+		if err := rows.Scan(&label, &related, &relation); err != nil {
+			return graph, err
+		}
+		switch relation {
+		case models.TrainingRelationRequires:
+			graph.Requires[label] = append(graph.Requires[label], related)
+		case models.TrainingRelationImplies:
+			graph.Implies[label] = append(graph.Implies[label], related)
+		}
+	}
+	return graph, rows.Err()
+}
+
+// uniqueLabels drops blank and repeated labels and sorts the rest.
+func uniqueLabels(labels []string) []string {
+	seen := make(map[string]bool, len(labels))
+	unique := []string{}
+	for _, label := range labels {
+		if label != "" && !seen[label] {
+			seen[label] = true
+			unique = append(unique, label)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"testing"
+
+	"rfid-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrainingGraph(t *testing.T) {
+	db := setupTestDB(t)
+	dbService := NewDBService(db, mockConfig(), testLogger())
+
+	_, err := db.Exec(`INSERT INTO members (contact_id, tag_id, membership_level) VALUES (1, 111, 1), (2, 222, 1), (3, 333, 1);
+		INSERT INTO trainings (label) VALUES ('Shop Basics'), ('CNC Router'), ('Laser'), ('Advanced Laser');
+		INSERT INTO members_trainings_link (tag_id, label) VALUES (111, 'CNC Router'), (222, 'CNC Router'), (222, 'Shop Basics'),
+			(333, 'Advanced Laser')`)
+	require.NoError(t, err)
+
+	machine := func(mac, label string) models.Device {
+		details := models.DeviceDetails{Name: label, Type: models.DeviceTypeMachine, Enabled: true, TrainingLabels: []string{label}}
+		require.NoError(t, dbService.CreateDevice(mac, details))
+		_, err := dbService.ApproveDevice(mac, details)
+		require.NoError(t, err)
+		device, err := dbService.GetDevice(mac)
+		require.NoError(t, err)
+		return *device
+	}
+	router := machine("AA:AA:AA:AA:AA:AA", "CNC Router")
+	laser := machine("BB:BB:BB:BB:BB:BB", "Laser")
+
+	decide := func(device models.Device, tag string) models.AccessDecision {
+		decision, err := dbService.AuthorizeTag(device, tag)
+		require.NoError(t, err)
+		return decision
+	}
+	assert.True(t, decide(router, "111").Granted)
+	assert.Equal(t, models.Deny("missing training"), decide(laser, "333"))
+
+	seq, err := dbService.CurrentAccessSequence()
+	require.NoError(t, err)
+
+	assert.Equal(t, ErrTrainingNotFound, dbService.SetTrainingRelations("Welding", []string{"Shop Basics"}, nil))
+	assert.Equal(t, ErrUnknownRelatedTraining, dbService.SetTrainingRelations("CNC Router", []string{"Welding"}, nil))
+	assert.Equal(t, ErrInvalidTrainingRelations, dbService.SetTrainingRelations("CNC Router", []string{"CNC Router"}, nil))
+	assert.Equal(t, ErrInvalidTrainingRelations, dbService.SetTrainingRelations("CNC Router", []string{"Shop Basics"}, []string{"Shop Basics"}))
+
+	// A prerequisite holds back members who lack it
+	require.NoError(t, dbService.SetTrainingRelations("CNC Router", []string{"Shop Basics"}, nil))
+	assert.Equal(t, models.Deny("missing prerequisite training"), decide(router, "111"))
+	assert.True(t, decide(router, "222").Granted)
+
+	tagIds, err := dbService.GetDeviceCacheTags(router)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{222}, tagIds)
+	delta, err := dbService.GetCacheDelta(router, seq)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{111}, delta.Remove)
+
+	assert.Equal(t, ErrTrainingCycle, dbService.SetTrainingRelations("Shop Basics", []string{"CNC Router"}, nil))
+
+	// An implied training counts like a granted one
+	require.NoError(t, dbService.SetTrainingRelations("Advanced Laser", nil, []string{"Laser"}))
+	assert.True(t, decide(laser, "333").Granted)
+	tagIds, err = dbService.GetDeviceCacheTags(laser)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{333}, tagIds)
+	assert.Equal(t, ErrTrainingCycle, dbService.SetTrainingRelations("Laser", nil, []string{"Advanced Laser"}))
+
+	trainings, err := dbService.GetTrainings()
+	require.NoError(t, err)
+	require.Len(t, trainings, 4)
+	assert.Equal(t, "CNC Router", trainings[1].Label)
+	assert.Equal(t, []string{"Shop Basics"}, trainings[1].Requires)
+	assert.Equal(t, []string{"Laser"}, trainings[0].Implies)
+
+	gaps, err := dbService.GetPrerequisiteGaps()
+	require.NoError(t, err)
+	assert.Equal(t, []models.PrerequisiteGap{{ContactId: 1, TagId: 111, Label: "CNC Router", Missing: []string{"Shop Basics"}}}, gaps)
+
+	progress, err := dbService.GetTrainingProgress(1)
+	require.NoError(t, err)
+	assert.Equal(t, []models.TrainingProgress{
+		{Label: "Advanced Laser", Status: models.TrainingStatusAvailable},
+		{Label: "CNC Router", Status: models.TrainingStatusBlocked, Missing: []string{"Shop Basics"}},
+		{Label: "Laser", Status: models.TrainingStatusAvailable},
+		{Label: "Shop Basics", Status: models.TrainingStatusAvailable},
+	}, progress)
+	progress, err = dbService.GetTrainingProgress(3)
+	require.NoError(t, err)
+	assert.Equal(t, models.TrainingStatusHeld, progress[0].Status)
+	assert.Equal(t, models.TrainingProgress{Label: "CNC Router", Status: models.TrainingStatusLocked, Missing: []string{"Shop Basics"}}, progress[1])
+	assert.Equal(t, models.TrainingStatusImplied, progress[2].Status)
+	_, err = dbService.GetTrainingProgress(9)
+	assert.Equal(t, ErrMemberNotFound, err)
+
+	// Dropping the prerequisite lets the training count again
+	require.NoError(t, dbService.SetTrainingRelations("CNC Router", nil, nil))
+	assert.True(t, decide(router, "111").Granted)
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"rfid-backend/models"
+	"time"
+)
+
+var ErrInvalidTwoPersonRule = errors.New("two-person rules apply to machines and must be partner, keyholder or empty; a partner rule needs a positive partner window")
+
+// reasonAwaitingPartner denies the first swipe under a partner rule. It is
+// also how the access log marks the swipe a partner can pair with.
+const reasonAwaitingPartner = "waiting for a second person"
+
+// SetTwoPersonRule requires a second person before a machine starts. The
+// window only matters to partner rules; other rules keep the stored one
+// when given none. The machine's cache is emptied, since a reader cannot
+// check the rule offline.
+func (s *DBService) SetTwoPersonRule(mac, rule string, windowSeconds int) error {
+	device, err := s.GetDevice(mac)
+	if err != nil {
+		return err
+	}
+	if device == nil {
+		return ErrDeviceNotFound
+	}
+	if device.Type != models.DeviceTypeMachine {
+		return ErrInvalidTwoPersonRule
+	}
+	switch rule {
+	case models.TwoPersonPartner:
+		if windowSeconds <= 0 {
+			return ErrInvalidTwoPersonRule
+		}
+	case models.TwoPersonNone, models.TwoPersonKeyholder:
+		if windowSeconds <= 0 {
+			windowSeconds = device.PartnerWindowSeconds
+		}
+	default:
+		return ErrInvalidTwoPersonRule
+	}
+
+	if _, err := s.db.Exec(SetTwoPersonRuleQuery, rule, windowSeconds, mac); err != nil {
+		return err
+	}
+	s.publishDeviceReset(mac)
+	return nil
+}
+
+// twoPersonDecision applies device's two-person rule to a tag that is
+// otherwise allowed in. Under a partner rule the first swipe is denied and
+// a second, different authorized tag within the window is granted with the
+// first as its partner. Under a keyholder rule a keyholder other than the
+// tag's holder must be in the space.
+func (s *DBService) twoPersonDecision(device models.Device, tagId uint64, now time.Time) (models.AccessDecision, error) {
+	var (
+		partner uint64
+		err     error
+	)
+	switch device.TwoPersonRule {
+	case models.TwoPersonNone:
+		return models.Grant(), nil
+	case models.TwoPersonPartner:
+		since := now.Add(-time.Duration(device.PartnerWindowSeconds) * time.Second)
+		err = s.db.QueryRow(GetWaitingPartnerQuery, device.MACAddress, reasonAwaitingPartner, tagId, since.UTC()).Scan(&partner)
+	case models.TwoPersonKeyholder:
+		since := time.Time{}
+		if s.cfg.OccupancyExpiry > 0 {
+			since = now.Add(-s.cfg.OccupancyExpiry)
+		}
+		partner, err = s.presentKeyholder(tagId, since)
+	default:
+		return models.Deny("unknown two-person rule"), nil
+	}
+
+	switch {
+	case err == sql.ErrNoRows && device.TwoPersonRule == models.TwoPersonPartner:
+		return models.Deny(reasonAwaitingPartner), nil
+	case err == sql.ErrNoRows:
+		return models.Deny("no keyholder present"), nil
+	case err != nil:
+		return models.Deny("two-person check failed"), err
+	}
+	return models.GrantWithPartner(partner), nil
+}
+
+// presentKeyholder returns the keyholder other than tagId who entered the
+// space earliest since the given time, or sql.ErrNoRows if none is in.
+func (s *DBService) presentKeyholder(tagId uint64, since time.Time) (uint64, error) {
+	present, err := s.fetchTagIds(GetPresentOthersQuery, tagId, since.UTC())
+	if err != nil {
+		return 0, err
+	}
+	if len(present) == 0 {
+		return 0, sql.ErrNoRows
+	}
+	keyholders, err := s.GetTagIdsForTraining(s.cfg.KeyholderTraining)
+	if err != nil {
+		return 0, err
+	}
+	isKeyholder := make(map[uint64]bool, len(keyholders))
+	for _, keyholder := range keyholders {
+		isKeyholder[keyholder] = true
+	}
+
+	for _, other := range present {
+		if isKeyholder[other] {
+			return other, nil
+		}
+	}
+	return 0, sql.ErrNoRows
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"rfid-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwoPersonRule(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := mockConfig()
+	cfg.OccupancyExpiry = 12 * time.Hour
+	cfg.KeyholderTraining = "Keyholder"
+	dbService := NewDBService(db, cfg, testLogger())
+
+	_, err := db.Exec(`INSERT INTO members (contact_id, tag_id, membership_level) VALUES (1, 111, 1), (2, 222, 1), (3, 333, 1), (4, 444, 1);
+		INSERT INTO trainings (label) VALUES ('Lathe'), ('Keyholder');
+		INSERT INTO members_trainings_link (tag_id, label) VALUES (111, 'Lathe'), (222, 'Lathe'), (333, 'Lathe'), (444, 'Keyholder')`)
+	require.NoError(t, err)
+
+	lathe := models.DeviceDetails{Name: "Metal Lathe", Type: models.DeviceTypeMachine, Enabled: true, TrainingLabels: []string{"Lathe"}}
+	require.NoError(t, dbService.CreateDevice("AA:AA:AA:AA:AA:AA", lathe))
+	_, err = dbService.ApproveDevice("AA:AA:AA:AA:AA:AA", lathe)
+	require.NoError(t, err)
+	door := models.DeviceDetails{Name: "Front Door", Type: models.DeviceTypeDoor, Enabled: true}
+	require.NoError(t, dbService.CreateDevice("BB:BB:BB:BB:BB:BB", door))
+	_, err = dbService.ApproveDevice("BB:BB:BB:BB:BB:BB", door)
+	require.NoError(t, err)
+
+	assert.Equal(t, ErrInvalidTwoPersonRule, dbService.SetTwoPersonRule("BB:BB:BB:BB:BB:BB", models.TwoPersonPartner, 60))
+	assert.Equal(t, ErrInvalidTwoPersonRule, dbService.SetTwoPersonRule("AA:AA:AA:AA:AA:AA", "buddy", 60))
+	assert.Equal(t, ErrInvalidTwoPersonRule, dbService.SetTwoPersonRule("AA:AA:AA:AA:AA:AA", models.TwoPersonPartner, -1))
+	require.NoError(t, dbService.SetTwoPersonRule("AA:AA:AA:AA:AA:AA", models.TwoPersonNone, -1), "only partner rules need a window")
+	require.NoError(t, dbService.SetTwoPersonRule("AA:AA:AA:AA:AA:AA", models.TwoPersonPartner, 60))
+
+	device, err := dbService.GetDevice("AA:AA:AA:AA:AA:AA")
+	require.NoError(t, err)
+	tagIds, err := dbService.GetDeviceCacheTags(*device)
+	require.NoError(t, err)
+	assert.Empty(t, tagIds)
+
+	swipe := func(device *models.Device, tag string, at time.Time) models.AccessDecision {
+		decision, err := dbService.AuthorizeTagAt(*device, tag, at)
+		require.NoError(t, err)
+		require.NoError(t, dbService.RecordAccess(*device, tag, decision, at))
+		return decision
+	}
+
+	now := time.Now()
+	assert.Equal(t, models.Deny(reasonAwaitingPartner), swipe(device, "111", now))
+	assert.Equal(t, models.Deny(reasonAwaitingPartner), swipe(device, "111", now.Add(time.Second)))
+	assert.Equal(t, models.Deny("missing training"), swipe(device, "444", now.Add(2*time.Second)))
+	assert.Equal(t, models.GrantWithPartner(111), swipe(device, "222", now.Add(3*time.Second)))
+
+	// The first swipe pairs once, and expires after the window
+	assert.Equal(t, models.Deny(reasonAwaitingPartner), swipe(device, "333", now.Add(4*time.Second)))
+	assert.Equal(t, models.Deny(reasonAwaitingPartner), swipe(device, "111", now.Add(2*time.Minute)))
+
+	log, err := dbService.GetAccessLog(device.MACAddress, 0)
+	require.NoError(t, err)
+	require.Len(t, log, 6)
+	assert.Equal(t, uint64(111), log[2].PartnerTagId)
+	assert.Equal(t, 1, log[2].PartnerContactId)
+
+	// A keyholder rule needs a keyholder in the space
+	require.NoError(t, dbService.SetTwoPersonRule(device.MACAddress, models.TwoPersonKeyholder, 60))
+	device, err = dbService.GetDevice(device.MACAddress)
+	require.NoError(t, err)
+	front, err := dbService.GetDevice("BB:BB:BB:BB:BB:BB")
+	require.NoError(t, err)
+
+	assert.Equal(t, models.Deny("no keyholder present"), swipe(device, "111", now))
+	assert.True(t, swipe(front, "444", now).Granted)
+	assert.Equal(t, models.GrantWithPartner(444), swipe(device, "111", now.Add(time.Minute)))
+}
@@ -202,6 +202,36 @@ func (s *WildApricotService) GetContact(contactId int) (*models.Contact, error)
 	return nil, fmt.Errorf("no contact found")
 }
 
+// GetEvents returns the account's upcoming events.
+func (s *WildApricotService) GetEvents() ([]models.Event, error) {
+	eventsURL := s.buildURL("/%d/events?$filter=%s",
+		s.cfg.WildApricotAccountId,
+		url.QueryEscape("IsUpcoming eq true"))
+
+	resp, err := s.makeHTTPRequest("GET", eventsURL, nil)
+	if err != nil {
+		s.logError("creating request for events", err)
+		return nil, err
+	}
+
+	body, err := readResponseBody(resp)
+	if err != nil {
+		s.logError("reading events response", err)
+		return nil, err
+	}
+
+	var eventsResponse struct {
+		Events []models.Event `json:"Events"`
+	}
+	if err := unmarshalJSON(body, &eventsResponse); err != nil {
+		s.logError("parsing events response", err)
+		return nil, err
+	}
+
+	s.log.Infof("Parsed %d events from response", len(eventsResponse.Events))
+	return eventsResponse.Events, nil
+}
+
 func (s *WildApricotService) parseHTTPResponse(resp *http.Response) ([]models.Contact, error) {
 	body, err := readResponseBody(resp)
 	if err != nil {
@@ -50,7 +50,7 @@ func TestRefreshApiToken(t *testing.T) {
 	defer os.Unsetenv("WILD_APRICOT_API_KEY")
 
 	cfg := &config.Config{}
-	service := NewWildApricotService(cfg)
+	service := NewWildApricotService(cfg, testLogger())
 	service.Client = &http.Client{Timeout: time.Second * 30}
 	service.TokenEndpoint = mockServer.URL
 
@@ -70,7 +70,7 @@ func TestRefreshApiToken(t *testing.T) {
 // 	defer os.Unsetenv("WILD_APRICOT_API_KEY")
 
 // 	cfg := &config.Config{}
-// 	service := NewWildApricotService(cfg)
+// 	service := NewWildApricotService(cfg, testLogger())
 // 	service.Client = &http.Client{Timeout: time.Second * 30}
 
 // 	service.TokenEndpoint = tokenServer.URL
@@ -124,7 +124,7 @@ func TestRefreshApiToken(t *testing.T) {
 // 			mockResp := ioutil.NopCloser(bytes.NewReader([]byte(tc.responseBody)))
 // 			resp := &http.Response{Body: mockResp}
 
-// 			service := NewWildApricotService(cfg)
+// 			service := NewWildApricotService(cfg, testLogger())
 // 			contacts, err := service.parseContactsResponse(resp)
 
 // 			if tc.expectedError {
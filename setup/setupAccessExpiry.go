@@ -0,0 +1,37 @@
+// File: setup/setupAccessExpiry.go
+package setup
+
+import (
+	"rfid-backend/services"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StartAccessExpiry periodically retires access overrides past their expiry
+// and starts and ends guest passes, so readers pick the changes up in their
+// caches.
+func StartAccessExpiry(dbService *services.DBService, logger *logrus.Logger) {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		for range ticker.C {
+			now := time.Now()
+
+			expired, err := dbService.ExpireOverrides(now)
+			if err != nil {
+				logger.Errorf("Failed to expire access overrides: %v", err)
+			}
+			for _, override := range expired {
+				logger.Infof("Access override %d (%s) expired", override.ID, override.Effect)
+			}
+
+			changed, err := dbService.SweepGuestPasses(now)
+			if err != nil {
+				logger.Errorf("Failed to update guest passes: %v", err)
+			}
+			for _, guest := range changed {
+				logger.Infof("Guest pass %d (%s) changed state", guest.ID, guest.Name)
+			}
+		}
+	}()
+}
@@ -0,0 +1,41 @@
+// File: setup/setupDeviceMonitor.go
+package setup
+
+import (
+	"fmt"
+	"rfid-backend/config"
+	"rfid-backend/services"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StartDeviceMonitor periodically checks when each approved reader was last
+// heard from and alerts when one goes offline or comes back.
+func StartDeviceMonitor(dbService *services.DBService, notifier *services.Notifier, cfg *config.Config, logger *logrus.Logger) {
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		for range ticker.C {
+			changed, err := dbService.UpdateDeviceHealth(cfg.DeviceOfflineAfter)
+			if err != nil {
+				logger.Errorf("Failed to update device health: %v", err)
+			}
+
+			for _, device := range changed {
+				if device.Online {
+					notifier.Notify("Device online", fmt.Sprintf("%s (%s) is back online", deviceLabel(device.Name, device.MACAddress), device.Location))
+				} else {
+					notifier.Notify("Device offline", fmt.Sprintf("%s (%s) has not been heard from since %s",
+						deviceLabel(device.Name, device.MACAddress), device.Location, device.LastSeen.Format(time.RFC3339)))
+				}
+			}
+		}
+	}()
+}
+
+func deviceLabel(name, mac string) string {
+	if name == "" {
+		return mac
+	}
+	return name + " [" + mac + "]"
+}
@@ -0,0 +1,41 @@
+// File: setup/setupEventSync.go
+package setup
+
+import (
+	"rfid-backend/config"
+	"rfid-backend/services"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StartEventSync keeps door unlock windows in step with upcoming public
+// Wild Apricot events. It does nothing unless event_unlock_doors is set.
+func StartEventSync(waService *services.WildApricotService, dbService *services.DBService, cfg *config.Config, logger *logrus.Logger) {
+	if len(cfg.EventUnlockDoors) == 0 {
+		return
+	}
+
+	go func() {
+		syncEventUnlockWindows(waService, dbService, logger)
+		ticker := time.NewTicker(30 * time.Minute)
+		for range ticker.C {
+			syncEventUnlockWindows(waService, dbService, logger)
+		}
+	}()
+}
+
+func syncEventUnlockWindows(waService *services.WildApricotService, dbService *services.DBService, logger *logrus.Logger) {
+	events, err := waService.GetEvents()
+	if err != nil {
+		logger.Errorf("Failed to fetch events from Wild Apricot: %v", err)
+		return
+	}
+
+	synced, err := dbService.SyncEventUnlockWindows(events, time.Now())
+	if err != nil {
+		logger.Errorf("Failed to sync event unlock windows: %v", err)
+		return
+	}
+	logger.Infof("Synced door unlock windows for %d public events", synced)
+}
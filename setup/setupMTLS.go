@@ -0,0 +1,48 @@
+// File: setup/setupMTLS.go
+package setup
+
+import (
+	"net/http"
+	"rfid-backend/config"
+	"rfid-backend/pki"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// StartMTLSListener serves the router on a second port that requires reader
+// client certificates signed by the DINGUS device CA. It is a no-op unless
+// mtls_listen_addr is configured.
+func StartMTLSListener(router *gin.Engine, cfg *config.Config, logger *logrus.Logger) error {
+	if cfg.MTLSListenAddr == "" {
+		return nil
+	}
+
+	caCert, err := pki.LoadCertificate(cfg.MTLSCACertFile)
+	if err != nil {
+		return err
+	}
+
+	checker, err := pki.NewRevocationChecker(caCert, cfg.MTLSCRLFile)
+	if err != nil {
+		return err
+	}
+	if checker.Stale() {
+		logger.Warnf("CRL %s is past its next update and every reader will be refused; re-sign it with `dingus-ca crl`", cfg.MTLSCRLFile)
+	}
+
+	server := &http.Server{
+		Addr:      cfg.MTLSListenAddr,
+		Handler:   router,
+		TLSConfig: pki.ServerTLSConfig(caCert, checker),
+	}
+
+	go func() {
+		logger.Infof("Starting mutual TLS device listener on %s", cfg.MTLSListenAddr)
+		if err := server.ListenAndServeTLS(cfg.CertFile, cfg.KeyFile); err != nil {
+			logger.Fatalf("Failed to start mutual TLS listener: %v", err)
+		}
+	}()
+
+	return nil
+}
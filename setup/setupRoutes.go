@@ -1,11 +1,11 @@
 package setup
 
 import (
-	"database/sql"
 	"net/http"
 	"rfid-backend/auth"
 	"rfid-backend/config"
 	"rfid-backend/handlers"
+	"rfid-backend/pki"
 	"rfid-backend/services"
 
 	"github.com/gin-contrib/sessions"
@@ -17,12 +17,24 @@ import (
 	"golang.org/x/oauth2"
 )
 
-func SetupRoutes(router *gin.Engine, cfg *config.Config, db *sql.DB, logger *logrus.Logger) {
-	store := cookie.NewStore([]byte("secret"))
+// SetupRoutes registers every route on router. dbService must be the one the
+// background tasks use, so the access changes they publish reach readers
+// subscribed to /api/accessEvents.
+func SetupRoutes(router *gin.Engine, cfg *config.Config, dbService *services.DBService, waService *services.WildApricotService, notifier *services.Notifier, logger *logrus.Logger) {
+	store := cookie.NewStore([]byte(cfg.CookieStoreSecret))
+	store.Options(sessions.Options{
+		Path:     "/",
+		MaxAge:   86400,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
 	router.Use(sessions.Sessions("mysession", store))
 
-	waService := services.NewWildApricotService(cfg, logger)
-	dbService := services.NewDBService(db, cfg, logger)
+	signer, err := pki.LoadSnapshotSigner(cfg.CacheSigningKeyFile, cfg.CacheSnapshotValidity)
+	if err != nil {
+		logger.Fatalf("Failed to load cache signing key: %v", err)
+	}
 
 	// In setupRoutes function
 	oauthConf := &oauth2.Config{
@@ -51,13 +63,100 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config, db *sql.DB, logger *log
 	{
 		webhooksHandler := handlers.NewWebhooksHandler(waService, dbService, cfg, logger)
 		configHandler := handlers.NewConfigHandler(logger)
-		accessControlHandler := handlers.NewAccessControlHandler(dbService, logger)
+		accessControlHandler := handlers.NewAccessControlHandler(dbService, notifier, logger)
+		cacheHandler := handlers.NewCacheHandler(dbService, signer, logger)
+		deviceAuth := handlers.NewDeviceAuth(dbService, cfg, logger)
+		heartbeatHandler := handlers.NewHeartbeatHandler(dbService, logger)
+		deviceHandler := handlers.NewDeviceHandler(dbService, logger)
+		accessEventsHandler := handlers.NewAccessEventsHandler(dbService, logger)
+		scheduleHandler := handlers.NewScheduleHandler(dbService, logger)
+		overrideHandler := handlers.NewOverrideHandler(dbService, logger)
+		guestPassHandler := handlers.NewGuestPassHandler(dbService, logger)
+		machineSessionHandler := handlers.NewMachineSessionHandler(dbService, logger)
+		occupancyHandler := handlers.NewOccupancyHandler(dbService, logger)
+		spaceModeHandler := handlers.NewSpaceModeHandler(dbService, notifier, logger)
+		doorUnlockHandler := handlers.NewDoorUnlockHandler(dbService, logger)
+		reservationHandler := handlers.NewReservationHandler(dbService, logger)
+		trainingHandler := handlers.NewTrainingHandler(dbService, logger)
 
-		api.POST("authenticate", accessControlHandler.HandleAuthenticate)
-		api.POST("/updateConfig", configHandler.UpdateConfig)
 		api.POST("/webhooks", webhooksHandler.HandleWebhook)
 		api.POST("/register", registrationHandler.HandleRegisterDevice)
-		api.POST("/updateDeviceAssignments", registrationHandler.UpdateDeviceAssignments)
+		api.GET("/cacheSigningKey", cacheHandler.HandleSigningKey)
+		api.GET("/occupancyCount", occupancyHandler.HandleOccupancyCount)
+
+		device := api.Group("", deviceAuth.RequireDevice)
+		{
+			device.POST("/authenticate", accessControlHandler.HandleAuthenticate)
+			device.GET("/doorCache", cacheHandler.HandleDoorCache)
+			device.GET("/machineCache", cacheHandler.HandleMachineCache)
+			device.GET("/cacheDelta", cacheHandler.HandleCacheDelta)
+			device.POST("/heartbeat", heartbeatHandler.HandleHeartbeat)
+			device.GET("/accessEvents", accessEventsHandler.HandleAccessEvents)
+			device.POST("/machineSessions/start", machineSessionHandler.HandleSessionStart)
+			device.POST("/machineSessions/stop", machineSessionHandler.HandleSessionStop)
+			device.GET("/doorState", doorUnlockHandler.HandleDoorState)
+		}
+
+		admin := api.Group("", auth.RequireAdmin)
+		{
+			admin.POST("/updateConfig", configHandler.UpdateConfig)
+			admin.POST("/updateDeviceAssignments", registrationHandler.UpdateDeviceAssignments)
+			admin.GET("/devices", deviceHandler.ListDevices)
+			admin.POST("/devices", deviceHandler.CreateDevice)
+			admin.GET("/devices/:mac", deviceHandler.GetDevice)
+			admin.PUT("/devices/:mac", deviceHandler.UpdateDevice)
+			admin.DELETE("/devices/:mac", deviceHandler.DeleteDevice)
+			admin.GET("/devices/:mac/audit", deviceHandler.GetDeviceAudit)
+			admin.POST("/devices/:mac/decommission", deviceHandler.DecommissionDevice)
+			admin.POST("/devices/:mac/maintenance", deviceHandler.SetMaintenance)
+			admin.PUT("/devices/:mac/direction", deviceHandler.SetDoorDirection)
+			admin.PUT("/devices/:mac/twoPersonRule", deviceHandler.SetTwoPersonRule)
+			admin.PUT("/devices/:mac/reservable", deviceHandler.SetReservable)
+			admin.POST("/devices/:mac/restore", deviceHandler.RestoreDevice)
+			admin.POST("/devices/:mac/approve", registrationHandler.ApproveDevice)
+			admin.POST("/devices/:mac/reject", registrationHandler.RejectDevice)
+			admin.POST("/devices/:mac/credential", registrationHandler.IssueDeviceCredential)
+			admin.DELETE("/devices/:mac/credential", registrationHandler.RevokeDeviceCredential)
+			admin.GET("/schedules", scheduleHandler.ListSchedules)
+			admin.POST("/schedules", scheduleHandler.CreateSchedule)
+			admin.GET("/schedules/:id", scheduleHandler.GetSchedule)
+			admin.PUT("/schedules/:id", scheduleHandler.UpdateSchedule)
+			admin.DELETE("/schedules/:id", scheduleHandler.DeleteSchedule)
+			admin.GET("/scheduleAssignments", scheduleHandler.ListAssignments)
+			admin.PUT("/scheduleAssignments", scheduleHandler.AssignSchedule)
+			admin.GET("/membershipLevels", scheduleHandler.ListMembershipLevels)
+			admin.GET("/overrides", overrideHandler.ListOverrides)
+			admin.POST("/overrides", overrideHandler.CreateOverride)
+			admin.DELETE("/overrides/:id", overrideHandler.DeleteOverride)
+			admin.GET("/guestPasses", guestPassHandler.ListGuestPasses)
+			admin.POST("/guestPasses", guestPassHandler.CreateGuestPass)
+			admin.DELETE("/guestPasses/:id", guestPassHandler.RevokeGuestPass)
+			admin.GET("/machineSessions", machineSessionHandler.ListSessions)
+			admin.GET("/machineUsage", machineSessionHandler.HandleUsageReport)
+			admin.GET("/occupancy", occupancyHandler.ListOccupants)
+			admin.GET("/accessLog", occupancyHandler.ListAccessLog)
+			admin.GET("/accessAnomalies", occupancyHandler.ListAnomalies)
+			admin.GET("/spaceMode", spaceModeHandler.GetSpaceMode)
+			admin.PUT("/spaceMode", spaceModeHandler.SetSpaceMode)
+			admin.GET("/spaceMode/history", spaceModeHandler.ListSpaceModeChanges)
+			admin.GET("/unlockWindows", doorUnlockHandler.ListUnlockWindows)
+			admin.POST("/unlockWindows", doorUnlockHandler.CreateUnlockWindow)
+			admin.DELETE("/unlockWindows/:id", doorUnlockHandler.DeleteUnlockWindow)
+			admin.GET("/trainings", trainingHandler.ListTrainings)
+			admin.GET("/trainings/due", trainingHandler.ListTrainingsDue)
+			admin.GET("/trainings/progress", trainingHandler.GetTrainingProgress)
+			admin.GET("/trainings/gaps", trainingHandler.ListPrerequisiteGaps)
+			admin.PUT("/trainings/:label", trainingHandler.SetTrainingValidity)
+			admin.PUT("/trainings/:label/relations", trainingHandler.SetTrainingRelations)
+			admin.POST("/trainings/:label/recertify", trainingHandler.Recertify)
+		}
+
+		member := api.Group("", auth.RequireMember)
+		{
+			member.GET("/reservations", reservationHandler.ListReservations)
+			member.POST("/reservations", reservationHandler.CreateReservation)
+			member.DELETE("/reservations/:id", reservationHandler.CancelReservation)
+		}
 	}
 
 	router.Static("/css", "./web-ui/css")
@@ -65,21 +164,36 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config, db *sql.DB, logger *log
 	router.Static("/assets", "./web-ui/assets")
 	router.LoadHTMLGlob("web-ui/templates/*")
 
-	setupWebUIRoutes(router, dbService, cfg, logger)
+	setupWebUIRoutes(router, dbService, cfg, notifier, logger)
 }
 
-func setupWebUIRoutes(router *gin.Engine, dbService *services.DBService, cfg *config.Config, logger *logrus.Logger) {
+func setupWebUIRoutes(router *gin.Engine, dbService *services.DBService, cfg *config.Config, notifier *services.Notifier, logger *logrus.Logger) {
 	rh := handlers.NewRegistrationHandler(dbService, cfg, logger)
+	gh := handlers.NewGuestPassHandler(dbService, logger)
+	oh := handlers.NewOccupancyHandler(dbService, logger)
+	sh := handlers.NewSpaceModeHandler(dbService, notifier, logger)
+	uh := handlers.NewDoorUnlockHandler(dbService, logger)
+	resh := handlers.NewReservationHandler(dbService, logger)
+	th := handlers.NewTrainingHandler(dbService, logger)
 	webUI := router.Group("/web-ui")
 	{
 		webUI.Use(auth.RequireAuth)
 		webUI.GET("/home", func(c *gin.Context) {
 			logger.Info("Serving the home page")
-			c.HTML(http.StatusOK, "home.tmpl", nil)
+			c.HTML(http.StatusOK, "home.tmpl", gin.H{"csrfToken": auth.CSRFToken(c)})
 		})
 		webUI.GET("/configManagement", func(c *gin.Context) {
-			c.HTML(http.StatusOK, "configManagement.tmpl", gin.H{"title": "Configuration Management"})
+			c.HTML(http.StatusOK, "configManagement.tmpl", gin.H{
+				"title":     "Configuration Management",
+				"csrfToken": auth.CSRFToken(c),
+			})
 		})
 		webUI.GET("/deviceManagement", rh.ServeDeviceManagementPage)
+		webUI.GET("/guestPasses", auth.RequireAdminPage, gh.ServeGuestPassesPage)
+		webUI.GET("/occupancy", auth.RequireAdminPage, oh.ServeOccupancyPage)
+		webUI.GET("/spaceMode", auth.RequireAdminPage, sh.ServeSpaceModePage)
+		webUI.GET("/doorUnlocks", auth.RequireAdminPage, uh.ServeDoorUnlocksPage)
+		webUI.GET("/reservations", resh.ServeReservationsPage)
+		webUI.GET("/trainings", auth.RequireAdminPage, th.ServeTrainingsPage)
 	}
 }
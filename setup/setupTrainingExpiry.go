@@ -0,0 +1,48 @@
+// File: setup/setupTrainingExpiry.go
+package setup
+
+import (
+	"fmt"
+	"rfid-backend/services"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StartTrainingExpiry periodically lapses trainings past their validity, so
+// readers drop them from their caches, and alerts admins to expired
+// trainings and ones due for recertification.
+func StartTrainingExpiry(dbService *services.DBService, notifier *services.Notifier, logger *logrus.Logger) {
+	go func() {
+		ticker := time.NewTicker(15 * time.Minute)
+		for ; true; <-ticker.C {
+			now := time.Now()
+
+			expired, err := dbService.SweepTrainingExpiry(now)
+			if err != nil {
+				logger.Errorf("Failed to expire trainings: %v", err)
+			}
+			if len(expired) > 0 {
+				var lines []string
+				for _, t := range expired {
+					logger.Infof("Training %s of member %d expired", t.Label, t.ContactId)
+					lines = append(lines, fmt.Sprintf("%s for member %d", t.Label, t.ContactId))
+				}
+				notifier.Notify("Trainings expired", strings.Join(lines, "\n"))
+			}
+
+			due, err := dbService.TrainingReminders(now)
+			if err != nil {
+				logger.Errorf("Failed to send training reminders: %v", err)
+			}
+			if len(due) > 0 {
+				var lines []string
+				for _, t := range due {
+					lines = append(lines, fmt.Sprintf("%s for member %d expires %s", t.Label, t.ContactId, t.ExpiresAt.Format("2006-01-02")))
+				}
+				notifier.Notify("Recertification due", strings.Join(lines, "\n"))
+			}
+		}
+	}()
+}
@@ -0,0 +1,220 @@
+// Package tagformat turns RFID credentials written in the notations readers
+// and people use into the single number DINGUS stores, so a fob matches
+// whether it was entered as a decimal number, a Wiegand facility and card
+// number, a raw Wiegand frame or a hex UID.
+//
+// Wiegand credentials are stored as their data bits without parity, i.e.
+// facility<<cardBits | card, which is also what most readers print as the
+// card's decimal number. UIDs are stored as their bytes read big-endian.
+package tagformat
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Formats a Parser can accept.
+const (
+	Decimal   = "decimal"   // the stored number itself, e.g. 8106606
+	Wiegand26 = "wiegand26" // 8-bit facility, 16-bit card, e.g. 123:45678
+	Wiegand34 = "wiegand34" // 16-bit facility, 16-bit card
+	Wiegand37 = "wiegand37" // HID H10304: 16-bit facility, 19-bit card
+	HexUID    = "hex"       // 4 or 7 byte UID, e.g. 04:A2:1B:3C:55:80:81
+)
+
+var (
+	ErrInvalidTag    = errors.New("tag is not in an accepted format")
+	ErrUnknownFormat = errors.New("unknown tag format")
+)
+
+// DefaultFormats are accepted when none are configured.
+var DefaultFormats = []string{Decimal, Wiegand26, Wiegand34, Wiegand37, HexUID}
+
+type wiegand struct {
+	bits, facilityBits, cardBits int
+	// Bits covered by the leading even and trailing odd parity bits
+	evenFrom, evenTo, oddFrom, oddTo int
+}
+
+var wiegandFormats = map[string]wiegand{
+	Wiegand26: {bits: 26, facilityBits: 8, cardBits: 16, evenFrom: 1, evenTo: 12, oddFrom: 13, oddTo: 24},
+	Wiegand34: {bits: 34, facilityBits: 16, cardBits: 16, evenFrom: 1, evenTo: 16, oddFrom: 17, oddTo: 32},
+	Wiegand37: {bits: 37, facilityBits: 16, cardBits: 19, evenFrom: 1, evenTo: 18, oddFrom: 18, oddTo: 35},
+}
+
+// Parser normalizes tags written in its accepted formats.
+type Parser struct {
+	formats map[string]bool
+	// facility reads "facility:card" notation; the first Wiegand format
+	// configured
+	facility string
+}
+
+// NewParser accepts the given formats, or DefaultFormats if there are none.
+func NewParser(formats []string) (*Parser, error) {
+	if len(formats) == 0 {
+		formats = DefaultFormats
+	}
+
+	p := &Parser{formats: make(map[string]bool)}
+	for _, format := range formats {
+		format = strings.ToLower(strings.TrimSpace(format))
+		if _, ok := wiegandFormats[format]; ok {
+			if p.facility == "" {
+				p.facility = format
+			}
+		} else if format != Decimal && format != HexUID {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+		}
+		p.formats[format] = true
+	}
+	return p, nil
+}
+
+// Parse normalizes raw, which may be:
+//
+//	8106606                  decimal
+//	123:45678                Wiegand facility and card number (also "123,45678" or "123-45678")
+//	0b10111101110110010...   raw Wiegand frame with parity; its length picks the format
+//	0x04A21B3C, 04:A2:1B:3C  hex UID (also space separated, or bare hex containing a letter)
+//
+// Zero is never a valid tag, and neither is a decimal number above
+// math.MaxInt64, which SQLite cannot store.
+func (p *Parser) Parse(raw string) (uint64, error) {
+	raw = strings.TrimSpace(raw)
+
+	var (
+		tag uint64
+		err error
+	)
+	switch {
+	case raw == "":
+		err = ErrInvalidTag
+	case hasPrefixFold(raw, "0b"):
+		tag, err = p.parseFrame(raw[2:])
+	case hasPrefixFold(raw, "0x"):
+		tag, err = p.parseHex(raw[2:])
+	case strings.ContainsAny(raw, ":,- ") && !isFacilityCard(raw):
+		tag, err = p.parseHex(raw)
+	case isFacilityCard(raw):
+		tag, err = p.parseFacilityCard(raw)
+	case isDigits(raw) && p.formats[Decimal]:
+		tag, err = strconv.ParseUint(raw, 10, 63)
+	default:
+		tag, err = p.parseHex(raw)
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q: %v", ErrInvalidTag, raw, err)
+	}
+	if tag == 0 {
+		return 0, fmt.Errorf("%w: %q is zero", ErrInvalidTag, raw)
+	}
+	return tag, nil
+}
+
+func (p *Parser) parseFacilityCard(raw string) (uint64, error) {
+	if p.facility == "" {
+		return 0, errors.New("no Wiegand format is enabled")
+	}
+	format := wiegandFormats[p.facility]
+
+	parts := strings.FieldsFunc(raw, func(r rune) bool { return r == ':' || r == ',' || r == '-' })
+	facility, err := strconv.ParseUint(parts[0], 10, format.facilityBits)
+	if err != nil {
+		return 0, fmt.Errorf("facility code does not fit %s", p.facility)
+	}
+	card, err := strconv.ParseUint(parts[1], 10, format.cardBits)
+	if err != nil {
+		return 0, fmt.Errorf("card number does not fit %s", p.facility)
+	}
+	return facility<<format.cardBits | card, nil
+}
+
+func (p *Parser) parseFrame(bits string) (uint64, error) {
+	var (
+		name   string
+		format wiegand
+	)
+	for n, f := range wiegandFormats {
+		if f.bits == len(bits) && p.formats[n] {
+			name, format = n, f
+		}
+	}
+	if name == "" {
+		return 0, fmt.Errorf("no enabled Wiegand format is %d bits", len(bits))
+	}
+
+	frame := make([]int, len(bits))
+	for i, c := range bits {
+		if c != '0' && c != '1' {
+			return 0, errors.New("frame must be binary")
+		}
+		frame[i] = int(c - '0')
+	}
+
+	// The leading bit makes its half even, the trailing bit makes its half odd
+	if ones(frame, format.evenFrom, format.evenTo)%2 != frame[0] {
+		return 0, fmt.Errorf("%s even parity failed", name)
+	}
+	if (ones(frame, format.oddFrom, format.oddTo)+frame[len(frame)-1])%2 != 1 {
+		return 0, fmt.Errorf("%s odd parity failed", name)
+	}
+
+	var tag uint64
+	for _, bit := range frame[1 : len(frame)-1] {
+		tag = tag<<1 | uint64(bit)
+	}
+	return tag, nil
+}
+
+func (p *Parser) parseHex(raw string) (uint64, error) {
+	if !p.formats[HexUID] {
+		return 0, errors.New("hex UIDs are not enabled")
+	}
+
+	digits := strings.NewReplacer(":", "", "-", "", " ", "", ",", "").Replace(raw)
+	if len(digits)%2 != 0 {
+		digits = "0" + digits
+	}
+	switch len(digits) / 2 {
+	case 4, 7:
+	default:
+		return 0, errors.New("UID must be 4 or 7 bytes")
+	}
+	return strconv.ParseUint(digits, 16, 64)
+}
+
+// isFacilityCard reports whether raw is two decimal numbers joined by one
+// separator, as in 123:45678.
+func isFacilityCard(raw string) bool {
+	parts := strings.FieldsFunc(raw, func(r rune) bool { return r == ':' || r == ',' || r == '-' })
+	return len(parts) == 2 && len(parts[0]) <= 5 && isDigits(parts[0]) && isDigits(parts[1]) &&
+		len(raw) == len(parts[0])+len(parts[1])+1
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+func ones(frame []int, from, to int) int {
+	n := 0
+	for _, bit := range frame[from : to+1] {
+		n += bit
+	}
+	return n
+}
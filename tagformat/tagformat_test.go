@@ -0,0 +1,86 @@
+package tagformat
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	parser, err := NewParser(nil)
+	require.NoError(t, err)
+
+	// The same Wiegand 26 fob, facility 123 card 45678, in every notation
+	for _, raw := range []string{"8106606", "123:45678", "123,45678", " 123-45678 ", "0b10111101110110010011011101"} {
+		tag, err := parser.Parse(raw)
+		require.NoError(t, err, raw)
+		assert.Equal(t, uint64(8106606), tag, raw)
+	}
+
+	// The largest tag SQLite can store
+	tag, err := parser.Parse("9223372036854775807")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(math.MaxInt64), tag)
+
+	// HID H10304 frame, facility 1234 card 56789
+	tag, err = parser.Parse("0b1000001001101001000011011101110101010")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1234<<19|56789), tag)
+
+	// 4 and 7 byte UIDs
+	for raw, want := range map[string]uint64{
+		"0x04A21B3C":           0x04A21B3C,
+		"04:a2:1b:3c":          0x04A21B3C,
+		"04A21B3C":             0x04A21B3C,
+		"04 A2 1B 3C 55 80 81": 0x04A21B3C558081,
+		"04A21B3C558081":       0x04A21B3C558081,
+	} {
+		tag, err := parser.Parse(raw)
+		require.NoError(t, err, raw)
+		assert.Equal(t, want, tag, raw)
+	}
+
+	for _, raw := range []string{
+		"",
+		"0",
+		"abc",
+		"256:1",                        // facility too large for Wiegand 26
+		"123:65536",                    // card too large for Wiegand 26
+		"0b10111101110110010011011100", // odd parity broken
+		"0b00111101110110010011011101", // even parity broken
+		"0b1011110111011001001101110",  // no 25-bit format
+		"04:A2:1B",                     // 3 byte UID
+		"18446744073709551616",         // overflows
+		"9223372036854775808",          // above what SQLite can store
+	} {
+		_, err := parser.Parse(raw)
+		assert.ErrorIs(t, err, ErrInvalidTag, raw)
+	}
+}
+
+func TestConfiguredFormats(t *testing.T) {
+	_, err := NewParser([]string{"decimal", "wiegand35"})
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+
+	// Facility and card numbers follow the first Wiegand format listed
+	parser, err := NewParser([]string{"Decimal", "wiegand37", "wiegand26"})
+	require.NoError(t, err)
+	tag, err := parser.Parse("1234:56789")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1234<<19|56789), tag)
+
+	_, err = parser.Parse("04:A2:1B:3C")
+	assert.ErrorIs(t, err, ErrInvalidTag)
+	_, err = parser.Parse("0b1000001001101001000011011101110101010")
+	assert.NoError(t, err)
+
+	decimalOnly, err := NewParser([]string{"decimal"})
+	require.NoError(t, err)
+	_, err = decimalOnly.Parse("123:45678")
+	assert.ErrorIs(t, err, ErrInvalidTag)
+	tag, err = decimalOnly.Parse("8106606")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(8106606), tag)
+}
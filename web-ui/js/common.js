@@ -0,0 +1,23 @@
+// Returns the CSRF token rendered into the page header. Every state-changing
+// call to the admin API must send it in the X-CSRF-Token header.
+function csrfToken() {
+    let meta = document.querySelector('meta[name="csrf-token"]');
+    return meta ? meta.content : '';
+}
+
+// Shows message in the page's toast element.
+function showToast(message) {
+    let toastElement = document.querySelector('.toast');
+    let toastBody = toastElement.querySelector('.toast-body') || toastElement; // Fallback to toastElement if .toast-body not found
+    toastBody.textContent = message;
+
+    // Use Bootstrap's Toast component if available, otherwise fallback
+    if (typeof bootstrap !== 'undefined' && bootstrap.Toast) {
+        let toast = new bootstrap.Toast(toastElement);
+        toast.show();
+    } else {
+        // Fallback or custom toast display logic
+        toastElement.style.display = 'block';
+        setTimeout(() => toastElement.style.display = 'none', 3000);
+    }
+}
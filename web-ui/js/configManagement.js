@@ -23,6 +23,7 @@ document.getElementById('configForm').addEventListener('submit', function(e) {
         method: 'POST',
         headers: {
             'Content-Type': 'application/json',
+            'X-CSRF-Token': csrfToken(),
         },
         body: JSON.stringify(configData),
     })
@@ -5,34 +5,26 @@ document.getElementById('deviceManagementForm').addEventListener('submit', funct
         return;
     }
 
-    // Initialize an array to hold the assignment objects
-    let assignments = [];
-    document.querySelectorAll('#deviceList tr').forEach(row => {
-        let ipAddress = row.querySelector('td:nth-child(1)').textContent.trim();
-        let macAddress = row.querySelector('td:nth-child(2)').textContent.trim(); // No need to replace colons for JSON
-        let selectedTraining = row.querySelector('select').value;
-
-        // Push an object for each row into the assignments array
-        assignments.push({
-            ipAddress: ipAddress,
-            macAddress: macAddress,
-            trainingLabel: selectedTraining
-        });
+    // Each device is saved with its own request so one bad row does not hide the rest
+    let saves = Array.from(document.querySelectorAll('#deviceList tr')).map(row => {
+        return fetch('/api/devices/' + encodeURIComponent(row.dataset.mac), {
+            method: 'PUT',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-CSRF-Token': csrfToken(),
+            },
+            body: JSON.stringify(deviceDetails(row)),
+        })
+        .then(response => response.json().then(data => ({ ok: response.ok, data: data, mac: row.dataset.mac })));
     });
 
-    fetch(this.action, {
-        method: this.method,
-        headers: {
-            'Content-Type': 'application/json',
-        },
-        body: JSON.stringify(assignments), // Convert the array to JSON
-    })
-    .then(response => response.json())
-    .then(data => {
-        if (data.success) {
-            showToast("Device assignments updated successfully.");
+    Promise.all(saves)
+    .then(results => {
+        let failed = results.filter(result => !result.ok);
+        if (failed.length === 0) {
+            showToast("Devices updated successfully.");
         } else {
-            showToast(data.message || "Failed to update device assignments.");
+            showToast(failed.map(result => result.mac + ": " + (result.data.error || "update failed")).join("; "));
         }
     })
     .catch(() => {
@@ -40,19 +32,40 @@ document.getElementById('deviceManagementForm').addEventListener('submit', funct
     });
 });
 
+function deviceDetails(row) {
+    return {
+        name: row.querySelector('.device-name').value.trim(),
+        location: row.querySelector('.device-location').value.trim(),
+        type: row.querySelector('.device-type').value,
+        notes: row.querySelector('.device-notes').value.trim(),
+        enabled: row.querySelector('.device-enabled').checked,
+        trainingLabels: selectedTrainings(row),
+        trainingMode: row.querySelector('.device-training-mode').value
+    };
+}
+
+function selectedTrainings(row) {
+    return Array.from(row.querySelector('.device-training').selectedOptions).map(option => option.value);
+}
 
 function validateForm() {
     let isValid = true;
-    let allSelects = document.querySelectorAll('#deviceList select');
 
-    // Reset validation state
-    allSelects.forEach(select => select.classList.remove('is-invalid'));
+    document.querySelectorAll('#deviceList tr').forEach(row => {
+        let name = row.querySelector('.device-name');
+        let training = row.querySelector('.device-training');
+        name.classList.remove('is-invalid');
+        training.classList.remove('is-invalid');
 
-    allSelects.forEach(select => {
-        if (select.value === '') {
-            // Highlight the invalid select element
-            select.classList.add('is-invalid');
-            showToast("Please assign a training label to all devices.");
+        if (name.value.trim() === '') {
+            name.classList.add('is-invalid');
+            showToast("Every device needs a name.");
+            isValid = false;
+        }
+        // Machines admit nobody without a training; doors and kiosks may have none
+        if (row.querySelector('.device-type').value === 'machine' && training.selectedOptions.length === 0) {
+            training.classList.add('is-invalid');
+            showToast("Please assign at least one training to every machine.");
             isValid = false;
         }
     });
@@ -60,18 +73,248 @@ function validateForm() {
     return isValid;
 }
 
-function showToast(message) {
-    let toastElement = document.querySelector('.toast');
-    let toastBody = toastElement.querySelector('.toast-body') || toastElement; // Fallback to toastElement if .toast-body not found
-    toastBody.textContent = message;
-
-    // Use Bootstrap's Toast component if available, otherwise fallback
-    if (typeof bootstrap !== 'undefined' && bootstrap.Toast) {
-        let toast = new bootstrap.Toast(toastElement);
-        toast.show();
-    } else {
-        // Fallback or custom toast display logic
-        toastElement.style.display = 'block';
-        setTimeout(() => toastElement.style.display = 'none', 3000);
+document.querySelectorAll('.issue-credential').forEach(button => {
+    button.addEventListener('click', function() {
+        let mac = this.dataset.mac;
+        if (!confirm('Issue a new credential for ' + mac + '? Any previous credential stops working.')) {
+            return;
+        }
+
+        fetch('/api/devices/' + encodeURIComponent(mac) + '/credential', {
+            method: 'POST',
+            headers: {
+                'X-CSRF-Token': csrfToken(),
+            },
+        })
+        .then(response => response.json().then(data => ({ ok: response.ok, data: data })))
+        .then(({ ok, data }) => {
+            if (!ok) {
+                showToast(data.error || "Failed to issue credential.");
+                return;
+            }
+            showEnrollmentCode(mac, data.enrollment_code);
+            location.reload();
+        })
+        .catch(() => {
+            showToast("An error occurred. Please try again.");
+        });
+    });
+});
+
+document.querySelectorAll('.revoke-credential').forEach(button => {
+    button.addEventListener('click', function() {
+        let mac = this.dataset.mac;
+        if (!confirm('Revoke the credential for ' + mac + '? The device will return to pending until re-approved.')) {
+            return;
+        }
+
+        fetch('/api/devices/' + encodeURIComponent(mac) + '/credential', {
+            method: 'DELETE',
+            headers: {
+                'X-CSRF-Token': csrfToken(),
+            },
+        })
+        .then(response => {
+            if (response.ok) {
+                location.reload();
+            } else {
+                showToast("Failed to revoke credential.");
+            }
+        })
+        .catch(() => {
+            showToast("An error occurred. Please try again.");
+        });
+    });
+});
+
+document.querySelectorAll('.approve-device').forEach(button => {
+    button.addEventListener('click', function() {
+        let mac = this.dataset.mac;
+        let row = this.closest('tr');
+        let name = row.querySelector('.device-name').value.trim();
+        let trainingSelect = row.querySelector('.device-training');
+
+        if (name === '') {
+            row.querySelector('.device-name').classList.add('is-invalid');
+            showToast("Please name the device before approving it.");
+            return;
+        }
+        if (row.querySelector('.device-type').value === 'machine' && trainingSelect.selectedOptions.length === 0) {
+            trainingSelect.classList.add('is-invalid');
+            showToast("Please assign at least one training before approving a machine.");
+            return;
+        }
+
+        fetch('/api/devices/' + encodeURIComponent(mac) + '/approve', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-CSRF-Token': csrfToken(),
+            },
+            body: JSON.stringify({
+                name: name,
+                location: row.querySelector('.device-location').value.trim(),
+                type: row.querySelector('.device-type').value,
+                trainingLabels: selectedTrainings(row),
+                trainingMode: row.querySelector('.device-training-mode').value
+            }),
+        })
+        .then(response => response.json().then(data => ({ ok: response.ok, data: data })))
+        .then(({ ok, data }) => {
+            if (!ok) {
+                showToast(data.error || "Failed to approve device.");
+                return;
+            }
+            showEnrollmentCode(mac, data.enrollment_code);
+            location.reload();
+        })
+        .catch(() => {
+            showToast("An error occurred. Please try again.");
+        });
+    });
+});
+
+document.querySelectorAll('.reject-device').forEach(button => {
+    button.addEventListener('click', function() {
+        let mac = this.dataset.mac;
+        if (!confirm('Reject the registration from ' + mac + '?')) {
+            return;
+        }
+
+        fetch('/api/devices/' + encodeURIComponent(mac) + '/reject', {
+            method: 'POST',
+            headers: {
+                'X-CSRF-Token': csrfToken(),
+            },
+        })
+        .then(response => {
+            if (response.ok) {
+                location.reload();
+            } else {
+                showToast("Failed to reject device.");
+            }
+        })
+        .catch(() => {
+            showToast("An error occurred. Please try again.");
+        });
+    });
+});
+
+document.querySelectorAll('.delete-device').forEach(button => {
+    button.addEventListener('click', function() {
+        let mac = this.dataset.mac;
+        if (!confirm('Delete ' + mac + '? Its credential stops working and it will have to register again.')) {
+            return;
+        }
+
+        fetch('/api/devices/' + encodeURIComponent(mac), {
+            method: 'DELETE',
+            headers: {
+                'X-CSRF-Token': csrfToken(),
+            },
+        })
+        .then(response => {
+            if (response.ok) {
+                location.reload();
+            } else {
+                showToast("Failed to delete device.");
+            }
+        })
+        .catch(() => {
+            showToast("An error occurred. Please try again.");
+        });
+    });
+});
+
+document.querySelectorAll('.decommission-device').forEach(button => {
+    button.addEventListener('click', function() {
+        let mac = this.dataset.mac;
+        if (!confirm('Decommission ' + mac + '? Its credential is removed and it will be refused until restored and re-approved.')) {
+            return;
+        }
+        deviceAction(mac, 'decommission', null, "Failed to decommission device.");
+    });
+});
+
+document.querySelectorAll('.maintenance-device').forEach(button => {
+    button.addEventListener('click', function() {
+        let mac = this.dataset.mac;
+        let reason = prompt('Why is ' + mac + ' being locked out? Every swipe is denied until it is restored.');
+        if (reason === null) {
+            return;
+        }
+        if (reason.trim() === '') {
+            showToast("A reason is required.");
+            return;
+        }
+        deviceAction(mac, 'maintenance', { reason: reason.trim() }, "Failed to put device in maintenance.");
+    });
+});
+
+document.querySelectorAll('.restore-device').forEach(button => {
+    button.addEventListener('click', function() {
+        deviceAction(this.dataset.mac, 'restore', null, "Failed to restore device.");
+    });
+});
+
+// deviceAction posts to /api/devices/{mac}/{action} and reloads on success.
+function deviceAction(mac, action, body, failureMessage) {
+    let headers = { 'X-CSRF-Token': csrfToken() };
+    if (body !== null) {
+        headers['Content-Type'] = 'application/json';
     }
+
+    fetch('/api/devices/' + encodeURIComponent(mac) + '/' + action, {
+        method: 'POST',
+        headers: headers,
+        body: body === null ? undefined : JSON.stringify(body),
+    })
+    .then(response => response.json().then(data => ({ ok: response.ok, data: data })))
+    .then(({ ok, data }) => {
+        if (!ok) {
+            showToast(data.error || failureMessage);
+            return;
+        }
+        location.reload();
+    })
+    .catch(() => {
+        showToast("An error occurred. Please try again.");
+    });
+}
+
+document.getElementById('addDeviceForm').addEventListener('submit', function(e) {
+    e.preventDefault();
+
+    let form = new FormData(this);
+    fetch('/api/devices', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+            'X-CSRF-Token': csrfToken(),
+        },
+        body: JSON.stringify({
+            macAddress: form.get('macAddress').trim(),
+            name: form.get('name').trim(),
+            location: form.get('location').trim(),
+            type: form.get('type'),
+            notes: form.get('notes').trim()
+        }),
+    })
+    .then(response => response.json().then(data => ({ ok: response.ok, data: data })))
+    .then(({ ok, data }) => {
+        if (!ok) {
+            showToast(data.error || "Failed to add device.");
+            return;
+        }
+        location.reload();
+    })
+    .catch(() => {
+        showToast("An error occurred. Please try again.");
+    });
+});
+
+// The device presents the code on its next registration to collect its
+// credential. Only its hash is kept, so it is shown here once.
+function showEnrollmentCode(mac, code) {
+    alert('Enrollment code for ' + mac + ':\n\n' + code + '\n\nEnter it on the reader. This code will not be shown again.');
 }
@@ -0,0 +1,90 @@
+document.querySelectorAll('.unlock-schedule').forEach(select => {
+    select.addEventListener('change', function() {
+        fetch('/api/scheduleAssignments', {
+            method: 'PUT',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-CSRF-Token': csrfToken(),
+            },
+            body: JSON.stringify({
+                target_type: 'unlock',
+                target: this.dataset.mac,
+                schedule_id: parseInt(this.value, 10)
+            }),
+        })
+        .then(response => response.json().then(data => ({ ok: response.ok, data: data })))
+        .then(({ ok, data }) => {
+            if (!ok) {
+                showToast(data.error || "Failed to assign unlock schedule.");
+                return;
+            }
+            location.reload();
+        })
+        .catch(() => {
+            showToast("An error occurred. Please try again.");
+        });
+    });
+});
+
+document.getElementById('unlockWindowForm').addEventListener('submit', function(e) {
+    e.preventDefault();
+
+    let form = new FormData(this);
+    // datetime-local inputs are in the browser's time zone; send them as RFC 3339
+    let startsAt = new Date(form.get('startsAt'));
+    let endsAt = new Date(form.get('endsAt'));
+    if (endsAt <= startsAt) {
+        showToast("The window must end after it starts.");
+        return;
+    }
+
+    fetch('/api/unlockWindows', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+            'X-CSRF-Token': csrfToken(),
+        },
+        body: JSON.stringify({
+            name: form.get('name').trim(),
+            starts_at: startsAt.toISOString(),
+            ends_at: endsAt.toISOString(),
+            doors: form.getAll('doors')
+        }),
+    })
+    .then(response => response.json().then(data => ({ ok: response.ok, data: data })))
+    .then(({ ok, data }) => {
+        if (!ok) {
+            showToast(data.error || "Failed to create unlock window.");
+            return;
+        }
+        location.reload();
+    })
+    .catch(() => {
+        showToast("An error occurred. Please try again.");
+    });
+});
+
+document.querySelectorAll('.delete-unlock-window').forEach(button => {
+    button.addEventListener('click', function() {
+        if (!confirm('Delete the unlock window ' + this.dataset.name + '?')) {
+            return;
+        }
+
+        fetch('/api/unlockWindows/' + encodeURIComponent(this.dataset.id), {
+            method: 'DELETE',
+            headers: {
+                'X-CSRF-Token': csrfToken(),
+            },
+        })
+        .then(response => {
+            if (response.ok) {
+                location.reload();
+            } else {
+                showToast("Failed to delete unlock window.");
+            }
+        })
+        .catch(() => {
+            showToast("An error occurred. Please try again.");
+        });
+    });
+});
@@ -0,0 +1,64 @@
+document.getElementById('guestPassForm').addEventListener('submit', function(e) {
+    e.preventDefault();
+
+    let form = new FormData(this);
+    // datetime-local inputs are in the browser's time zone; send them as RFC 3339
+    let startsAt = new Date(form.get('startsAt'));
+    let endsAt = new Date(form.get('endsAt'));
+    if (endsAt <= startsAt) {
+        showToast("The pass must end after it starts.");
+        return;
+    }
+
+    fetch('/api/guestPasses', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+            'X-CSRF-Token': csrfToken(),
+        },
+        body: JSON.stringify({
+            name: form.get('name').trim(),
+            tag: form.get('tag').trim(),
+            sponsor_contact_id: parseInt(form.get('sponsorContactId'), 10),
+            starts_at: startsAt.toISOString(),
+            ends_at: endsAt.toISOString(),
+            doors: form.getAll('doors')
+        }),
+    })
+    .then(response => response.json().then(data => ({ ok: response.ok, data: data })))
+    .then(({ ok, data }) => {
+        if (!ok) {
+            showToast(data.error || "Failed to create guest pass.");
+            return;
+        }
+        location.reload();
+    })
+    .catch(() => {
+        showToast("An error occurred. Please try again.");
+    });
+});
+
+document.querySelectorAll('.revoke-guest-pass').forEach(button => {
+    button.addEventListener('click', function() {
+        if (!confirm('Revoke the guest pass for ' + this.dataset.name + '?')) {
+            return;
+        }
+
+        fetch('/api/guestPasses/' + encodeURIComponent(this.dataset.id), {
+            method: 'DELETE',
+            headers: {
+                'X-CSRF-Token': csrfToken(),
+            },
+        })
+        .then(response => {
+            if (response.ok) {
+                location.reload();
+            } else {
+                showToast("Failed to revoke guest pass.");
+            }
+        })
+        .catch(() => {
+            showToast("An error occurred. Please try again.");
+        });
+    });
+});
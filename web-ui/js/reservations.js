@@ -0,0 +1,71 @@
+let reservationForm = document.getElementById('reservationForm');
+if (reservationForm) {
+    reservationForm.addEventListener('submit', function(e) {
+        e.preventDefault();
+
+        let form = new FormData(this);
+        // datetime-local inputs are in the browser's time zone; send them as RFC 3339
+        let startsAt = new Date(form.get('startsAt'));
+        let endsAt = new Date(form.get('endsAt'));
+        if (endsAt <= startsAt) {
+            showToast("The reservation must end after it starts.");
+            return;
+        }
+
+        let body = {
+            mac_address: form.get('mac'),
+            starts_at: startsAt.toISOString(),
+            ends_at: endsAt.toISOString(),
+            note: form.get('note').trim()
+        };
+        if (form.get('contactId')) {
+            body.contact_id = parseInt(form.get('contactId'), 10);
+        }
+
+        fetch('/api/reservations', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-CSRF-Token': csrfToken(),
+            },
+            body: JSON.stringify(body),
+        })
+        .then(response => response.json().then(data => ({ ok: response.ok, data: data })))
+        .then(({ ok, data }) => {
+            if (!ok) {
+                showToast(data.error || "Failed to reserve the machine.");
+                return;
+            }
+            location.reload();
+        })
+        .catch(() => {
+            showToast("An error occurred. Please try again.");
+        });
+    });
+}
+
+document.querySelectorAll('.cancel-reservation').forEach(button => {
+    button.addEventListener('click', function() {
+        if (!confirm('Cancel this reservation?')) {
+            return;
+        }
+
+        fetch('/api/reservations/' + encodeURIComponent(this.dataset.id), {
+            method: 'DELETE',
+            headers: {
+                'X-CSRF-Token': csrfToken(),
+            },
+        })
+        .then(response => response.json().then(data => ({ ok: response.ok, data: data })))
+        .then(({ ok, data }) => {
+            if (!ok) {
+                showToast(data.error || "Failed to cancel reservation.");
+                return;
+            }
+            location.reload();
+        })
+        .catch(() => {
+            showToast("An error occurred. Please try again.");
+        });
+    });
+});
@@ -0,0 +1,32 @@
+document.getElementById('spaceModeForm').addEventListener('submit', function(e) {
+    e.preventDefault();
+
+    let form = new FormData(this);
+    let mode = form.get('mode');
+    if (mode !== 'normal' && !confirm('Switch every reader to ' + mode + ' mode?')) {
+        return;
+    }
+
+    fetch('/api/spaceMode', {
+        method: 'PUT',
+        headers: {
+            'Content-Type': 'application/json',
+            'X-CSRF-Token': csrfToken(),
+        },
+        body: JSON.stringify({
+            mode: mode,
+            reason: form.get('reason').trim()
+        }),
+    })
+    .then(response => response.json().then(data => ({ ok: response.ok, data: data })))
+    .then(({ ok, data }) => {
+        if (!ok) {
+            showToast(data.error || "Failed to set space mode.");
+            return;
+        }
+        location.reload();
+    })
+    .catch(() => {
+        showToast("An error occurred. Please try again.");
+    });
+});
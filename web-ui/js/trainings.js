@@ -0,0 +1,128 @@
+document.querySelectorAll('.training-validity').forEach(form => {
+    form.addEventListener('submit', function(e) {
+        e.preventDefault();
+
+        fetch('/api/trainings/' + encodeURIComponent(this.dataset.label), {
+            method: 'PUT',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-CSRF-Token': csrfToken(),
+            },
+            body: JSON.stringify({
+                validity_days: parseInt(new FormData(this).get('validityDays'), 10)
+            }),
+        })
+        .then(response => response.json().then(data => ({ ok: response.ok, data: data })))
+        .then(({ ok, data }) => {
+            if (!ok) {
+                showToast(data.error || "Failed to set training validity.");
+                return;
+            }
+            location.reload();
+        })
+        .catch(() => {
+            showToast("An error occurred. Please try again.");
+        });
+    });
+});
+
+document.querySelectorAll('.recertify').forEach(button => {
+    button.addEventListener('click', function() {
+        if (!confirm('Renew ' + this.dataset.label + ' for member ' + this.dataset.contactId + ' from today?')) {
+            return;
+        }
+
+        fetch('/api/trainings/' + encodeURIComponent(this.dataset.label) + '/recertify', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-CSRF-Token': csrfToken(),
+            },
+            body: JSON.stringify({
+                contact_id: parseInt(this.dataset.contactId, 10)
+            }),
+        })
+        .then(response => response.json().then(data => ({ ok: response.ok, data: data })))
+        .then(({ ok, data }) => {
+            if (!ok) {
+                showToast(data.error || "Failed to renew training.");
+                return;
+            }
+            location.reload();
+        })
+        .catch(() => {
+            showToast("An error occurred. Please try again.");
+        });
+    });
+});
+
+document.querySelectorAll('.training-relations').forEach(form => {
+    form.addEventListener('submit', function(e) {
+        e.preventDefault();
+
+        const selected = name => Array.from(this.querySelector('select[name="' + name + '"]').selectedOptions).map(option => option.value);
+
+        fetch('/api/trainings/' + encodeURIComponent(this.dataset.label) + '/relations', {
+            method: 'PUT',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-CSRF-Token': csrfToken(),
+            },
+            body: JSON.stringify({
+                requires: selected('requires'),
+                implies: selected('implies'),
+            }),
+        })
+        .then(response => response.json().then(data => ({ ok: response.ok, data: data })))
+        .then(({ ok, data }) => {
+            if (!ok) {
+                showToast(data.error || "Failed to set training prerequisites.");
+                return;
+            }
+            location.reload();
+        })
+        .catch(() => {
+            showToast("An error occurred. Please try again.");
+        });
+    });
+});
+
+const trainingStatusBadges = {
+    held: 'badge-success',
+    implied: 'badge-info',
+    blocked: 'badge-warning',
+    expired: 'badge-danger',
+    available: 'badge-primary',
+    locked: 'badge-secondary',
+};
+
+document.getElementById('trainingProgressForm').addEventListener('submit', function(e) {
+    e.preventDefault();
+
+    const contactId = new FormData(this).get('contactId');
+    fetch('/api/trainings/progress?contact_id=' + encodeURIComponent(contactId))
+    .then(response => response.json().then(data => ({ ok: response.ok, data: data })))
+    .then(({ ok, data }) => {
+        if (!ok) {
+            showToast(data.error || "Failed to get training progress.");
+            return;
+        }
+
+        const table = document.getElementById('trainingProgress');
+        const body = table.querySelector('tbody');
+        body.innerHTML = '';
+        data.forEach(progress => {
+            const row = body.insertRow();
+            row.insertCell().textContent = progress.label;
+            const badge = document.createElement('span');
+            badge.className = 'badge ' + (trainingStatusBadges[progress.status] || 'badge-light');
+            badge.textContent = progress.status;
+            row.insertCell().appendChild(badge);
+            row.insertCell().textContent = (progress.missing || []).join(' → ');
+        });
+        table.classList.remove('d-none');
+    })
+    .catch(() => {
+        showToast("An error occurred. Please try again.");
+    });
+});